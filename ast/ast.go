@@ -316,6 +316,55 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+type SliceExpression struct {
+	Token token.Token // The [ token
+	Left  Expression
+	Start Expression // nil if omitted
+	End   Expression // nil if omitted
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
+type TryExpression struct {
+	Token   token.Token // The 'try' token
+	Block   *BlockStatement
+	Param   *Identifier // bound to the caught value
+	Handler *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+	out.WriteString(" catch(")
+	out.WriteString(te.Param.String())
+	out.WriteString(") ")
+	out.WriteString(te.Handler.String())
+
+	return out.String()
+}
+
 type HashLiteral struct {
 	Token token.Token // the '{' token
 	Pairs map[Expression]Expression
@@ -337,3 +386,53 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+type MacroLiteral struct {
+	Token      token.Token // The 'macro' token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
+// BadStatement stands in for a statement the parser could not make sense of
+type BadStatement struct {
+	Token   token.Token // the first token of the statement
+	Skipped string      // the tokens the parser skipped, separated by blanks
+}
+
+func (bs *BadStatement) statementNode()       {}
+func (bs *BadStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BadStatement) String() string       { return "<bad statement: " + bs.Skipped + ">" }
+
+// BadExpression stands in for an expression the parser could not make sense of
+type BadExpression struct {
+	Token   token.Token // the token no expression can start with
+	Skipped string      // the token, unless it has been left to the enclosing expression
+}
+
+func (be *BadExpression) expressionNode()      {}
+func (be *BadExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BadExpression) String() string {
+	if be.Skipped == "" {
+		return "<missing expression>"
+	}
+	return "<bad expression: " + be.Skipped + ">"
+}
@@ -0,0 +1,66 @@
+package ast
+
+import (
+	"monkey/token"
+	"reflect"
+)
+
+// TokenOf returns the token stored in node;
+// for programs, it is the token of the first statement.
+// The boolean is false if there is no such token.
+func TokenOf(node Node) (token.Token, bool) {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return token.Token{}, false
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		if len(node.Statements) == 0 {
+			return token.Token{}, false
+		}
+		return TokenOf(node.Statements[0])
+	case *LetStatement:
+		return node.Token, true
+	case *ReturnStatement:
+		return node.Token, true
+	case *ExpressionStatement:
+		return node.Token, true
+	case *BlockStatement:
+		return node.Token, true
+	case *Identifier:
+		return node.Token, true
+	case *Boolean:
+		return node.Token, true
+	case *IntegerLiteral:
+		return node.Token, true
+	case *PrefixExpression:
+		return node.Token, true
+	case *InfixExpression:
+		return node.Token, true
+	case *IfExpression:
+		return node.Token, true
+	case *FunctionLiteral:
+		return node.Token, true
+	case *CallExpression:
+		return node.Token, true
+	case *StringLiteral:
+		return node.Token, true
+	case *ArrayLiteral:
+		return node.Token, true
+	case *IndexExpression:
+		return node.Token, true
+	case *SliceExpression:
+		return node.Token, true
+	case *TryExpression:
+		return node.Token, true
+	case *HashLiteral:
+		return node.Token, true
+	case *MacroLiteral:
+		return node.Token, true
+	case *BadStatement:
+		return node.Token, true
+	case *BadExpression:
+		return node.Token, true
+	}
+	return token.Token{}, false
+}
@@ -0,0 +1,143 @@
+package ast
+
+type ModifierFunc func(Node) Node
+
+// Modify applies modifier to the children of node and then to node itself.
+// Nodes are not altered in place: every node with children is copied,
+// whether a child is replaced or not, so the tree passed in remains intact;
+// leaves, e.g. identifiers and literals, are passed to modifier as they are.
+// Missing children, e.g. an omitted else branch, are left as they are.
+func Modify(node Node, modifier ModifierFunc) Node {
+	if isNil(node) {
+		return node
+	}
+
+	switch node := node.(type) {
+
+	case *Program:
+		modified := *node
+		modified.Statements = modifyStatements(node.Statements, modifier)
+		return modifier(&modified)
+
+	// Statements
+	case *LetStatement:
+		modified := *node
+		modified.Name, _ = Modify(node.Name, modifier).(*Identifier)
+		modified.Value, _ = Modify(node.Value, modifier).(Expression)
+		return modifier(&modified)
+
+	case *ReturnStatement:
+		modified := *node
+		modified.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+		return modifier(&modified)
+
+	case *ExpressionStatement:
+		modified := *node
+		modified.Expression, _ = Modify(node.Expression, modifier).(Expression)
+		return modifier(&modified)
+
+	case *BlockStatement:
+		modified := *node
+		modified.Statements = modifyStatements(node.Statements, modifier)
+		return modifier(&modified)
+
+	// Expressions
+	case *PrefixExpression:
+		modified := *node
+		modified.Right, _ = Modify(node.Right, modifier).(Expression)
+		return modifier(&modified)
+
+	case *InfixExpression:
+		modified := *node
+		modified.Left, _ = Modify(node.Left, modifier).(Expression)
+		modified.Right, _ = Modify(node.Right, modifier).(Expression)
+		return modifier(&modified)
+
+	case *IfExpression:
+		modified := *node
+		modified.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		modified.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
+		modified.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
+		return modifier(&modified)
+
+	case *FunctionLiteral:
+		modified := *node
+		modified.Parameters = modifyIdentifiers(node.Parameters, modifier)
+		modified.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+		return modifier(&modified)
+
+	case *MacroLiteral:
+		modified := *node
+		modified.Parameters = modifyIdentifiers(node.Parameters, modifier)
+		modified.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+		return modifier(&modified)
+
+	case *CallExpression:
+		modified := *node
+		modified.Function, _ = Modify(node.Function, modifier).(Expression)
+		modified.Arguments = modifyExpressions(node.Arguments, modifier)
+		return modifier(&modified)
+
+	case *ArrayLiteral:
+		modified := *node
+		modified.Elements = modifyExpressions(node.Elements, modifier)
+		return modifier(&modified)
+
+	case *IndexExpression:
+		modified := *node
+		modified.Left, _ = Modify(node.Left, modifier).(Expression)
+		modified.Index, _ = Modify(node.Index, modifier).(Expression)
+		return modifier(&modified)
+
+	case *SliceExpression:
+		modified := *node
+		modified.Left, _ = Modify(node.Left, modifier).(Expression)
+		modified.Start, _ = Modify(node.Start, modifier).(Expression)
+		modified.End, _ = Modify(node.End, modifier).(Expression)
+		return modifier(&modified)
+
+	case *TryExpression:
+		modified := *node
+		modified.Block, _ = Modify(node.Block, modifier).(*BlockStatement)
+		modified.Param, _ = Modify(node.Param, modifier).(*Identifier)
+		modified.Handler, _ = Modify(node.Handler, modifier).(*BlockStatement)
+		return modifier(&modified)
+
+	case *HashLiteral:
+		modified := *node
+		modified.Pairs = make(map[Expression]Expression, len(node.Pairs))
+		for key, val := range node.Pairs {
+			newKey, _ := Modify(key, modifier).(Expression)
+			newVal, _ := Modify(val, modifier).(Expression)
+			modified.Pairs[newKey] = newVal
+		}
+		return modifier(&modified)
+	}
+
+	// leaves: Identifier, Boolean, IntegerLiteral, StringLiteral, BadExpression, BadStatement
+	return modifier(node)
+}
+
+func modifyStatements(statements []Statement, modifier ModifierFunc) []Statement {
+	modified := make([]Statement, len(statements))
+	for i, statement := range statements {
+		modified[i], _ = Modify(statement, modifier).(Statement)
+	}
+	return modified
+}
+
+func modifyExpressions(expressions []Expression, modifier ModifierFunc) []Expression {
+	modified := make([]Expression, len(expressions))
+	for i, expression := range expressions {
+		modified[i], _ = Modify(expression, modifier).(Expression)
+	}
+	return modified
+}
+
+func modifyIdentifiers(identifiers []*Identifier, modifier ModifierFunc) []*Identifier {
+	modified := make([]*Identifier, len(identifiers))
+	for i, identifier := range identifiers {
+		modified[i], _ = Modify(identifier, modifier).(*Identifier)
+	}
+	return modified
+}
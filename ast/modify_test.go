@@ -0,0 +1,285 @@
+package ast
+
+import (
+	"monkey/token"
+	"reflect"
+	"testing"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+
+		if integer.Value != 1 {
+			return node
+		}
+
+		integer = &IntegerLiteral{Value: 2}
+		return integer
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{
+			one(),
+			two(),
+		},
+		{
+			&Program{
+				Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				},
+			},
+			&Program{
+				Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				},
+			},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&IfExpression{
+				Condition: one(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+				Alternative: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&IfExpression{
+				Condition: two(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+				Alternative: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&LetStatement{Value: one()},
+			&LetStatement{Value: two()},
+		},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one(), two()}},
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{two(), two()}},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+		{
+			&IfExpression{
+				Condition: one(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&IfExpression{
+				Condition: two(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&SliceExpression{Left: one(), Start: one(), End: one()},
+			&SliceExpression{Left: two(), Start: two(), End: two()},
+		},
+		{
+			&SliceExpression{Left: one(), End: one()},
+			&SliceExpression{Left: two(), End: two()},
+		},
+		{
+			&TryExpression{
+				Block: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+				Param: &Identifier{Value: "e"},
+				Handler: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&TryExpression{
+				Block: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+				Param: &Identifier{Value: "e"},
+				Handler: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&MacroLiteral{
+				Parameters: []*Identifier{{Value: "x"}},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&MacroLiteral{
+				Parameters: []*Identifier{{Value: "x"}},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		equal := reflect.DeepEqual(modified, tt.expected)
+		if !equal {
+			t.Errorf("not equal. got=%#v, want=%#v",
+				modified, tt.expected)
+		}
+	}
+
+	hashLiteral := &HashLiteral{
+		Pairs: map[Expression]Expression{
+			one(): one(),
+			one(): one(),
+		},
+	}
+
+	modified := Modify(hashLiteral, turnOneIntoTwo).(*HashLiteral)
+
+	for key, val := range modified.Pairs {
+		key, _ := key.(*IntegerLiteral)
+		if key.Value != 2 {
+			t.Errorf("value is not %d, got=%d", 2, key.Value)
+		}
+		val, _ := val.(*IntegerLiteral)
+		if val.Value != 2 {
+			t.Errorf("value is not %d, got=%d", 2, val.Value)
+		}
+	}
+}
+
+func TestModifyIdentifiers(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name:  &Identifier{Value: "x"},
+				Value: &Identifier{Value: "x"},
+			},
+			&ExpressionStatement{
+				Expression: &FunctionLiteral{
+					Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+					Parameters: []*Identifier{{Value: "x"}},
+					Body:       &BlockStatement{Statements: []Statement{}},
+				},
+			},
+		},
+	}
+
+	modified := Modify(program, func(node Node) Node {
+		if ident, ok := node.(*Identifier); ok && ident.Value == "x" {
+			return &Identifier{Value: "y"}
+		}
+		return node
+	})
+
+	expected := "let y = y;fn(y) "
+	if modified.String() != expected {
+		t.Errorf("not renamed. want=%q, got=%q", expected, modified.String())
+	}
+}
+
+func TestModifyKeepsOriginal(t *testing.T) {
+	original := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{
+				Expression: &InfixExpression{
+					Left:     &IntegerLiteral{Value: 1},
+					Operator: "+",
+					Right:    &IntegerLiteral{Value: 2},
+				},
+			},
+		},
+	}
+
+	Modify(original, func(node Node) Node {
+		if _, ok := node.(*IntegerLiteral); ok {
+			return &IntegerLiteral{Value: 3}
+		}
+		return node
+	})
+
+	infix := original.Statements[0].(*ExpressionStatement).Expression.(*InfixExpression)
+	if infix.Left.(*IntegerLiteral).Value != 1 || infix.Right.(*IntegerLiteral).Value != 2 {
+		t.Errorf("original has been altered. got=%#v", infix)
+	}
+}
@@ -0,0 +1,149 @@
+package ast
+
+import (
+	"reflect"
+	"sort"
+)
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an ast in depth-first order: it starts by calling v.Visit(node);
+// the children are visited in the order of the input; missing children are skipped.
+func Walk(v Visitor, node Node) {
+	if isNil(node) {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+
+	case *Program:
+		for _, s := range n.Statements {
+			Walk(v, s)
+		}
+
+	// Statements
+	case *LetStatement:
+		Walk(v, n.Name)
+		Walk(v, n.Value)
+
+	case *ReturnStatement:
+		Walk(v, n.ReturnValue)
+
+	case *ExpressionStatement:
+		Walk(v, n.Expression)
+
+	case *BadStatement:
+		// leaf
+
+	case *BlockStatement:
+		for _, s := range n.Statements {
+			Walk(v, s)
+		}
+
+	// Expressions
+	case *Identifier, *Boolean, *IntegerLiteral, *StringLiteral, *BadExpression:
+		// leaves
+
+	case *PrefixExpression:
+		Walk(v, n.Right)
+
+	case *InfixExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case *IfExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Consequence)
+		Walk(v, n.Alternative)
+
+	case *FunctionLiteral:
+		for _, p := range n.Parameters {
+			Walk(v, p)
+		}
+		Walk(v, n.Body)
+
+	case *MacroLiteral:
+		for _, p := range n.Parameters {
+			Walk(v, p)
+		}
+		Walk(v, n.Body)
+
+	case *CallExpression:
+		Walk(v, n.Function)
+		for _, a := range n.Arguments {
+			Walk(v, a)
+		}
+
+	case *ArrayLiteral:
+		for _, el := range n.Elements {
+			Walk(v, el)
+		}
+
+	case *IndexExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Index)
+
+	case *SliceExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Start)
+		Walk(v, n.End)
+
+	case *TryExpression:
+		Walk(v, n.Block)
+		Walk(v, n.Param)
+		Walk(v, n.Handler)
+
+	case *HashLiteral:
+		for _, key := range SortedKeys(n) {
+			Walk(v, key)
+			Walk(v, n.Pairs[key])
+		}
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an ast in depth-first order: it starts by calling f(node);
+// if f returns true, Inspect invokes f recursively for each of the children of node,
+// followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// SortedKeys returns the keys of a hash literal in the order of the input
+func SortedKeys(hl *HashLiteral) []Expression {
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for key := range hl.Pairs {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, _ := TokenOf(keys[i])
+		b, _ := TokenOf(keys[j])
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+
+	return keys
+}
+
+// isNil reports whether node is nil or a nil pointer
+func isNil(node Node) bool {
+	return node == nil || reflect.ValueOf(node).IsNil()
+}
@@ -0,0 +1,169 @@
+package ast
+
+import (
+	"monkey/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func integer(value int64) *IntegerLiteral {
+	return &IntegerLiteral{Token: token.Token{Literal: strings.Repeat("I", int(value))}, Value: value}
+}
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		input    Node
+		expected []string // the node types visited, "nil" for the closing call
+	}{
+		{
+			integer(1),
+			[]string{"*ast.IntegerLiteral", "nil"},
+		},
+		{
+			&Program{Statements: []Statement{
+				&LetStatement{Name: &Identifier{Value: "x"}, Value: integer(1)},
+			}},
+			[]string{"*ast.Program", "*ast.LetStatement", "*ast.Identifier", "nil",
+				"*ast.IntegerLiteral", "nil", "nil", "nil"},
+		},
+		{
+			&IfExpression{
+				Condition:   &Boolean{Value: true},
+				Consequence: &BlockStatement{Statements: []Statement{}},
+			},
+			[]string{"*ast.IfExpression", "*ast.Boolean", "nil", "*ast.BlockStatement", "nil", "nil"},
+		},
+		{
+			&SliceExpression{Left: &Identifier{Value: "a"}, End: integer(2)},
+			[]string{"*ast.SliceExpression", "*ast.Identifier", "nil", "*ast.IntegerLiteral", "nil", "nil"},
+		},
+		{
+			&CallExpression{
+				Function:  &Identifier{Value: "f"},
+				Arguments: []Expression{&StringLiteral{Value: "s"}, &PrefixExpression{Operator: "-", Right: integer(1)}},
+			},
+			[]string{"*ast.CallExpression", "*ast.Identifier", "nil", "*ast.StringLiteral", "nil",
+				"*ast.PrefixExpression", "*ast.IntegerLiteral", "nil", "nil", "nil"},
+		},
+		{
+			&TryExpression{
+				Block:   &BlockStatement{},
+				Param:   &Identifier{Value: "e"},
+				Handler: &BlockStatement{Statements: []Statement{&ReturnStatement{ReturnValue: &Identifier{Value: "e"}}}},
+			},
+			[]string{"*ast.TryExpression", "*ast.BlockStatement", "nil", "*ast.Identifier", "nil",
+				"*ast.BlockStatement", "*ast.ReturnStatement", "*ast.Identifier", "nil", "nil", "nil", "nil"},
+		},
+	}
+
+	for _, tt := range tests {
+		visited := []string{}
+		Inspect(tt.input, func(node Node) bool {
+			if node == nil {
+				visited = append(visited, "nil")
+			} else {
+				visited = append(visited, reflect.TypeOf(node).String())
+			}
+			return true
+		})
+
+		if !reflect.DeepEqual(visited, tt.expected) {
+			t.Errorf("wrong nodes visited for %s.\nwant=%v\ngot= %v", tt.input, tt.expected, visited)
+		}
+	}
+}
+
+func TestInspectPrunes(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &FunctionLiteral{
+			Parameters: []*Identifier{{Value: "x"}},
+			Body: &BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: &Identifier{Value: "x"}},
+			}},
+		}},
+		&ExpressionStatement{Expression: &Identifier{Value: "y"}},
+	}}
+
+	identifiers := []string{}
+	Inspect(program, func(node Node) bool {
+		if _, ok := node.(*FunctionLiteral); ok {
+			return false
+		}
+		if ident, ok := node.(*Identifier); ok {
+			identifiers = append(identifiers, ident.Value)
+		}
+		return true
+	})
+
+	if !reflect.DeepEqual(identifiers, []string{"y"}) {
+		t.Errorf("function literal has not been pruned. got=%v", identifiers)
+	}
+}
+
+func TestInspectHashLiteralInInputOrder(t *testing.T) {
+	key := func(line, column int, value string) Expression {
+		return &StringLiteral{Token: token.Token{Line: line, Column: column}, Value: value}
+	}
+
+	hash := &HashLiteral{Pairs: map[Expression]Expression{
+		key(2, 1, "c"): integer(3),
+		key(1, 9, "b"): integer(2),
+		key(1, 2, "a"): integer(1),
+	}}
+
+	visited := []string{}
+	Inspect(hash, func(node Node) bool {
+		switch node := node.(type) {
+		case *StringLiteral:
+			visited = append(visited, node.Value)
+		case *IntegerLiteral:
+			visited = append(visited, node.String())
+		}
+		return true
+	})
+
+	expected := []string{"a", "I", "b", "II", "c", "III"}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("wrong order. want=%v, got=%v", expected, visited)
+	}
+}
+
+type countingVisitor map[string]int
+
+func (c countingVisitor) Visit(node Node) Visitor {
+	if node != nil {
+		c[reflect.TypeOf(node).String()]++
+	}
+	return c
+}
+
+func TestWalk(t *testing.T) {
+	node := &MacroLiteral{
+		Parameters: []*Identifier{{Value: "a"}, {Value: "b"}},
+		Body: &BlockStatement{Statements: []Statement{
+			&ExpressionStatement{Expression: &InfixExpression{
+				Left:     &IndexExpression{Left: &Identifier{Value: "a"}, Index: integer(1)},
+				Operator: "+",
+				Right:    &ArrayLiteral{Elements: []Expression{&Identifier{Value: "b"}}},
+			}},
+		}},
+	}
+
+	counts := countingVisitor{}
+	Walk(counts, node)
+
+	expected := countingVisitor{
+		"*ast.MacroLiteral":        1,
+		"*ast.Identifier":          4,
+		"*ast.BlockStatement":      1,
+		"*ast.ExpressionStatement": 1,
+		"*ast.InfixExpression":     1,
+		"*ast.IndexExpression":     1,
+		"*ast.IntegerLiteral":      1,
+		"*ast.ArrayLiteral":        1,
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("wrong counts.\nwant=%v\ngot= %v", expected, counts)
+	}
+}
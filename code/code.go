@@ -0,0 +1,237 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+
+	OpMinus
+	OpBang
+
+	OpTrue
+	OpFalse
+	OpNull
+	OpNil // the value of blocks without expression statement at their end
+
+	OpJump
+	OpJumpNotTruthy
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+
+	OpArray
+	OpHash
+	OpIndex
+	OpSlice
+
+	OpCall
+	OpTailCall
+	OpReturnValue
+	OpClosure
+
+	OpTry
+	OpEndTry
+
+	OpQuote
+)
+
+// operands of OpSlice
+const (
+	SliceStart = 1 << iota // the start of the slice has been given
+	SliceEnd               // the end of the slice has been given
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd:         {"OpAdd", []int{}},
+	OpSub:         {"OpSub", []int{}},
+	OpMul:         {"OpMul", []int{}},
+	OpDiv:         {"OpDiv", []int{}},
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+	OpNil:   {"OpNil", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},          // target
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}}, // target
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},   // index
+	OpSetGlobal: {"OpSetGlobal", []int{2}},   // index
+	OpGetLocal:  {"OpGetLocal", []int{1, 1}}, // depth, index
+	OpSetLocal:  {"OpSetLocal", []int{1}},    // index
+
+	OpArray: {"OpArray", []int{2}}, // number of elements
+	OpHash:  {"OpHash", []int{2}},  // number of keys and values
+	OpIndex: {"OpIndex", []int{}},
+	OpSlice: {"OpSlice", []int{1}}, // SliceStart | SliceEnd
+
+	OpCall:        {"OpCall", []int{1}},     // number of arguments
+	OpTailCall:    {"OpTailCall", []int{1}}, // number of arguments
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpClosure:     {"OpClosure", []int{2}}, // constant index of the function
+
+	OpTry:    {"OpTry", []int{2, 1}}, // handler, local index of the catch parameter
+	OpEndTry: {"OpEndTry", []int{}},
+
+	OpQuote: {"OpQuote", []int{2}}, // constant index of the call to quote
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes an instruction; operands too wide for their width are truncated,
+// see CheckOperands
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// CheckOperands returns an error if op is undefined or its operands
+// are not as many as defined or do not fit into their widths
+func CheckOperands(op Opcode, operands ...int) error {
+	def, err := Lookup(byte(op))
+	if err != nil {
+		return err
+	}
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Errorf("%s takes %d operands, got %d", def.Name, len(def.OperandWidths), len(operands))
+	}
+	for i, o := range operands {
+		max := 1<<(8*uint(def.OperandWidths[i])) - 1
+		if o < 0 || o > max {
+			return fmt.Errorf("operand %d of %s out of range: %d, maximum %d", i+1, def.Name, o, max)
+		}
+	}
+	return nil
+}
+
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
@@ -0,0 +1,115 @@
+package code
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{1, 255}, []byte{byte(OpGetLocal), 1, 255}},
+		{OpTry, []int{65534, 3}, []byte{byte(OpTry), 255, 254, 3}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Errorf("instruction has wrong length. want=%d, got=%d",
+				len(tt.expected), len(instruction))
+		}
+
+		for i, b := range tt.expected {
+			if instruction[i] != tt.expected[i] {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d",
+					i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestCheckOperands(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		valid    bool
+	}{
+		{OpConstant, []int{65535}, true},
+		{OpConstant, []int{65536}, false},
+		{OpConstant, []int{-1}, false},
+		{OpCall, []int{255}, true},
+		{OpCall, []int{256}, false},
+		{OpGetLocal, []int{256, 0}, false},
+		{OpTry, []int{65535, 255}, true},
+		{OpAdd, []int{1}, false},
+	}
+
+	for _, tt := range tests {
+		err := CheckOperands(tt.op, tt.operands...)
+		if (err == nil) != tt.valid {
+			t.Errorf("CheckOperands(%d, %v) wrong. want valid=%t, got err=%v", tt.op, tt.operands, tt.valid, err)
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1, 2),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpTry, 12, 0),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1 2
+0004 OpConstant 2
+0007 OpConstant 65535
+0010 OpTry 12 0
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q",
+			expected, concatted.String())
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{1, 255}, 2},
+		{OpTry, []int{300, 7}, 3},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,640 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+)
+
+type Compiler struct {
+	constants     []object.Object
+	firstConstant int // the constants before have been added by former compilations
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	line   int // position of the node being compiled
+	column int
+}
+
+type CompilationScope struct {
+	instructions code.Instructions
+	positions    []object.SourcePosition
+	callees      []object.SourcePosition
+	function     bool // false for the program
+	tries        int  // number of enclosing try blocks
+}
+
+type Bytecode struct {
+	Main          *object.CompiledFunction
+	Constants     []object.Object
+	FirstConstant int // index of the first constant of this compilation
+}
+
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(), []object.Object{})
+}
+
+// NewWithState creates a compiler that continues the compilation
+// of former input, e.g. in a session
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	s.resetLocals()
+	return &Compiler{
+		constants:     constants,
+		firstConstant: len(constants),
+		symbolTable:   s,
+		scopes:        []CompilationScope{{}},
+		scopeIndex:    0,
+	}
+}
+
+// Compile compiles a program, a statement or an expression to the main function
+func (c *Compiler) Compile(node ast.Node) error {
+	var statements []ast.Statement
+
+	switch node := node.(type) {
+	case *ast.Program:
+		statements = node.Statements
+	case *ast.BlockStatement:
+		statements = node.Statements
+	case ast.Statement:
+		statements = []ast.Statement{node}
+	case ast.Expression:
+		statements = []ast.Statement{&ast.ExpressionStatement{Expression: node}}
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	if err := c.compileBlock(statements, false); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	if c.symbolTable.numLocals > 256 {
+		return fmt.Errorf("too many local bindings")
+	}
+	return nil
+}
+
+// Bytecode returns the main function and the constants; the compiled functions
+// refer to the constants, which are kept as long as any of them is
+func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.scopes[c.scopeIndex]
+	for _, constant := range c.constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			fn.Constants = c.constants
+		}
+	}
+	return &Bytecode{
+		Main: &object.CompiledFunction{
+			Instructions: scope.instructions,
+			NumLocals:    c.symbolTable.numLocals,
+			LocalNames:   c.symbolTable.localNames,
+			Positions:    scope.positions,
+			Callees:      scope.callees,
+			Constants:    c.constants,
+		},
+		Constants:     c.constants,
+		FirstConstant: c.firstConstant,
+	}
+}
+
+// compileBlock compiles statements to code that leaves the value of
+// the last statement on the stack, or nil if it is no expression statement
+func (c *Compiler) compileBlock(statements []ast.Statement, tail bool) error {
+	if len(statements) == 0 {
+		c.emit(code.OpNil)
+		return nil
+	}
+
+	for i, s := range statements {
+		last := i == len(statements)-1
+
+		switch s := s.(type) {
+		case *ast.ExpressionStatement:
+			if err := c.compileExpression(s.Expression, tail && last); err != nil {
+				return err
+			}
+			if !last {
+				c.emit(code.OpPop)
+			}
+
+		case *ast.LetStatement:
+			if err := c.compileLetStatement(s); err != nil {
+				return err
+			}
+			if last {
+				c.emit(code.OpNil)
+			}
+
+		case *ast.ReturnStatement:
+			restore := c.setPosition(s)
+			scope := c.scopes[c.scopeIndex]
+			if err := c.compileExpression(s.ReturnValue, scope.function && scope.tries == 0); err != nil {
+				return err
+			}
+			c.emit(code.OpReturnValue)
+			restore()
+
+		case *ast.BlockStatement:
+			if err := c.compileBlock(s.Statements, tail && last); err != nil {
+				return err
+			}
+			if !last {
+				c.emit(code.OpPop)
+			}
+
+		default:
+			return fmt.Errorf("cannot compile %T", s)
+		}
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileLetStatement(s *ast.LetStatement) error {
+	defer c.setPosition(s)()
+
+	// the value is compiled first, since it may refer to an outer binding of the name
+	if err := c.compileExpression(s.Value, false); err != nil {
+		return err
+	}
+
+	symbol := c.symbolTable.Define(s.Name.Value)
+	if symbol.Scope == GlobalScope {
+		_, err := c.emit(code.OpSetGlobal, symbol.Index)
+		return err
+	}
+	_, err := c.emit(code.OpSetLocal, symbol.Index)
+	return err
+}
+
+// compileExpression compiles an expression to code that leaves its value on the stack;
+// tail is true if the expression is in tail position of a function
+func (c *Compiler) compileExpression(node ast.Expression, tail bool) error {
+	defer c.setPosition(node)()
+
+	switch node := node.(type) {
+
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		return c.emitConstant(code.OpConstant, integer)
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		return c.emitConstant(code.OpConstant, str)
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.PrefixExpression:
+		if err := c.compileExpression(node.Right, false); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		if err := c.compileExpression(node.Left, false); err != nil {
+			return err
+		}
+		if err := c.compileExpression(node.Right, false); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "+":
+			c.emit(code.OpAdd)
+		case "-":
+			c.emit(code.OpSub)
+		case "*":
+			c.emit(code.OpMul)
+		case "/":
+			c.emit(code.OpDiv)
+		case ">":
+			c.emit(code.OpGreaterThan)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "==":
+			c.emit(code.OpEqual)
+		case "!=":
+			c.emit(code.OpNotEqual)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.IfExpression:
+		if err := c.compileExpression(node.Condition, false); err != nil {
+			return err
+		}
+
+		// emit an `OpJumpNotTruthy` with a bogus value
+		jumpNotTruthyPos, err := c.emit(code.OpJumpNotTruthy, 9999)
+		if err != nil {
+			return err
+		}
+
+		if err := c.compileBlock(node.Consequence.Statements, tail); err != nil {
+			return err
+		}
+
+		// emit an `OpJump` with a bogus value
+		jumpPos, err := c.emit(code.OpJump, 9999)
+		if err != nil {
+			return err
+		}
+
+		if err := c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions())); err != nil {
+			return err
+		}
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else {
+			if err := c.compileBlock(node.Alternative.Statements, tail); err != nil {
+				return err
+			}
+		}
+
+		return c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	case *ast.TryExpression:
+		return c.compileTryExpression(node, tail)
+
+	case *ast.Identifier:
+		symbol := c.symbolTable.Resolve(node.Value)
+		if symbol.Scope == GlobalScope {
+			_, err := c.emit(code.OpGetGlobal, symbol.Index)
+			return err
+		}
+		_, err := c.emit(code.OpGetLocal, symbol.Depth, symbol.Index)
+		return err
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+
+	case *ast.MacroLiteral:
+		return fmt.Errorf("macros can only be defined by let statements at the top level")
+
+	case *ast.CallExpression:
+		// calls are located at their function, as the evaluator locates them
+		defer c.setPosition(node.Function)()
+
+		if node.Function.TokenLiteral() == "quote" { // quote is evaluated by the evaluator
+			return c.emitConstant(code.OpQuote, &object.Quote{Node: node})
+		}
+
+		if err := c.compileExpression(node.Function, false); err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			if err := c.compileExpression(a, false); err != nil {
+				return err
+			}
+		}
+
+		if tok, ok := ast.TokenOf(node.Function); ok {
+			c.scopes[c.scopeIndex].callees = append(c.scopes[c.scopeIndex].callees, object.SourcePosition{
+				Offset: len(c.currentInstructions()),
+				Line:   tok.Line,
+				Column: tok.Column,
+			})
+		}
+
+		scope := c.scopes[c.scopeIndex]
+		op := code.OpCall
+		if tail && scope.function && scope.tries == 0 {
+			op = code.OpTailCall
+		}
+		_, err := c.emit(op, len(node.Arguments))
+		return err
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.compileExpression(el, false); err != nil {
+				return err
+			}
+		}
+
+		_, err := c.emit(code.OpArray, len(node.Elements))
+		return err
+
+	case *ast.HashLiteral:
+		// the pairs are compiled in the order of the input
+		keys := ast.SortedKeys(node)
+
+		for _, k := range keys {
+			if err := c.compileExpression(k, false); err != nil {
+				return err
+			}
+			if err := c.compileExpression(node.Pairs[k], false); err != nil {
+				return err
+			}
+		}
+
+		_, err := c.emit(code.OpHash, len(node.Pairs)*2)
+		return err
+
+	case *ast.IndexExpression:
+		if err := c.compileExpression(node.Left, false); err != nil {
+			return err
+		}
+		if err := c.compileExpression(node.Index, false); err != nil {
+			return err
+		}
+
+		c.emit(code.OpIndex)
+
+	case *ast.SliceExpression:
+		if err := c.compileExpression(node.Left, false); err != nil {
+			return err
+		}
+
+		flags := 0
+		if node.Start != nil {
+			if err := c.compileExpression(node.Start, false); err != nil {
+				return err
+			}
+			flags |= code.SliceStart
+		}
+		if node.End != nil {
+			if err := c.compileExpression(node.End, false); err != nil {
+				return err
+			}
+			flags |= code.SliceEnd
+		}
+
+		_, err := c.emit(code.OpSlice, flags)
+		return err
+
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileTryExpression(node *ast.TryExpression, tail bool) error {
+	// emit an `OpTry` with bogus values
+	tryPos, err := c.emit(code.OpTry, 9999, 255)
+	if err != nil {
+		return err
+	}
+
+	c.scopes[c.scopeIndex].tries++
+	if err := c.compileBlock(node.Block.Statements, false); err != nil {
+		return err
+	}
+	c.scopes[c.scopeIndex].tries--
+	c.emit(code.OpEndTry)
+
+	// emit an `OpJump` with a bogus value
+	jumpPos, err := c.emit(code.OpJump, 9999)
+	if err != nil {
+		return err
+	}
+
+	c.symbolTable.EnterBlock()
+	param := c.symbolTable.Define(node.Param.Value)
+	if param.Index > 255 {
+		return fmt.Errorf("too many local bindings")
+	}
+	if err := c.changeOperand(tryPos, len(c.currentInstructions()), param.Index); err != nil {
+		return err
+	}
+
+	if err := c.compileBlock(node.Handler.Statements, tail); err != nil {
+		return err
+	}
+	c.symbolTable.LeaveBlock()
+
+	return c.changeOperand(jumpPos, len(c.currentInstructions()))
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+	declareLets(c.symbolTable, node.Body)
+
+	if err := c.compileBlock(node.Body.Statements, true); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	numLocals := c.symbolTable.numLocals
+	localNames := c.symbolTable.localNames
+	scope := c.leaveScope()
+
+	if numLocals > 256 {
+		return fmt.Errorf("too many local bindings")
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  scope.instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		LocalNames:    localNames,
+		Positions:     scope.positions,
+		Callees:       scope.callees,
+		Literal:       node,
+	}
+
+	return c.emitConstant(code.OpClosure, compiledFn)
+}
+
+// declareLets declares the names bound by let statements in the environment of a function
+func declareLets(s *SymbolTable, node ast.Node) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		if node == nil {
+			return
+		}
+		for _, stmt := range node.Statements {
+			declareLets(s, stmt)
+		}
+	case *ast.LetStatement:
+		if node == nil {
+			return
+		}
+		declareLets(s, node.Value)
+		s.Declare(node.Name.Value)
+	case *ast.ReturnStatement:
+		if node != nil {
+			declareLets(s, node.ReturnValue)
+		}
+	case *ast.ExpressionStatement:
+		if node != nil {
+			declareLets(s, node.Expression)
+		}
+	case *ast.PrefixExpression:
+		if node != nil {
+			declareLets(s, node.Right)
+		}
+	case *ast.InfixExpression:
+		if node != nil {
+			declareLets(s, node.Left)
+			declareLets(s, node.Right)
+		}
+	case *ast.IfExpression:
+		if node != nil {
+			declareLets(s, node.Condition)
+			declareLets(s, node.Consequence)
+			declareLets(s, node.Alternative)
+		}
+	case *ast.TryExpression: // catch blocks have their own environment
+		if node != nil {
+			declareLets(s, node.Block)
+		}
+	case *ast.CallExpression:
+		if node != nil && node.Function.TokenLiteral() != "quote" {
+			declareLets(s, node.Function)
+			for _, arg := range node.Arguments {
+				declareLets(s, arg)
+			}
+		}
+	case *ast.ArrayLiteral:
+		if node != nil {
+			for _, el := range node.Elements {
+				declareLets(s, el)
+			}
+		}
+	case *ast.HashLiteral:
+		if node != nil {
+			for k, v := range node.Pairs {
+				declareLets(s, k)
+				declareLets(s, v)
+			}
+		}
+	case *ast.IndexExpression:
+		if node != nil {
+			declareLets(s, node.Left)
+			declareLets(s, node.Index)
+		}
+	case *ast.SliceExpression:
+		if node != nil {
+			declareLets(s, node.Left)
+			declareLets(s, node.Start)
+			declareLets(s, node.End)
+		}
+	}
+}
+
+// the constants are referred to by operands of two bytes
+const maxConstants = 1 << 16
+
+func (c *Compiler) addConstant(obj object.Object) (int, error) {
+	if len(c.constants) >= maxConstants {
+		return 0, fmt.Errorf("too many constants: maximum %d", maxConstants)
+	}
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1, nil
+}
+
+// emit appends an instruction and returns its position;
+// only instructions with operands can fail, see code.CheckOperands
+func (c *Compiler) emit(op code.Opcode, operands ...int) (int, error) {
+	if err := code.CheckOperands(op, operands...); err != nil {
+		return 0, err
+	}
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+	return pos, nil
+}
+
+// emitConstant adds obj to the constants and emits op referring to it
+func (c *Compiler) emitConstant(op code.Opcode, obj object.Object) error {
+	index, err := c.addConstant(obj)
+	if err != nil {
+		return err
+	}
+	_, err = c.emit(op, index)
+	return err
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	scope := &c.scopes[c.scopeIndex]
+	posNewInstruction := len(scope.instructions)
+
+	n := len(scope.positions)
+	if c.line > 0 && (n == 0 || scope.positions[n-1].Line != c.line || scope.positions[n-1].Column != c.column) {
+		scope.positions = append(scope.positions, object.SourcePosition{
+			Offset: posNewInstruction,
+			Line:   c.line,
+			Column: c.column,
+		})
+	}
+
+	scope.instructions = append(scope.instructions, ins...)
+	return posNewInstruction
+}
+
+// setPosition makes the position of node the current position
+// and returns a function restoring the former one
+func (c *Compiler) setPosition(node ast.Node) func() {
+	line, column := c.line, c.column
+	if tok, ok := ast.TokenOf(node); ok && tok.Line > 0 {
+		c.line, c.column = tok.Line, tok.Column
+	}
+	return func() {
+		c.line, c.column = line, column
+	}
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operands ...int) error {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	if err := code.CheckOperands(op, operands...); err != nil {
+		return err
+	}
+	newInstruction := code.Make(op, operands...)
+
+	c.replaceInstruction(opPos, newInstruction)
+	return nil
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{function: true})
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() CompilationScope {
+	scope := c.scopes[c.scopeIndex]
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return scope
+}
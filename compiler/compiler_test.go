@@ -0,0 +1,362 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "1; 2 < 3",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "let one = 1; one[1:]",
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSlice, code.SliceStart),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "let a = 1;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpNil),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "quote(1 + unquote(2))",
+			expectedConstants: []interface{}{"quote((1 + unquote(2)))"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpQuote, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { let b = a; fn() { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 1, 0),
+					code.Make(code.OpGetLocal, 1, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpClosure, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input: "fn(n) { if (n) { f(n) } else { return g(); } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0, 0),
+					// 0003
+					code.Make(code.OpJumpNotTruthy, 17),
+					// 0006
+					code.Make(code.OpGetGlobal, 0),
+					// 0009
+					code.Make(code.OpGetLocal, 0, 0),
+					// 0012
+					code.Make(code.OpTailCall, 1),
+					// 0014
+					code.Make(code.OpJump, 23),
+					// 0017
+					code.Make(code.OpGetGlobal, 1),
+					// 0020
+					code.Make(code.OpTailCall, 0),
+					// 0022
+					code.Make(code.OpReturnValue),
+					// 0023
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input: "fn() { try { f() } catch (e) { e } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpTry, 13, 0),
+					// 0004
+					code.Make(code.OpGetGlobal, 0),
+					// 0007
+					code.Make(code.OpCall, 0),
+					// 0009
+					code.Make(code.OpEndTry),
+					// 0010
+					code.Make(code.OpJump, 16),
+					// 0013
+					code.Make(code.OpGetLocal, 0, 0),
+					// 0016
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestPositions(t *testing.T) {
+	program := parse("let a = 1;\na + true")
+
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	main := compiler.Bytecode().Main
+
+	// OpAdd is the fifth instruction, at offset 10
+	line, column := object.PositionAt(main.Positions, 10)
+	if line != 2 || column != 3 {
+		t.Errorf("wrong position of OpAdd. want=2:3, got=%d:%d", line, column)
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Main.Instructions)
+		if err != nil {
+			t.Fatalf("testInstructions failed for %q: %s", tt.input, err)
+		}
+
+		err = testConstants(tt.expectedConstants, bytecode.Constants)
+		if err != nil {
+			t.Fatalf("testConstants failed for %q: %s", tt.input, err)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := concatInstructions(expected)
+
+	if len(actual) != len(concatted) {
+		return fmt.Errorf("wrong instructions length.\nwant=%q\ngot =%q",
+			concatted, actual)
+	}
+
+	for i, ins := range concatted {
+		if actual[i] != ins {
+			return fmt.Errorf("wrong instruction at %d.\nwant=%q\ngot =%q",
+				i, concatted, actual)
+		}
+	}
+
+	return nil
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+
+	return out
+}
+
+func testConstants(expected []interface{}, actual []object.Object) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. got=%d, want=%d",
+			len(actual), len(expected))
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				return fmt.Errorf("constant %d - wrong integer. got=%T (%+v)", i, actual[i], actual[i])
+			}
+
+		case string: // the node of a quote
+			quote, ok := actual[i].(*object.Quote)
+			if !ok || quote.Node.String() != constant {
+				return fmt.Errorf("constant %d - wrong quote. got=%T (%+v)", i, actual[i], actual[i])
+			}
+
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+			}
+
+			err := testInstructions(constant, fn.Instructions)
+			if err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func TestDisassemble(t *testing.T) {
+	compiler := New()
+	if err := compiler.Compile(parse("let a = 1;")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	compiler = NewWithState(compiler.symbolTable, compiler.Bytecode().Constants)
+	if err := compiler.Compile(parse(`fn(x) { x + "a" }`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := `main:
+	0000 OpClosure 2
+	0003 OpReturnValue
+constants:
+1: STRING a
+2: COMPILED_FUNCTION fn(x) (x + a)
+	0000 OpGetLocal 0 0
+	0003 OpConstant 1
+	0006 OpAdd
+	0007 OpReturnValue
+`
+
+	if got := compiler.Bytecode().Disassemble(); got != expected {
+		t.Errorf("wrong disassembly.\nwant=%q\ngot =%q", expected, got)
+	}
+}
+
+func TestOperandLimits(t *testing.T) {
+	list := func(element string, n int) string {
+		return strings.Repeat(element+", ", n-1) + element
+	}
+	constants := func(n int) []object.Object {
+		return make([]object.Object, n)
+	}
+
+	tests := []struct {
+		input     string
+		constants []object.Object // of former compilations
+		expected  string          // the error, "" if the input compiles
+	}{
+		{"[" + list("true", 65535) + "]", nil, ""},
+		{"[" + list("true", 65536) + "]", nil, "operand 1 of OpArray out of range: 65536, maximum 65535"},
+		{"1", constants(65535), ""},
+		{"1", constants(65536), "too many constants: maximum 65536"},
+		{"fn() { 1 }", constants(65535), "too many constants: maximum 65536"},
+		{"f(" + list("true", 255) + ")", nil, ""},
+		{"f(" + list("true", 256) + ")", nil, "operand 1 of OpCall out of range: 256, maximum 255"},
+	}
+
+	for _, tt := range tests {
+		compiler := NewWithState(NewSymbolTable(), tt.constants)
+		compiler.symbolTable.DefineGlobal("f")
+		err := compiler.Compile(parse(tt.input))
+
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error for input of length %d: %s", len(tt.input), err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for input of length %d. want=%q, got=%v", len(tt.input), tt.expected, err)
+		}
+	}
+}
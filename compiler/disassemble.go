@@ -0,0 +1,41 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/object"
+	"strings"
+)
+
+// Disassemble lists the instructions of the main function
+// and the constants of this compilation, including compiled functions
+func (b *Bytecode) Disassemble() string {
+	var out bytes.Buffer
+
+	out.WriteString("main:\n")
+	writeInstructions(&out, b.Main)
+
+	if b.FirstConstant == len(b.Constants) {
+		return out.String()
+	}
+
+	out.WriteString("constants:\n")
+	for i := b.FirstConstant; i < len(b.Constants); i++ {
+		switch constant := b.Constants[i].(type) {
+		case *object.CompiledFunction:
+			literal := strings.ReplaceAll(constant.Literal.String(), "\n", " ")
+			fmt.Fprintf(&out, "%d: %s %s\n", i, constant.Type(), literal)
+			writeInstructions(&out, constant)
+		default:
+			fmt.Fprintf(&out, "%d: %s %s\n", i, constant.Type(), constant.Inspect())
+		}
+	}
+
+	return out.String()
+}
+
+func writeInstructions(out *bytes.Buffer, fn *object.CompiledFunction) {
+	for _, line := range strings.Split(strings.TrimSuffix(fn.Instructions.String(), "\n"), "\n") {
+		fmt.Fprintf(out, "\t%s\n", line)
+	}
+}
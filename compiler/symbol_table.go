@@ -0,0 +1,153 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope  SymbolScope = "LOCAL"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Depth int // number of functions between the use and the definition of a local
+	Index int
+}
+
+/*
+A SymbolTable holds the bindings of a function or, if Outer is nil, of the program.
+
+The bindings mirror the environments of the evaluator:
+  - let statements bind names in the environment of the enclosing function,
+    even within blocks of if expressions
+  - catch blocks have their own environment, their bindings are stored
+    in the locals of the enclosing function (or of the program)
+  - names that are not bound at all are globals,
+    which might be bound later or refer to builtins
+
+Since the evaluator looks up names when they are evaluated, a local binding
+is visible to nested functions before its let statement, but not to
+the code of the function itself.
+*/
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store   map[string]Symbol   // globals or the locals of the function
+	defined map[string]bool     // locals already bound at the current position
+	blocks  []map[string]Symbol // bindings of the enclosing catch blocks
+
+	numLocals   int
+	localNames  []string
+	globalNames []string
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{
+		store:   make(map[string]Symbol),
+		defined: make(map[string]bool),
+	}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Declare reserves a local for a name bound by a let statement of the function
+func (s *SymbolTable) Declare(name string) Symbol {
+	if s.Outer == nil {
+		return s.DefineGlobal(name)
+	}
+	if symbol, ok := s.store[name]; ok {
+		return symbol
+	}
+	symbol := Symbol{Name: name, Scope: LocalScope, Index: s.newLocal(name)}
+	s.store[name] = symbol
+	return symbol
+}
+
+// Define binds a name at the current position
+func (s *SymbolTable) Define(name string) Symbol {
+	if len(s.blocks) > 0 {
+		block := s.blocks[len(s.blocks)-1]
+		if symbol, ok := block[name]; ok {
+			return symbol
+		}
+		symbol := Symbol{Name: name, Scope: LocalScope, Index: s.newLocal(name)}
+		block[name] = symbol
+		return symbol
+	}
+
+	symbol := s.Declare(name)
+	s.defined[name] = true
+	return symbol
+}
+
+// DefineGlobal binds a name in the table of the program
+func (s *SymbolTable) DefineGlobal(name string) Symbol {
+	if s.Outer != nil {
+		return s.Outer.DefineGlobal(name)
+	}
+	if symbol, ok := s.store[name]; ok {
+		return symbol
+	}
+	symbol := Symbol{Name: name, Scope: GlobalScope, Index: len(s.globalNames)}
+	s.store[name] = symbol
+	s.globalNames = append(s.globalNames, name)
+	return symbol
+}
+
+// Resolve finds the binding of a name at the current position
+func (s *SymbolTable) Resolve(name string) Symbol {
+	return s.resolve(name, 0)
+}
+
+func (s *SymbolTable) resolve(name string, depth int) Symbol {
+	for i := len(s.blocks) - 1; i >= 0; i-- {
+		if symbol, ok := s.blocks[i][name]; ok {
+			symbol.Depth = depth
+			return symbol
+		}
+	}
+
+	if s.Outer == nil {
+		return s.DefineGlobal(name)
+	}
+
+	if symbol, ok := s.store[name]; ok && (depth > 0 || s.defined[name]) {
+		symbol.Depth = depth
+		return symbol
+	}
+
+	return s.Outer.resolve(name, depth+1)
+}
+
+func (s *SymbolTable) EnterBlock() {
+	s.blocks = append(s.blocks, make(map[string]Symbol))
+}
+
+func (s *SymbolTable) LeaveBlock() {
+	s.blocks = s.blocks[:len(s.blocks)-1]
+}
+
+func (s *SymbolTable) newLocal(name string) int {
+	s.localNames = append(s.localNames, name)
+	s.numLocals++
+	return s.numLocals - 1
+}
+
+// GlobalNames lists the names of the globals by index
+func (s *SymbolTable) GlobalNames() []string {
+	if s.Outer != nil {
+		return s.Outer.GlobalNames()
+	}
+	return s.globalNames
+}
+
+// resetLocals forgets the locals of a program that has been compiled before
+func (s *SymbolTable) resetLocals() {
+	s.blocks = nil
+	s.numLocals = 0
+	s.localNames = nil
+}
@@ -0,0 +1,80 @@
+package compiler
+
+import "testing"
+
+func TestDefineAndResolveGlobals(t *testing.T) {
+	global := NewSymbolTable()
+
+	a := global.Define("a")
+	b := global.Define("b")
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("wrong symbol for a: %+v", a)
+	}
+	if b != (Symbol{Name: "b", Scope: GlobalScope, Index: 1}) {
+		t.Errorf("wrong symbol for b: %+v", b)
+	}
+
+	// a name is bound to the same global again
+	if again := global.Define("a"); again != a {
+		t.Errorf("a rebound to %+v", again)
+	}
+
+	// unbound names are globals
+	if c := global.Resolve("c"); c != (Symbol{Name: "c", Scope: GlobalScope, Index: 2}) {
+		t.Errorf("wrong symbol for c: %+v", c)
+	}
+}
+
+func TestResolveLocals(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("x")
+
+	outer := NewEnclosedSymbolTable(global)
+	outer.Define("a")
+	outer.Declare("x")
+
+	inner := NewEnclosedSymbolTable(outer)
+	inner.Define("b")
+
+	tests := []struct {
+		table    *SymbolTable
+		name     string
+		expected Symbol
+	}{
+		{inner, "b", Symbol{Name: "b", Scope: LocalScope, Depth: 0, Index: 0}},
+		{inner, "a", Symbol{Name: "a", Scope: LocalScope, Depth: 1, Index: 0}},
+		// declared, but not yet defined: visible to nested functions only
+		{inner, "x", Symbol{Name: "x", Scope: LocalScope, Depth: 1, Index: 1}},
+		{outer, "x", Symbol{Name: "x", Scope: GlobalScope, Index: 0}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.table.Resolve(tt.name); got != tt.expected {
+			t.Errorf("wrong symbol for %s. want=%+v, got=%+v", tt.name, tt.expected, got)
+		}
+	}
+
+	outer.Define("x")
+	if got := outer.Resolve("x"); got != (Symbol{Name: "x", Scope: LocalScope, Index: 1}) {
+		t.Errorf("wrong symbol for defined x: %+v", got)
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("e")
+
+	global.EnterBlock()
+	e := global.Define("e")
+	if e != (Symbol{Name: "e", Scope: LocalScope, Index: 0}) {
+		t.Errorf("wrong symbol for e in block: %+v", e)
+	}
+	if got := global.Resolve("e"); got != e {
+		t.Errorf("wrong symbol for e in block: %+v", got)
+	}
+	global.LeaveBlock()
+
+	if got := global.Resolve("e"); got != (Symbol{Name: "e", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("wrong symbol for e after block: %+v", got)
+	}
+}
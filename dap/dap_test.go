@@ -0,0 +1,365 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"monkey/evaluator"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client talks to a server over pipes
+type client struct {
+	t      *testing.T
+	w      io.WriteCloser
+	seq    int
+	msgs   chan map[string]interface{}
+	events []map[string]interface{} // received while waiting for responses
+}
+
+func newClient(t *testing.T) *client {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	go NewServer(serverR, serverW).Serve()
+
+	c := &client{t: t, w: clientW, msgs: make(chan map[string]interface{}, 100)}
+	go func() {
+		r := bufio.NewReader(clientR)
+		for {
+			content, err := readMessage(r)
+			if err != nil {
+				close(c.msgs)
+				return
+			}
+			var msg map[string]interface{}
+			json.Unmarshal(content, &msg)
+			c.msgs <- msg
+		}
+	}()
+	return c
+}
+
+func (c *client) next() map[string]interface{} {
+	select {
+	case msg, ok := <-c.msgs:
+		if !ok {
+			c.t.Fatal("server closed the connection")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("no message from the server")
+	}
+	return nil
+}
+
+// request returns the body of the response, which must be successful
+func (c *client) request(command string, args interface{}) map[string]interface{} {
+	c.seq++
+	seq := c.seq
+	writeMessage(c.w, map[string]interface{}{"seq": seq, "type": "request", "command": command, "arguments": args})
+	for {
+		msg := c.next()
+		if msg["type"] == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if int(msg["request_seq"].(float64)) != seq {
+			continue
+		}
+		if msg["success"] != true {
+			c.t.Fatalf("%s failed: %v", command, msg["message"])
+		}
+		body, _ := msg["body"].(map[string]interface{})
+		return body
+	}
+}
+
+// failing returns the message of the response to a request, which must fail
+func (c *client) failing(command string, args interface{}) string {
+	c.seq++
+	seq := c.seq
+	writeMessage(c.w, map[string]interface{}{"seq": seq, "type": "request", "command": command, "arguments": args})
+	for {
+		msg := c.next()
+		if msg["type"] == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if int(msg["request_seq"].(float64)) != seq {
+			continue
+		}
+		if msg["success"] != false {
+			c.t.Fatalf("%s did not fail", command)
+		}
+		message, _ := msg["message"].(string)
+		return message
+	}
+}
+
+// event returns the body of the next event with the given name
+func (c *client) event(name string) map[string]interface{} {
+	for len(c.events) > 0 {
+		msg := c.events[0]
+		c.events = c.events[1:]
+		if msg["event"] == name {
+			body, _ := msg["body"].(map[string]interface{})
+			return body
+		}
+	}
+	for {
+		msg := c.next()
+		if msg["type"] == "event" && msg["event"] == name {
+			body, _ := msg["body"].(map[string]interface{})
+			return body
+		}
+	}
+}
+
+func (c *client) topFrame() map[string]interface{} {
+	frames := c.request("stackTrace", map[string]interface{}{"threadId": threadId})["stackFrames"].([]interface{})
+	return frames[0].(map[string]interface{})
+}
+
+// locals returns the values of the innermost scope of the top frame
+func (c *client) locals() map[string]string {
+	frame := c.topFrame()
+	scopes := c.request("scopes", map[string]interface{}{"frameId": frame["id"]})["scopes"].([]interface{})
+	ref := scopes[0].(map[string]interface{})["variablesReference"]
+	vars := c.request("variables", map[string]interface{}{"variablesReference": ref})["variables"].([]interface{})
+
+	values := make(map[string]string)
+	for _, v := range vars {
+		v := v.(map[string]interface{})
+		values[v["name"].(string)] = v["value"].(string)
+	}
+	return values
+}
+
+func writeProgram(t *testing.T, src string) string {
+	dir, err := ioutil.TempDir("", "dap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "program.mk")
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBreakpointsAndSteps(t *testing.T) {
+	path := writeProgram(t, `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let x = add(1, 2);
+puts(x);
+`)
+	c := newClient(t)
+	c.request("initialize", map[string]interface{}{"adapterID": "monkey"})
+	c.event("initialized")
+	c.request("launch", map[string]interface{}{"program": path})
+	bps := c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": path},
+		"breakpoints": []map[string]interface{}{{"line": 2}, {"line": 4}},
+	})["breakpoints"].([]interface{})
+	if bps[0].(map[string]interface{})["verified"] != true || bps[1].(map[string]interface{})["verified"] != false {
+		t.Errorf("wrong verification of breakpoints: %v", bps)
+	}
+	c.request("configurationDone", nil)
+
+	if reason := c.event("stopped")["reason"]; reason != "breakpoint" {
+		t.Errorf("expected to stop at the breakpoint, got %v", reason)
+	}
+	frame := c.topFrame()
+	if frame["name"] != "add" || frame["line"] != 2.0 {
+		t.Errorf("wrong top frame: %v", frame)
+	}
+	locals := c.locals()
+	if locals["a"] != "1" || locals["b"] != "2" {
+		t.Errorf("wrong locals: %v", locals)
+	}
+
+	c.request("next", nil)
+	if reason := c.event("stopped")["reason"]; reason != "step" {
+		t.Errorf("expected to stop after the step, got %v", reason)
+	}
+	if frame := c.topFrame(); frame["line"] != 3.0 {
+		t.Errorf("wrong line after step: %v", frame["line"])
+	}
+	if locals := c.locals(); locals["sum"] != "3" {
+		t.Errorf("wrong locals after step: %v", locals)
+	}
+	result := c.request("evaluate", map[string]interface{}{"expression": "sum * 2", "frameId": c.topFrame()["id"]})
+	if result["result"] != "6" {
+		t.Errorf("wrong result of evaluate: %v", result)
+	}
+	if msg := c.failing("evaluate", map[string]interface{}{"expression": "fn(f) { f(f) }(fn(f) { f(f) })"}); !strings.Contains(msg, "step limit exceeded") {
+		t.Errorf("expected the evaluation of a non-terminating expression to exceed the step limit, got %q", msg)
+	}
+	if locals := c.locals(); locals["sum"] != "3" {
+		t.Errorf("wrong locals after a failed evaluation: %v", locals)
+	}
+
+	c.request("stepOut", nil)
+	c.event("stopped")
+	if frame := c.topFrame(); frame["name"] != "program.mk" || frame["line"] != 6.0 {
+		t.Errorf("wrong frame after step out: %v", frame)
+	}
+
+	c.request("continue", nil)
+	if output := c.event("output")["output"]; output != "3\n" {
+		t.Errorf("wrong output: %q", output)
+	}
+	if code := c.event("exited")["exitCode"]; code != 0.0 {
+		t.Errorf("wrong exit code: %v", code)
+	}
+	c.event("terminated")
+	c.request("disconnect", nil)
+	if evaluator.Output != os.Stdout {
+		t.Errorf("the output of puts is not restored after the debug session")
+	}
+}
+
+func TestStopOnEntryAndDisconnect(t *testing.T) {
+	path := writeProgram(t, "let f = fn(x) { f(x + 1) };\nf(0)\n") // does not terminate
+
+	c := newClient(t)
+	c.request("initialize", nil)
+	c.request("launch", map[string]interface{}{"program": path, "stopOnEntry": true})
+	c.request("configurationDone", nil)
+
+	if reason := c.event("stopped")["reason"]; reason != "entry" {
+		t.Errorf("expected to stop on entry, got %v", reason)
+	}
+	if frame := c.topFrame(); frame["line"] != 1.0 {
+		t.Errorf("wrong line on entry: %v", frame["line"])
+	}
+
+	c.request("continue", nil)
+	c.request("pause", nil)
+	if reason := c.event("stopped")["reason"]; reason != "pause" {
+		t.Errorf("expected to pause, got %v", reason)
+	}
+	if locals := c.locals(); locals["x"] == "" {
+		t.Errorf("expected to pause within f, got locals %v", locals)
+	}
+	c.request("disconnect", nil)
+}
+
+func TestLaunchInvalidProgram(t *testing.T) {
+	path := writeProgram(t, "let = 1;")
+
+	c := newClient(t)
+	c.request("initialize", nil)
+	c.seq++
+	writeMessage(c.w, map[string]interface{}{"seq": c.seq, "type": "request", "command": "launch",
+		"arguments": map[string]interface{}{"program": path}})
+	for {
+		msg := c.next()
+		if msg["type"] != "response" || msg["command"] != "launch" {
+			continue
+		}
+		if msg["success"] != false {
+			t.Errorf("expected launch to fail")
+		}
+		break
+	}
+}
+
+func TestStepOverTailCall(t *testing.T) {
+	path := writeProgram(t, `let g = fn() {
+  puts(1)
+};
+let f = fn() {
+  g()
+};
+f();
+puts(2);
+`)
+	c := newClient(t)
+	c.request("initialize", nil)
+	c.request("launch", map[string]interface{}{"program": path})
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": path},
+		"breakpoints": []map[string]interface{}{{"line": 5}},
+	})
+	c.request("configurationDone", nil)
+
+	c.event("stopped")
+	if frame := c.topFrame(); frame["name"] != "f" || frame["line"] != 5.0 {
+		t.Errorf("wrong top frame at the breakpoint: %v", frame)
+	}
+
+	c.request("stepIn", nil)
+	c.event("stopped")
+	frames := c.request("stackTrace", map[string]interface{}{"threadId": threadId})["stackFrames"].([]interface{})
+	if len(frames) != 2 {
+		t.Errorf("expected g to take over the frame of f, got %v", frames)
+	}
+	if frame := frames[0].(map[string]interface{}); frame["name"] != "g" || frame["line"] != 2.0 {
+		t.Errorf("wrong top frame within the tail call: %v", frame)
+	}
+	c.request("continue", nil)
+	c.event("terminated")
+	c.request("disconnect", nil)
+
+	c = newClient(t)
+	c.request("initialize", nil)
+	c.request("launch", map[string]interface{}{"program": path})
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": path},
+		"breakpoints": []map[string]interface{}{{"line": 5}},
+	})
+	c.request("configurationDone", nil)
+
+	c.event("stopped")
+	c.request("next", nil)
+	c.event("stopped")
+	if frame := c.topFrame(); frame["name"] != "program.mk" || frame["line"] != 8.0 {
+		t.Errorf("expected to step over the tail call, got %v", frame)
+	}
+	c.request("continue", nil)
+	c.event("terminated")
+	c.request("disconnect", nil)
+}
+
+func TestStepOverBuiltinCall(t *testing.T) {
+	path := writeProgram(t, `let g = fn() {
+  2
+};
+len(if (true) {
+  "a"
+} else { "" }) + g();
+puts(3);
+`)
+	c := newClient(t)
+	c.request("initialize", nil)
+	c.request("launch", map[string]interface{}{"program": path})
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": path},
+		"breakpoints": []map[string]interface{}{{"line": 5}},
+	})
+	c.request("configurationDone", nil)
+
+	c.event("stopped")
+	frames := c.request("stackTrace", map[string]interface{}{"threadId": threadId})["stackFrames"].([]interface{})
+	if len(frames) != 1 || frames[0].(map[string]interface{})["name"] != "program.mk" {
+		t.Errorf("expected no frame for the builtin len, got %v", frames)
+	}
+
+	c.request("next", nil)
+	c.event("stopped")
+	if frame := c.topFrame(); frame["name"] != "program.mk" || frame["line"] != 7.0 {
+		t.Errorf("expected to step over the line, got %v", frame)
+	}
+	c.request("continue", nil)
+	c.event("terminated")
+	c.request("disconnect", nil)
+}
@@ -0,0 +1,193 @@
+package dap
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"sync"
+)
+
+// the evaluation stops before statements, except blocks, as debuggers stop at lines
+type stepMode int
+
+const (
+	stepContinue stepMode = iota // to the next breakpoint
+	stepIn                       // to the next statement
+	stepOver                     // to the next statement in the same or an outer frame
+	stepOut                      // to the next statement in an outer frame
+	stepPause                    // to the next statement, as requested while running
+)
+
+// frame is a function call; the outermost frame is the program
+type frame struct {
+	name   string
+	line   int // of the current statement, 0 before the first one
+	column int
+	env    *object.Environment
+}
+
+// debugger is consulted by the evaluator, which runs in its own goroutine;
+// while the evaluation is stopped, the server inspects the frames
+type debugger struct {
+	mu          sync.Mutex
+	frames      []*frame
+	breakpoints map[int]bool // lines of the program
+	mode        stepMode
+	depth       int // number of frames when the last step was requested
+	stopped     bool
+	aborted     bool
+	refs        []interface{} // environments and objects referenced by variablesReference-1
+
+	stops  func(reason string) // announces a stop
+	resume chan stepMode
+}
+
+func newDebugger(name string, stopOnEntry bool, stops func(reason string)) *debugger {
+	d := &debugger{
+		frames:      []*frame{{name: name}},
+		breakpoints: make(map[int]bool),
+		mode:        stepContinue,
+		stops:       stops,
+		resume:      make(chan stepMode),
+	}
+	if stopOnEntry {
+		d.mode = stepIn
+	}
+	return d
+}
+
+func (d *debugger) Call(node ast.Node, env *object.Environment, depth int) {
+	if _, ok := node.(ast.Statement); !ok {
+		return
+	}
+	if _, ok := node.(*ast.BlockStatement); ok {
+		return
+	}
+	tok, ok := ast.TokenOf(node)
+	if !ok {
+		return
+	}
+
+	d.mu.Lock()
+	top := d.frames[len(d.frames)-1]
+	newLine := top.line != tok.Line
+	top.line, top.column, top.env = tok.Line, tok.Column, env
+	reason := d.stopReason(tok.Line, newLine)
+	if reason != "" {
+		d.stopped = true
+	}
+	d.mu.Unlock()
+
+	if reason != "" {
+		d.stop(reason)
+	}
+}
+
+func (d *debugger) Exit(node ast.Node, env *object.Environment, depth int, val object.Object) {}
+
+// frames are only entered by functions with a body, not by builtins
+func (d *debugger) Enter(fn *object.Function, env *object.Environment, tail bool) {
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.frames = append(d.frames, &frame{name: name, env: env})
+	// stepping over the frame taken over by a tail call steps over the tail call as well
+	if tail && d.mode == stepOver && len(d.frames) == d.depth {
+		d.depth--
+	}
+}
+
+func (d *debugger) Leave(fn *object.Function) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.frames = d.frames[:len(d.frames)-1]
+}
+
+// stopReason returns why the evaluation stops at a statement on line, or "" if it does not;
+// a breakpoint is only hit when its line is entered
+func (d *debugger) stopReason(line int, newLine bool) string {
+	if d.aborted {
+		return ""
+	}
+	switch {
+	case d.mode == stepPause:
+		return "pause"
+	case d.mode == stepIn,
+		d.mode == stepOver && len(d.frames) <= d.depth,
+		d.mode == stepOut && len(d.frames) < d.depth:
+		if d.depth == 0 {
+			return "entry"
+		}
+		return "step"
+	case d.breakpoints[line] && newLine:
+		return "breakpoint"
+	}
+	return ""
+}
+
+// stop waits until the evaluation is resumed
+func (d *debugger) stop(reason string) {
+	d.stops(reason)
+	mode := <-d.resume
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = false
+	d.mode = mode
+	d.depth = len(d.frames)
+	d.refs = nil
+}
+
+// continueWith resumes a stopped evaluation; it reports whether the evaluation was stopped
+func (d *debugger) continueWith(mode stepMode) bool {
+	d.mu.Lock()
+	stopped := d.stopped
+	if !stopped && mode == stepPause {
+		d.mode = stepPause
+	}
+	d.mu.Unlock()
+
+	if stopped && mode != stepPause {
+		d.resume <- mode
+	}
+	return stopped
+}
+
+// abort ends the evaluation, wherever it is
+func (d *debugger) abort() {
+	d.mu.Lock()
+	d.aborted = true
+	stopped := d.stopped
+	d.mu.Unlock()
+
+	evaluator.Interrupt()
+	if stopped {
+		d.resume <- stepContinue
+	}
+}
+
+func (d *debugger) setBreakpoints(lines []int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints = make(map[int]bool)
+	for _, line := range lines {
+		d.breakpoints[line] = true
+	}
+}
+
+// frame returns the frame with the given id, the outermost frame having id 1
+func (d *debugger) frame(id int) (*frame, bool) {
+	if id < 1 || id > len(d.frames) {
+		return nil, false
+	}
+	return d.frames[id-1], true
+}
+
+// ref returns a variablesReference for an environment or an object
+func (d *debugger) ref(i interface{}) int {
+	d.refs = append(d.refs, i)
+	return len(d.refs)
+}
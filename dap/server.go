@@ -0,0 +1,450 @@
+// Package dap implements a server of the Debug Adapter Protocol, so that Monkey
+// programs can be debugged from editors. The program is evaluated by the evaluator,
+// which consults the server at each call and exit, see evaluator.EvalD.
+// There is a single thread; the stack frames are the function calls.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const threadId = 1
+
+// evaluateSteps bounds the evaluation of expressions, e.g. of watches, while the program is stopped
+const evaluateSteps = 100000
+
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+	mu  sync.Mutex // guards out and seq
+	seq int
+
+	program     string // path of the launched program
+	node        *ast.Program
+	lines       map[int]bool     // lines on which statements start
+	breakpoints map[string][]int // by path, as set before the launch
+	configured  bool             // configurationDone has been received
+	started     bool
+	debugger    *debugger
+	done        chan struct{} // closed when the evaluation has ended
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:          bufio.NewReader(in),
+		out:         out,
+		breakpoints: make(map[string][]int),
+	}
+}
+
+// Serve answers requests until the client disconnects or the input ends
+func (s *Server) Serve() error {
+	for {
+		content, err := readMessage(s.in)
+		if err == io.EOF {
+			s.abort()
+			return nil
+		}
+		if err != nil {
+			s.abort()
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+		if !s.handle(req) {
+			return nil
+		}
+	}
+}
+
+// handle answers a request; it reports whether further requests are to be served
+func (s *Server) handle(req request) bool {
+	switch req.Command {
+	case "initialize":
+		s.respond(req, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+		})
+		s.event("initialized", nil)
+	case "launch":
+		var args launchArguments
+		if err := s.decode(req, &args); err == nil {
+			s.launch(req, args)
+		}
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := s.decode(req, &args); err == nil {
+			s.setBreakpoints(req, args)
+		}
+	case "configurationDone":
+		s.configured = true
+		s.respond(req, nil)
+		s.start()
+	case "threads":
+		s.respond(req, map[string]interface{}{"threads": []thread{{Id: threadId, Name: "main"}}})
+	case "stackTrace":
+		s.stackTrace(req)
+	case "scopes":
+		var args frameArguments
+		if err := s.decode(req, &args); err == nil {
+			s.scopes(req, args)
+		}
+	case "variables":
+		var args variablesArguments
+		if err := s.decode(req, &args); err == nil {
+			s.variables(req, args)
+		}
+	case "evaluate":
+		var args evaluateArguments
+		if err := s.decode(req, &args); err == nil {
+			s.evaluate(req, args)
+		}
+	case "continue":
+		s.resume(req, stepContinue, map[string]interface{}{"allThreadsContinued": true})
+	case "next":
+		s.resume(req, stepOver, nil)
+	case "stepIn":
+		s.resume(req, stepIn, nil)
+	case "stepOut":
+		s.resume(req, stepOut, nil)
+	case "pause":
+		s.resume(req, stepPause, nil)
+	case "disconnect", "terminate":
+		s.abort()
+		s.respond(req, nil)
+		return req.Command != "disconnect"
+	default:
+		s.fail(req, "unsupported request "+req.Command)
+	}
+	return true
+}
+
+// messages
+
+func (s *Server) send(msg interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	switch msg := msg.(type) {
+	case *response:
+		msg.Seq = s.seq
+	case *event:
+		msg.Seq = s.seq
+	}
+	writeMessage(s.out, msg)
+}
+
+func (s *Server) respond(req request, body interface{}) {
+	s.send(&response{Type: "response", RequestSeq: req.Seq, Success: true, Command: req.Command, Body: body})
+}
+
+func (s *Server) fail(req request, message string) {
+	s.send(&response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Message: message})
+}
+
+func (s *Server) event(name string, body interface{}) {
+	s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+func (s *Server) decode(req request, args interface{}) error {
+	if len(req.Arguments) == 0 {
+		return nil
+	}
+	err := json.Unmarshal(req.Arguments, args)
+	if err != nil {
+		s.fail(req, err.Error())
+	}
+	return err
+}
+
+// output is written to the client, e.g. by puts
+type output struct {
+	s        *Server
+	category string
+}
+
+func (o output) Write(p []byte) (int, error) {
+	o.s.event("output", map[string]interface{}{"category": o.category, "output": string(p)})
+	return len(p), nil
+}
+
+// launching
+
+func (s *Server) launch(req request, args launchArguments) {
+	if s.debugger != nil {
+		s.fail(req, "a program has already been launched")
+		return
+	}
+	src, err := ioutil.ReadFile(args.Program)
+	if err != nil {
+		s.fail(req, err.Error())
+		return
+	}
+	p := parser.New(lexer.New(string(src)))
+	node := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		msgs := []string{}
+		for _, err := range p.Errors() {
+			msgs = append(msgs, err.Position()+": "+err.Error())
+		}
+		s.fail(req, fmt.Sprintf("%s cannot be parsed:\n\t%s", args.Program, strings.Join(msgs, "\n\t")))
+		return
+	}
+
+	s.program = filepath.Clean(args.Program)
+	s.node = node
+	s.lines = statementLines(node)
+	s.debugger = newDebugger(filepath.Base(s.program), args.StopOnEntry, func(reason string) {
+		s.event("stopped", map[string]interface{}{"reason": reason, "threadId": threadId, "allThreadsStopped": true})
+	})
+	s.debugger.setBreakpoints(s.breakpoints[s.program])
+	s.respond(req, nil)
+	s.start()
+}
+
+// start evaluates the program once it has been launched and configured
+func (s *Server) start() {
+	if s.started || s.debugger == nil || !s.configured {
+		return
+	}
+	s.started = true
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		previous := evaluator.Output
+		evaluator.Output = output{s, "stdout"}
+		defer func() { evaluator.Output = previous }() // later evaluations do not print to the client
+		obj := evaluator.EvalD(s.node, object.NewEnvironment(), s.debugger)
+
+		exitCode := 0
+		if err, ok := obj.(*object.Error); ok {
+			output{s, "stderr"}.Write([]byte(err.Inspect() + "\n" + err.StackTrace()))
+			exitCode = 1
+		}
+		s.event("exited", map[string]interface{}{"exitCode": exitCode})
+		s.event("terminated", nil)
+	}()
+}
+
+// abort ends a running evaluation and waits for it
+func (s *Server) abort() {
+	if !s.started {
+		return
+	}
+	s.debugger.abort()
+	<-s.done
+}
+
+// statementLines returns the lines the evaluation may stop at
+func statementLines(node ast.Node) map[int]bool {
+	lines := make(map[int]bool)
+	ast.Inspect(node, func(node ast.Node) bool {
+		if _, ok := node.(ast.Statement); ok {
+			if _, ok := node.(*ast.BlockStatement); !ok {
+				if tok, ok := ast.TokenOf(node); ok {
+					lines[tok.Line] = true
+				}
+			}
+		}
+		return true
+	})
+	return lines
+}
+
+func (s *Server) setBreakpoints(req request, args setBreakpointsArguments) {
+	path := filepath.Clean(args.Source.Path)
+	lines := []int{}
+	result := []breakpoint{}
+	for _, bp := range args.Breakpoints {
+		lines = append(lines, bp.Line)
+		verified := s.lines == nil || path != s.program || s.lines[bp.Line] // unknown before the launch
+		result = append(result, breakpoint{Verified: verified, Line: bp.Line})
+	}
+	s.breakpoints[path] = lines
+	if s.debugger != nil && path == s.program {
+		s.debugger.setBreakpoints(lines)
+	}
+	s.respond(req, map[string]interface{}{"breakpoints": result})
+}
+
+// execution
+
+func (s *Server) resume(req request, mode stepMode, body interface{}) {
+	if s.debugger == nil {
+		s.fail(req, "no program has been launched")
+		return
+	}
+	s.respond(req, body) // before the evaluation may stop again
+	s.debugger.continueWith(mode)
+}
+
+// inspection, while stopped
+
+// stopped locks the debugger if the evaluation is stopped
+func (s *Server) stopped(req request) bool {
+	if s.debugger == nil {
+		s.fail(req, "no program has been launched")
+		return false
+	}
+	s.debugger.mu.Lock()
+	if !s.debugger.stopped {
+		s.debugger.mu.Unlock()
+		s.fail(req, "the program is running")
+		return false
+	}
+	return true
+}
+
+func (s *Server) stackTrace(req request) {
+	if !s.stopped(req) {
+		return
+	}
+	defer s.debugger.mu.Unlock()
+
+	frames := []stackFrame{}
+	for id := len(s.debugger.frames); id > 0; id-- {
+		f, _ := s.debugger.frame(id)
+		frames = append(frames, stackFrame{
+			Id:     id,
+			Name:   f.name,
+			Source: source{Name: filepath.Base(s.program), Path: s.program},
+			Line:   f.line,
+			Column: f.column,
+		})
+	}
+	s.respond(req, map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)})
+}
+
+func (s *Server) scopes(req request, args frameArguments) {
+	if !s.stopped(req) {
+		return
+	}
+	defer s.debugger.mu.Unlock()
+
+	f, ok := s.debugger.frame(args.FrameId)
+	if !ok {
+		s.fail(req, fmt.Sprintf("unknown frame %d", args.FrameId))
+		return
+	}
+	scopes := []scope{}
+	for env := f.env; env != nil; env = env.Outer {
+		name := "Closure"
+		if env == f.env {
+			name = "Locals"
+		}
+		if env.Outer == nil {
+			name = "Globals"
+		}
+		scopes = append(scopes, scope{Name: name, VariablesReference: s.debugger.ref(env)})
+	}
+	s.respond(req, map[string]interface{}{"scopes": scopes})
+}
+
+func (s *Server) variables(req request, args variablesArguments) {
+	if !s.stopped(req) {
+		return
+	}
+	defer s.debugger.mu.Unlock()
+
+	if args.VariablesReference < 1 || args.VariablesReference > len(s.debugger.refs) {
+		s.fail(req, fmt.Sprintf("unknown variablesReference %d", args.VariablesReference))
+		return
+	}
+	vars := []variable{}
+	switch ref := s.debugger.refs[args.VariablesReference-1].(type) {
+	case *object.Environment:
+		names := make([]string, 0, len(ref.Store))
+		for name := range ref.Store {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			vars = append(vars, s.variable(name, ref.Store[name]))
+		}
+	case *object.Array:
+		for i, element := range ref.Elements {
+			vars = append(vars, s.variable(fmt.Sprintf("[%d]", i), element))
+		}
+	case *object.Hash:
+		pairs := make([]object.HashPair, 0, len(ref.Pairs))
+		for _, pair := range ref.Pairs {
+			pairs = append(pairs, pair)
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key.Inspect() < pairs[j].Key.Inspect() })
+		for _, pair := range pairs {
+			vars = append(vars, s.variable(pair.Key.Inspect(), pair.Value))
+		}
+	}
+	s.respond(req, map[string]interface{}{"variables": vars})
+}
+
+// variable describes obj; arrays and hashes can be expanded
+func (s *Server) variable(name string, obj object.Object) variable {
+	v := variable{Name: name, Value: "nil"}
+	if obj == nil {
+		return v
+	}
+	v.Value = strings.ReplaceAll(obj.Inspect(), "\n", " ")
+	v.Type = string(obj.Type())
+	switch obj := obj.(type) {
+	case *object.Array:
+		if len(obj.Elements) != 0 {
+			v.VariablesReference = s.debugger.ref(obj)
+		}
+	case *object.Hash:
+		if len(obj.Pairs) != 0 {
+			v.VariablesReference = s.debugger.ref(obj)
+		}
+	}
+	return v
+}
+
+// evaluate evaluates an expression in the environment of a frame,
+// enclosed so that the environment is not changed
+func (s *Server) evaluate(req request, args evaluateArguments) {
+	if !s.stopped(req) {
+		return
+	}
+	defer s.debugger.mu.Unlock()
+
+	f, ok := s.debugger.frame(args.FrameId)
+	if !ok {
+		f = s.debugger.frames[len(s.debugger.frames)-1]
+	}
+	p := parser.New(lexer.New(args.Expression))
+	node := p.ParseExpression()
+	if len(p.Errors()) != 0 {
+		s.fail(req, p.Errors()[0].Error())
+		return
+	}
+	env := f.env
+	if env == nil {
+		env = object.NewEnvironment()
+	}
+	val := evaluator.EvalLimited(node, object.NewEnclosedEnvironment(env), evaluator.Limits{MaxSteps: evaluateSteps})
+	if err, ok := val.(*object.Error); ok {
+		s.fail(req, err.Message)
+		return
+	}
+	v := s.variable("", val)
+	s.respond(req, map[string]interface{}{"result": v.Value, "type": v.Type, "variablesReference": v.VariablesReference})
+}
@@ -2,10 +2,33 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
 	"monkey/object"
+	"os"
 )
 
+// Output receives what puts prints; e.g. debuggers that use the standard output redirect it
+var Output io.Writer = os.Stdout
+
+var throw = &object.Builtin{
+	Fn: func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1",
+				len(args))
+		}
+
+		message := args[0].Inspect()
+		if str, ok := args[0].(*object.String); ok {
+			message = str.Value
+		}
+
+		return &object.Error{Message: message, Value: args[0]}
+	},
+}
+
 var builtins = map[string]*object.Builtin{
+	"throw": throw,
+	"error": throw,
 	"len": &object.Builtin{Fn: func(args ...object.Object) object.Object {
 		if len(args) != 1 {
 			return newError("wrong number of arguments. got=%d, want=1",
@@ -26,7 +49,7 @@ var builtins = map[string]*object.Builtin{
 	"puts": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				fmt.Fprintln(Output, arg.Inspect())
 			}
 
 			return NULL
@@ -0,0 +1,27 @@
+package evaluator_test
+
+import (
+	"fmt"
+	"monkey/evaluator"
+	"monkey/vm"
+	"os"
+	"testing"
+)
+
+// The inputs of testEval are evaluated by the virtual machine as well;
+// differing results make the tests of the package fail.
+func TestMain(m *testing.M) {
+	evaluator.Engines["vm"] = vm.Eval
+
+	code := m.Run()
+
+	if len(evaluator.EngineMismatches) > 0 {
+		fmt.Println("--- FAIL: engines differ")
+		for _, mismatch := range evaluator.EngineMismatches {
+			fmt.Println("    " + mismatch)
+		}
+		code = 1
+	}
+
+	os.Exit(code)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/object"
+	"reflect"
 )
 
 var (
@@ -12,28 +13,38 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
-var t *tracer = newTracer()
-
 func EvalT(node ast.Node, env *object.Environment, trace_required bool) (object.Object, *Trace) {
-
+	ResetInterrupt()
+	defer ResetInterrupt()
+	e := newEvaluation(limits)
 	if trace_required {
-		startTracer()
-		defer stopTracer()
-	} else {
-		t.active = false //??
+		e.tracer = newTracer()
 	}
 
-	obj := Eval(node, env)
+	var obj object.Object
+	e.run(func() {
+		obj = Eval(node, env)
+	})
 
 	if trace_required {
-		return obj, t.getTrace()
+		return obj, e.tracer.getTrace()
 	}
 	return obj, nil
 }
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
 	depth := traceCall(node, env)
-	val := eval(node, env)
+	debugCall(node, env)
+	var val object.Object
+	if err := step(); err != nil {
+		val = err
+	} else {
+		val = eval(node, env)
+	}
+	if err, ok := val.(*object.Error); ok && err.Line == 0 {
+		locateError(err, node)
+	}
+	debugExit(node, env, val)
 	traceExit(depth, node, env, val)
 	return val
 }
@@ -63,7 +74,13 @@ func eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if rv, ok := val.(*object.ReturnValue); ok { // as the virtual machine does, return from the function
+			return rv
+		}
+		if fn, ok := val.(*object.Function); ok && fn.Name == "" {
+			fn.Name = node.Name.Value
+		}
+		setBinding(env, node.Name.Value, val)
 
 	// Expressions
 	case *ast.IntegerLiteral:
@@ -107,6 +124,10 @@ func eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.Function{Parameters: params, Env: env, Body: body}
 
 	case *ast.CallExpression:
+		if isQuoteCall(node) {
+			return evalQuoteCall(node, env)
+		}
+
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
@@ -117,7 +138,11 @@ func eval(node ast.Node, env *object.Environment) object.Object {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		// a tail call with too few arguments fails in the frame of the caller, as in the virtual machine
+		if f, ok := function.(*object.Function); ok && isTailCall(node) && len(args) >= len(f.Parameters) {
+			return &object.TailCall{Function: function, Arguments: args, Call: node}
+		}
+		return applyFunction(function, args, node)
 
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
@@ -137,9 +162,18 @@ func eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return evalIndexExpression(left, index)
 
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
+	case *ast.MacroLiteral:
+		return newError("macros can only be defined by let statements at the top level")
+
 	}
 
 	return nil
@@ -210,9 +244,9 @@ func evalInfixExpression(
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(object.Equal(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
@@ -278,14 +312,24 @@ func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	if operator != "+" {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
 		return newError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
-
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
 }
 
 func evalIfExpression(
@@ -306,6 +350,32 @@ func evalIfExpression(
 	}
 }
 
+func evalTryExpression(
+	te *ast.TryExpression,
+	env *object.Environment,
+) object.Object {
+	result := Eval(te.Block, env)
+
+	err, ok := result.(*object.Error)
+	if !ok {
+		return result
+	}
+
+	handlerEnv := object.NewEnclosedEnvironment(env)
+	setBinding(handlerEnv, te.Param.Value, caughtValue(err))
+
+	return Eval(te.Handler, handlerEnv)
+}
+
+// caughtValue is the value a catch parameter is bound to:
+// the thrown value or, for runtime errors, the error message
+func caughtValue(err *object.Error) object.Object {
+	if err.Value != nil {
+		return err.Value
+	}
+	return &object.String{Value: err.Message}
+}
+
 func evalIdentifier(
 	node *ast.Identifier,
 	env *object.Environment,
@@ -362,19 +432,44 @@ func evalExpressions(
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
-	switch fn := fn.(type) {
+// tail calls resulting from the function body are applied in a loop
+func applyFunction(fn object.Object, args []object.Object, call *ast.CallExpression) object.Object {
+	tail := false
+	for {
+		switch f := fn.(type) {
 
-	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		case *object.Function:
+			if err := checkDepth(); err != nil {
+				return err
+			}
+			if len(args) < len(f.Parameters) { // as checked by the virtual machine
+				return newError("wrong number of arguments: want=%d, got=%d", len(f.Parameters), len(args))
+			}
+			markTailCalls(f.Body)
+			extendedEnv := extendFunctionEnv(f, args)
+			pushFrame(f, call, extendedEnv)
+			debugEnter(f, extendedEnv, tail)
+			evaluated := Eval(f.Body, extendedEnv)
+			debugLeave(f)
+			popFrame()
+			evaluated = unwrapReturnValue(evaluated)
+
+			if tc, ok := evaluated.(*object.TailCall); ok {
+				fn, args = tc.Function, tc.Arguments // the tail call takes over the frame, called from where it was
+				tail = true
+				continue
+			}
+			return evaluated
 
-	case *object.Builtin:
-		return fn.Fn(args...)
+		case *object.Builtin:
+			return f.Fn(args...)
 
-	default:
-		return newError("not a function: %s", fn.Type())
+		default:
+			if apply, ok := appliers[reflect.TypeOf(fn)]; ok {
+				return addCallerFrames(apply(fn, args), call)
+			}
+			return newError("not a function: %s", fn.Type())
+		}
 	}
 }
 
@@ -385,7 +480,7 @@ func extendFunctionEnv(
 	env := object.NewEnclosedEnvironment(fn.Env)
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		setBinding(env, param.Value, args[paramIdx])
 	}
 
 	return env
@@ -403,6 +498,8 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -412,16 +509,120 @@ func evalIndexExpression(left, index object.Object) object.Object {
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
-
-	if idx < 0 || idx > max {
+	idx, ok := normalizeIndex(index.(*object.Integer).Value, len(arrayObject.Elements))
+	if !ok {
 		return NULL
 	}
 
 	return arrayObject.Elements[idx]
 }
 
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	value := str.(*object.String).Value
+	idx, ok := normalizeIndex(index.(*object.Integer).Value, len(value))
+	if !ok {
+		return NULL
+	}
+
+	return &object.String{Value: value[idx : idx+1]}
+}
+
+// normalizeIndex resolves negative indexes relative to the end of a sequence
+// of the given length, i.e. -1 is the last element.
+func normalizeIndex(idx int64, length int) (int64, bool) {
+	if idx < 0 {
+		idx += int64(length)
+	}
+	if idx < 0 || idx >= int64(length) {
+		return 0, false
+	}
+	return idx, true
+}
+
+func evalSliceExpression(
+	node *ast.SliceExpression,
+	env *object.Environment,
+) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	var start, end object.Object
+	if node.Start != nil {
+		start = Eval(node.Start, env)
+		if isError(start) {
+			return start
+		}
+	}
+	if node.End != nil {
+		end = Eval(node.End, env)
+		if isError(end) {
+			return end
+		}
+	}
+
+	return sliceObject(left, start, end)
+}
+
+// sliceObject slices arrays and strings Python-style;
+// start and end are nil if they have been omitted.
+func sliceObject(left, start, end object.Object) object.Object {
+	var length int
+	switch left := left.(type) {
+	case *object.Array:
+		length = len(left.Elements)
+	case *object.String:
+		length = len(left.Value)
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+
+	from, err := sliceBound(start, 0, length)
+	if err != nil {
+		return err
+	}
+	to, err := sliceBound(end, length, length)
+	if err != nil {
+		return err
+	}
+	if to < from {
+		to = from
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		elements := make([]object.Object, to-from)
+		copy(elements, left.Elements[from:to])
+		return &object.Array{Elements: elements}
+	default:
+		return &object.String{Value: left.(*object.String).Value[from:to]}
+	}
+}
+
+// sliceBound resolves a slice bound to a position between 0 and length
+func sliceBound(bound object.Object, def int, length int) (int, *object.Error) {
+	if bound == nil {
+		return def, nil
+	}
+	integer, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, newError("slice bound must be INTEGER, got %s", bound.Type())
+	}
+
+	idx := integer.Value
+	if idx < 0 {
+		idx += int64(length)
+	}
+	if idx < 0 {
+		return 0, nil
+	}
+	if idx > int64(length) {
+		return length, nil
+	}
+	return int(idx), nil
+}
+
 func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
@@ -434,10 +635,10 @@ func evalHashLiteral(
 			return key
 		}
 
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
+		if !object.IsHashable(key) {
 			return newError("unusable as hash key: %s", key.Type())
 		}
+		hashKey := key.(object.Hashable)
 
 		value := Eval(valueNode, env)
 		if isError(value) {
@@ -454,10 +655,10 @@ func evalHashLiteral(
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
-	if !ok {
+	if !object.IsHashable(index) {
 		return newError("unusable as hash key: %s", index.Type())
 	}
+	key := index.(object.Hashable)
 
 	pair, ok := hashObject.Pairs[key.HashKey()]
 	if !ok {
@@ -0,0 +1,75 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// Debugger is consulted by Eval at the call and the exit of each node; the evaluation
+// is suspended until it returns. Unlike the tracer, nothing is recorded.
+// The depths of a call and its exit are the same. A tail call exits with an
+// object.TailCall before it is applied; its function is applied in the frame of the caller.
+type Debugger interface {
+	Call(node ast.Node, env *object.Environment, depth int)
+	Exit(node ast.Node, env *object.Environment, depth int, val object.Object)
+}
+
+// A FrameDebugger is told as well when the body of a function is entered and left,
+// env being the environment of the body; builtins have no body. A tail call enters
+// with tail set after the frame it takes over has been left.
+type FrameDebugger interface {
+	Debugger
+	Enter(fn *object.Function, env *object.Environment, tail bool)
+	Leave(fn *object.Function)
+}
+
+// EvalD evaluates node consulting d; d may abort the evaluation by Interrupt.
+// The timeout does not apply, since the time spent in d would count.
+func EvalD(node ast.Node, env *object.Environment, d Debugger) object.Object {
+	ResetInterrupt()
+	defer ResetInterrupt()
+	e := newEvaluation(Limits{MaxSteps: limits.MaxSteps, MaxDepth: limits.MaxDepth})
+	e.debugger = d
+
+	var obj object.Object
+	e.run(func() {
+		obj = Eval(node, env)
+	})
+	return obj
+}
+
+func debugCall(node ast.Node, env *object.Environment) {
+	e := current
+	if e.debugger == nil {
+		return
+	}
+	d := e.debugger
+	e.debugger = nil // evaluations by the debugger itself, e.g. of watches, are not debugged
+	d.Call(node, env, e.debugDepth)
+	e.debugger = d
+	e.debugDepth++
+}
+
+func debugExit(node ast.Node, env *object.Environment, val object.Object) {
+	e := current
+	if e.debugger == nil {
+		return
+	}
+	e.debugDepth--
+	d := e.debugger
+	e.debugger = nil
+	d.Exit(node, env, e.debugDepth, val)
+	e.debugger = d
+}
+
+func debugEnter(fn *object.Function, env *object.Environment, tail bool) {
+	if d, ok := current.debugger.(FrameDebugger); ok {
+		d.Enter(fn, env, tail)
+	}
+}
+
+func debugLeave(fn *object.Function) {
+	if d, ok := current.debugger.(FrameDebugger); ok {
+		d.Leave(fn)
+	}
+}
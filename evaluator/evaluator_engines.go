@@ -0,0 +1,81 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"reflect"
+	"sort"
+)
+
+/*
+Other engines, e.g. the virtual machine of package vm, share the semantics
+of operators, builtins and errors with the evaluator by the following functions.
+
+Functions created by another engine are applied by that engine:
+it registers an applier for its function type.
+*/
+
+type Applier func(fn object.Object, args []object.Object) object.Object
+
+var appliers = make(map[reflect.Type]Applier)
+
+// RegisterApplier registers how to apply functions of the Go type of fn
+func RegisterApplier(fn object.Object, apply Applier) {
+	appliers[reflect.TypeOf(fn)] = apply
+}
+
+// ApplyFunction applies a function created by any engine
+func ApplyFunction(fn object.Object, args []object.Object) object.Object {
+	return applyFunction(fn, args, nil)
+}
+
+func EvalPrefixExpression(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+func EvalInfixExpression(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+func EvalIndexExpression(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// SliceObject slices arrays and strings; start and end are nil if they have been omitted
+func SliceObject(left, start, end object.Object) object.Object {
+	return sliceObject(left, start, end)
+}
+
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// CaughtValue is the value a catch parameter is bound to
+func CaughtValue(err *object.Error) object.Object {
+	return caughtValue(err)
+}
+
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+// BuiltinNames returns the names of the builtins in alphabetical order
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func NewError(format string, a ...interface{}) *object.Error {
+	return newError(format, a...)
+}
+
+// EvalQuoteCall evaluates a call to quote; env holds the bindings
+// the arguments of unquote are evaluated with.
+func EvalQuoteCall(call *ast.CallExpression, env *object.Environment) object.Object {
+	return evalQuoteCall(call, env)
+}
@@ -0,0 +1,85 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"sync/atomic"
+	"time"
+)
+
+// Limits bound the resources of an evaluation started by EvalT or EvalD;
+// a zero value means that the resource is not limited.
+type Limits struct {
+	MaxSteps int           // number of evaluated nodes
+	MaxDepth int           // depth of nested function calls
+	Timeout  time.Duration // wall-clock time
+}
+
+// the limits of the evaluations started by EvalT and EvalD
+var limits Limits
+
+// set by Interrupt and reset when EvalT and EvalD start and return, not by nested evaluations;
+// accessed atomically, since Interrupt is called from other goroutines
+var interrupted int32
+
+// the deadline is only checked every timeCheckInterval steps
+const timeCheckInterval = 1024
+
+func SetLimits(l Limits) {
+	limits = l
+}
+
+func CurrentLimits() Limits {
+	return limits
+}
+
+// Interrupt aborts the current evaluation, e.g. on Ctrl-C
+func Interrupt() {
+	atomic.StoreInt32(&interrupted, 1)
+}
+
+// Interrupted reports whether the current evaluation has been interrupted;
+// other engines check it while they run
+func Interrupted() bool {
+	return atomic.LoadInt32(&interrupted) == 1
+}
+
+// ResetInterrupt is called by other engines when they start an evaluation
+func ResetInterrupt() {
+	atomic.StoreInt32(&interrupted, 0)
+}
+
+// EvalLimited evaluates node within l, e.g. a watch expression while an evaluation is
+// suspended by its debugger; the suspended evaluation is resumed afterwards as it was
+func EvalLimited(node ast.Node, env *object.Environment, l Limits) object.Object {
+	var obj object.Object
+	newEvaluation(l).run(func() {
+		obj = Eval(node, env)
+	})
+	return obj
+}
+
+// step counts an evaluation step and reports an error if a limit is exceeded
+func step() *object.Error {
+	e := current
+	e.steps++
+	if atomic.LoadInt32(&interrupted) == 1 {
+		return newError("evaluation interrupted")
+	}
+	if e.limits.MaxSteps > 0 && e.steps > e.limits.MaxSteps {
+		return newError("step limit exceeded: %d", e.limits.MaxSteps)
+	}
+	if !e.deadline.IsZero() && e.steps%timeCheckInterval == 0 && time.Now().After(e.deadline) {
+		return newError("timeout exceeded: %v", e.limits.Timeout)
+	}
+	return nil
+}
+
+// checkDepth reports an error if another function call exceeds the call depth limit
+func checkDepth() *object.Error {
+	e := current
+	if e.limits.MaxDepth > 0 && len(e.callStack) >= e.limits.MaxDepth {
+		return newError("call depth limit exceeded: %d", e.limits.MaxDepth)
+	}
+	return nil
+}
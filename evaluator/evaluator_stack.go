@@ -0,0 +1,86 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// a frame of the Monkey call stack: a function being applied
+type frame struct {
+	function *object.Function
+	call     *ast.CallExpression // the call the function has been applied by
+	env      *object.Environment // the environment of the function's body
+}
+
+func pushFrame(fn *object.Function, call *ast.CallExpression, env *object.Environment) {
+	current.callStack = append(current.callStack, frame{function: fn, call: call, env: env})
+}
+
+func popFrame() {
+	current.callStack = current.callStack[:len(current.callStack)-1]
+}
+
+// locateError marks err with the position of the node that raised it
+// and the call stack at that time; calls are located at their function,
+// as in the frames of their callers
+func locateError(err *object.Error, node ast.Node) {
+	if call, ok := node.(*ast.CallExpression); ok {
+		node = call.Function
+	}
+	tok, ok := ast.TokenOf(node)
+	if !ok {
+		return
+	}
+	err.Line, err.Column = tok.Line, tok.Column
+	err.Stack = stackFrames(tok.Line, tok.Column)
+}
+
+// stackFrames lists the current call stack, innermost frame first;
+// line and column are the current position within the innermost frame.
+// The frames end with a function applied by another engine, which adds its own frames.
+func stackFrames(line, column int) []object.StackFrame {
+	callStack := current.callStack
+	frames := make([]object.StackFrame, 0, len(callStack)+1)
+
+	for i := len(callStack) - 1; i >= 0; i-- {
+		f := callStack[i]
+		frames = append(frames, object.StackFrame{
+			Function: functionName(f.function),
+			Line:     line,
+			Column:   column,
+		})
+		if f.call == nil { // applied by another engine
+			return frames
+		}
+		line, column = 0, 0
+		if tok, ok := ast.TokenOf(f.call.Function); ok {
+			line, column = tok.Line, tok.Column
+		}
+	}
+
+	return append(frames, object.StackFrame{Function: "<program>", Line: line, Column: column})
+}
+
+// addCallerFrames appends the call stack to the frames of an error raised by
+// a function of another engine, which has been applied by call
+func addCallerFrames(obj object.Object, call *ast.CallExpression) object.Object {
+	err, ok := obj.(*object.Error)
+	if !ok || err.Line == 0 { // not located yet, see locateError
+		return obj
+	}
+	line, column := 0, 0
+	if call != nil {
+		if tok, ok := ast.TokenOf(call.Function); ok {
+			line, column = tok.Line, tok.Column
+		}
+	}
+	err.Stack = append(err.Stack, stackFrames(line, column)...)
+	return err
+}
+
+func functionName(fn *object.Function) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
@@ -0,0 +1,56 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"time"
+)
+
+/*
+The state of an evaluation - its steps, call stack, tail calls, tracer and
+debugger - is held by an evaluation. Each entry point, EvalT, EvalD, EvalLimited
+and ExpandMacros, starts a new evaluation and restores the current one when it
+returns, so that evaluations may be nested in a suspended one, e.g. a watch
+expression in an evaluation held by its debugger. Evaluations are run one at a time.
+*/
+
+type evaluation struct {
+	limits   Limits
+	steps    int
+	deadline time.Time
+
+	callStack []frame
+
+	// the function bodies are analyzed when they are first applied, see markTailCalls
+	tailCalls      map[*ast.CallExpression]bool
+	analyzedBodies map[*ast.BlockStatement]bool
+
+	tracer *tracer // nil if the evaluation is not traced
+
+	debugger   Debugger // nil if the evaluation is not debugged
+	debugDepth int
+}
+
+// current is the running evaluation; Eval called outside of an entry point,
+// e.g. by tests, runs in an evaluation without limits
+var current = newEvaluation(Limits{})
+
+func newEvaluation(l Limits) *evaluation {
+	e := &evaluation{
+		limits:         l,
+		tailCalls:      make(map[*ast.CallExpression]bool),
+		analyzedBodies: make(map[*ast.BlockStatement]bool),
+	}
+	if l.Timeout > 0 {
+		e.deadline = time.Now().Add(l.Timeout)
+	}
+	return e
+}
+
+// run calls f in e and restores the current evaluation afterwards
+func (e *evaluation) run(f func()) {
+	saved := current
+	current = e
+	defer func() { current = saved }()
+
+	f()
+}
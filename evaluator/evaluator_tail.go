@@ -0,0 +1,119 @@
+package evaluator
+
+import (
+	"monkey/ast"
+)
+
+/*
+Calls in tail position of a function body are not applied when they are
+evaluated. Instead, their evaluation results in an object.TailCall, which
+travels up to applyFunction, where the function of the tail call is applied
+in a loop, i.e. without growing the Go stack.
+
+A call is in tail position, if its value becomes the value of the function:
+	- the value of a return statement
+	- the last expression statement of the body
+	- the last expression statement of a block of an if expression,
+	  if the if expression is in tail position
+	- the last expression statement of a catch block,
+	  if the try expression is in tail position
+Calls within a try block are never in tail position, since their errors
+need to be caught. Neither are calls within the value of a let statement,
+even if they are returned.
+*/
+
+// the function bodies are analyzed when they are first applied during an evaluation;
+// the results are dropped with the evaluation, so that asts of former inputs can be freed
+
+func isTailCall(call *ast.CallExpression) bool {
+	return current.tailCalls[call]
+}
+
+// markTailCalls marks all calls in tail position of a function body
+func markTailCalls(body *ast.BlockStatement) {
+	if body == nil || current.analyzedBodies[body] {
+		return
+	}
+	current.analyzedBodies[body] = true
+
+	markTailBlock(body)
+}
+
+func markTailBlock(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	for i, stmt := range block.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.ReturnStatement:
+			if stmt != nil {
+				markTailExpression(stmt.ReturnValue)
+			}
+		case *ast.ExpressionStatement:
+			if stmt == nil {
+				continue
+			}
+			if i == len(block.Statements)-1 {
+				markTailExpression(stmt.Expression)
+			} else {
+				markReturns(stmt.Expression)
+			}
+		}
+	}
+}
+
+func markTailExpression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.CallExpression:
+		if exp != nil {
+			current.tailCalls[exp] = true
+		}
+	case *ast.IfExpression:
+		if exp != nil {
+			markTailBlock(exp.Consequence)
+			markTailBlock(exp.Alternative)
+		}
+	case *ast.TryExpression:
+		if exp != nil {
+			markTailBlock(exp.Handler)
+		}
+	default:
+		markReturns(exp)
+	}
+}
+
+// markReturns marks the values of return statements within blocks of
+// if expressions and catch blocks that are not in tail position themselves;
+// the values of let statements are not searched, since a return within them
+// is not in tail position of the function body
+func markReturns(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.IfExpression:
+		if exp != nil {
+			markReturnsBlock(exp.Consequence)
+			markReturnsBlock(exp.Alternative)
+		}
+	case *ast.TryExpression:
+		if exp != nil {
+			markReturnsBlock(exp.Handler)
+		}
+	}
+}
+
+func markReturnsBlock(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.ReturnStatement:
+			if stmt != nil {
+				markTailExpression(stmt.ReturnValue)
+			}
+		case *ast.ExpressionStatement:
+			if stmt != nil {
+				markReturns(stmt.Expression)
+			}
+		}
+	}
+}
@@ -1,10 +1,16 @@
 package evaluator
 
 import (
+	"fmt"
+	"monkey/ast"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"runtime/debug"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -67,6 +73,62 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestStructuralEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] != [1, 2]", false},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] == [1, 2, 3]", false},
+		{"[] == []", true},
+		{"[[1], [true, \"a\"]] == [[1], [true, \"a\"]]", true},
+		{"[[1], [2]] == [[1], [3]]", false},
+		{"let a = [1]; a == a", true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`{"a": 1} == {"a": 1, "b": 2}`, false},
+		{`{} == {}`, true},
+		{`{[1, 2]: "x"} == {[1, 2]: "x"}`, true},
+		{"if (false) {} == if (false) {}", true},
+		{"[1] == 1", false},
+		{"[1] != 1", true},
+		{`1 == "1"`, false},
+		{"let f = fn() {}; f == f", true},
+		{"fn() {} == fn() {}", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "a"`, false},
+		{`"a" != "b"`, true},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"a" > "b"`, false},
+		{`"ab" > "a"`, true},
+		{`"" < "a"`, true},
+		{`"mon" + "key" == "monkey"`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -213,6 +275,14 @@ if (10 > 1) {
 			"foobar",
 			"identifier not found: foobar",
 		},
+		{
+			"let f = fn(x, y) { x }; f(1)",
+			"wrong number of arguments: want=2, got=1",
+		},
+		{
+			"let f = fn(x) { x }; let g = fn() { f() }; g()",
+			"wrong number of arguments: want=1, got=0",
+		},
 		{
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
@@ -221,6 +291,14 @@ if (10 > 1) {
 			`999[1]`,
 			"index operator not supported: INTEGER",
 		},
+		{
+			`{[1, fn(x) { x }]: 1}`,
+			"unusable as hash key: ARRAY",
+		},
+		{
+			`{"name": "Monkey"}[[{}]];`,
+			"unusable as hash key: ARRAY",
+		},
 	}
 
 	for _, tt := range tests {
@@ -240,6 +318,144 @@ if (10 > 1) {
 	}
 }
 
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { 1 + true; 1 } catch (e) { 2 }`, 2},
+		{`try { 1 + true } catch (e) { e }`, "type mismatch: INTEGER + BOOLEAN"},
+		{`try { throw("oops") } catch (e) { e }`, "oops"},
+		{`try { error("oops") } catch (e) { e }`, "oops"},
+		{`try { throw(42) } catch (e) { e + 1 }`, 43},
+		{`try { throw([1, 2]) } catch (e) { e[1] }`, 2},
+		{`let f = fn() { throw("deep") }; let g = fn() { f(); 1 }; try { g() } catch (e) { e }`, "deep"},
+		{`let f = fn() { try { return 1; } catch (e) { 2 }; 3 }; f()`, 1},
+		{`let f = fn(x) { try { if (x) { throw(1) }; 2 } catch (e) { return 10 }; 3 }; f(true) + f(false)`, 13},
+		{`try { try { throw(1) } catch (e) { throw(e + 1) } } catch (e) { e }`, 2},
+		{`let e = 1; try { throw(2) } catch (e) { e }; e`, 1},
+		{`let x = try { throw(2) } catch (e) { e * 2 }; x`, 4},
+		{`try { 1 } catch (e) { 2 } + 1`, 2},
+		{`try { throw("a") } catch (e) { throw(e + "b") }`, errorMessage("ab")},
+		{`throw("uncaught")`, errorMessage("uncaught")},
+		{`throw({"a": 1})`, errorMessage(`{a: 1}`)},
+		{`throw()`, errorMessage("wrong number of arguments. got=0, want=1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)",
+					evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestErrorStackTraces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []object.StackFrame
+	}{
+		{
+			"1 + true",
+			[]object.StackFrame{{Function: "<program>", Line: 1, Column: 3}},
+		},
+		{
+			"let a = 1;\n  b",
+			[]object.StackFrame{{Function: "<program>", Line: 2, Column: 3}},
+		},
+		{
+			"let f = fn(x) {\n  x + true\n};\nlet g = fn() { f(1) + 1 };\ng()",
+			[]object.StackFrame{
+				{Function: "f", Line: 2, Column: 5},
+				{Function: "g", Line: 4, Column: 16},
+				{Function: "<program>", Line: 5, Column: 1},
+			},
+		},
+		{ // the tail call f(1) takes over the frame of g
+			"let f = fn(x) {\n  x + true\n};\nlet g = fn() { f(1) };\ng()",
+			[]object.StackFrame{
+				{Function: "f", Line: 2, Column: 5},
+				{Function: "<program>", Line: 5, Column: 1},
+			},
+		},
+		{ // the frame taken over by the tail calls is called from f(2)
+			"let f = fn(x) { if (x == 0) { 1 + true } else { f(x - 1) } }; f(2)",
+			[]object.StackFrame{
+				{Function: "f", Line: 1, Column: 33},
+				{Function: "<program>", Line: 1, Column: 63},
+			},
+		},
+		{
+			"fn() { throw(1) }()",
+			[]object.StackFrame{
+				{Function: "<anonymous>", Line: 1, Column: 8},
+				{Function: "<program>", Line: 1, Column: 1},
+			},
+		},
+		{
+			"let adder = fn(x) { fn(y) { x + y } }; let addTrue = adder(true); addTrue(1)",
+			[]object.StackFrame{
+				{Function: "addTrue", Line: 1, Column: 31},
+				{Function: "<program>", Line: 1, Column: 67},
+			},
+		},
+		{
+			"let f = fn() { throw(1) }; let g = f; g()",
+			[]object.StackFrame{
+				{Function: "f", Line: 1, Column: 16},
+				{Function: "<program>", Line: 1, Column: 39},
+			},
+		},
+		{ // calls are located at their function
+			"let f = fn(x) { len(x) };\nlet g = fn(x) { 1 + f(x) };\ng(1)",
+			[]object.StackFrame{
+				{Function: "f", Line: 1, Column: 17},
+				{Function: "g", Line: 2, Column: 21},
+				{Function: "<program>", Line: 3, Column: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if len(errObj.Stack) != len(tt.expected) {
+			t.Errorf("wrong number of stack frames for %q. want=%d, got=%d:\n%s",
+				tt.input, len(tt.expected), len(errObj.Stack), errObj.StackTrace())
+			continue
+		}
+
+		for i, frame := range tt.expected {
+			if errObj.Stack[i] != frame {
+				t.Errorf("wrong stack frame %d for %q. want=%s, got=%s",
+					i, tt.input, frame, errObj.Stack[i])
+			}
+		}
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -482,6 +698,14 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 		{
 			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"[1, 2, 3][-3]",
+			1,
+		},
+		{
+			"[1, 2, 3][-4]",
 			nil,
 		},
 	}
@@ -497,6 +721,104 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"abc"[0]`, "a"},
+		{`"abc"[2]`, "c"},
+		{`"abc"[-1]`, "c"},
+		{`"abc"[-3]`, "a"},
+		{`"abc"[3]`, nil},
+		{`"abc"[-4]`, nil},
+		{`""[0]`, nil},
+		{`let s = "monkey"; s[len(s) - 1]`, "y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := tt.expected.(string)
+		if ok {
+			testStringObject(t, evaluated, str)
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][1:]", []int{2, 3, 4}},
+		{"[1, 2, 3, 4][:2]", []int{1, 2}},
+		{"[1, 2, 3, 4][:]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][-2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:-1]", []int{1, 2, 3}},
+		{"[1, 2, 3, 4][3:1]", []int{}},
+		{"[1, 2, 3, 4][-10:10]", []int{1, 2, 3, 4}},
+		{"let a = [1, 2, 3]; let i = 1; a[i:i + 1]", []int{2}},
+		{`"monkey"[1:3]`, "on"},
+		{`"monkey"[3:]`, "key"},
+		{`"monkey"[:-3]`, "mon"},
+		{`"monkey"[4:2]`, ""},
+		{`1[0:1]`, errorMessage("slice operator not supported: INTEGER")},
+		{`[1, 2][true:]`, errorMessage("slice bound must be INTEGER, got BOOLEAN")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d",
+					len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			}
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)",
+					evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestSlicesDoNotShareElements(t *testing.T) {
+	input := `let a = [1, 2, 3]; let b = a[:]; push(b, 4); a`
+
+	evaluated := testEval(input)
+	array, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+	if len(array.Elements) != 3 {
+		t.Errorf("original array has been altered. got=%s", array.Inspect())
+	}
+}
+
 func TestHashLiterals(t *testing.T) {
 	input := `let two = "two";
 	{
@@ -537,6 +859,20 @@ func TestHashLiterals(t *testing.T) {
 	}
 }
 
+func TestHashLiteralsArrayKeys(t *testing.T) {
+	input := `let pos = [1, 2];
+	let grid = {
+		[0, 0]: 1,
+		pos: 2,
+		[["a"], true]: 3,
+		[]: 4
+	};
+	grid[[0, 0]] + grid[[1, 2]] + grid[[["a"], true]] + grid[[]]`
+
+	testIntegerObject(t, testEval(input), 10)
+	testNullObject(t, testEval(`{[1, 2]: 1}[[2, 1]]`))
+}
+
 func TestHashIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -582,13 +918,394 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let loop = fn(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + n) } }; loop(100000, 0)", 5000050000},
+		{"let loop = fn(n, acc) { if (n == 0) { return acc; } return loop(n - 1, acc + 1); }; loop(100000, 0)", 100000},
+		{"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(100001)", false},
+		{"let loop = fn(n) { if (n == 0) { return 0; } try { throw(n) } catch (e) { loop(e - 1) } }; loop(100000)", 0},
+		{"let loop = fn(n) { let x = if (n > 0) { loop(n - 1) } else { n }; x + 1 }; loop(3)", 4},
+		{"let f = fn(x) { try { g(x) } catch (e) { e } }; let g = fn(x) { throw(x) }; f(7)", 7},
+		{"let f = fn() { len }; let g = fn() { f()(\"abc\") }; g()", 3},
+		{"let g = fn() { puts(\"side\"); 7 }; let f = fn() { let x = if (true) { return g() } else { 1 }; 10 }; f()", 7},
+		{"let g = fn() { 7 }; let f = fn() { let x = if (true) { return g() } else { 1 }; x + 10 }; f()", 7},
+	}
+
+	// without tail call optimization, the first tests need more stack than this
+	defer debug.SetMaxStack(debug.SetMaxStack(16 << 20))
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestTailCallsTrace(t *testing.T) {
+	input := "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(2)"
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	evaluated, trace := EvalT(program, object.NewEnvironment(), true)
+	testIntegerObject(t, evaluated, 0)
+
+	tailCalls := 0
+	for _, call := range trace.Calls {
+		if _, ok := call.Node.(*ast.CallExpression); !ok {
+			continue
+		}
+		if call.Tail {
+			tailCalls++
+			if val := trace.Exits[exitOf(trace, call.Id)].Val; val.Type() != object.TAIL_CALL_OBJ {
+				t.Errorf("tail call %s evaluated to %s", call.Node, val.Type())
+			}
+		} else if call.Node.String() != "f(2)" {
+			t.Errorf("call %s is not marked as tail call", call.Node)
+		}
+	}
+	if tailCalls != 2 {
+		t.Errorf("wrong number of tail calls. want=2, got=%d", tailCalls)
+	}
+}
+
+func TestTraceEnvironments(t *testing.T) {
+	input := "let x = 1; let f = fn(y) { let z = x + y; z }; let x = f(2); x"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	env := object.NewEnvironment()
+	env.Set("w", &object.Integer{Value: 0}) // bound before the evaluation
+
+	_, trace := EvalT(program, env, true)
+
+	// the bindings of the environment of each exit of a let statement, at the exit and just before it
+	expected := []struct {
+		before, after string
+	}{
+		{"[w=0]", "[w=0 x=1]"},
+		{"[w=0 x=1]", "[f=fn w=0 x=1]"},
+		{"[y=2 f=fn w=0 x=1]", "[y=2 z=3 f=fn w=0 x=1]"},
+		{"[f=fn w=0 x=1]", "[f=fn w=0 x=3]"},
+	}
+	lets := 0
+	for step := 0; step < trace.Steps(); step++ {
+		exit, ok := trace.Exits[step]
+		if !ok {
+			continue
+		}
+		if _, ok := exit.Node.(*ast.LetStatement); !ok {
+			continue
+		}
+		if lets == len(expected) {
+			t.Fatalf("too many let statements")
+		}
+		before, after := bindings(trace.EnvAt(exit.Env, step-1)), bindings(trace.EnvSnap(step))
+		if before != expected[lets].before || after != expected[lets].after {
+			t.Errorf("wrong bindings at step %d. want=%s, %s, got=%s, %s",
+				step, expected[lets].before, expected[lets].after, before, after)
+		}
+		if !trace.EnvChanged(exit.Env, step-1, step) {
+			t.Errorf("binding at step %d not reported as a change", step)
+		}
+		if trace.EnvChanged(exit.Env, step, step+1) {
+			t.Errorf("change after step %d reported", step)
+		}
+		lets++
+	}
+
+	if x, _ := env.Get("x"); x.Inspect() != "3" {
+		t.Errorf("the environment has not been altered, x=%s", x.Inspect())
+	}
+	if x, _ := trace.EnvSnap(0).Get("x"); x != nil {
+		t.Errorf("x is bound at step 0")
+	}
+}
+
+// bindings returns the bindings of env, sorted by name, and those of its outer environments
+func bindings(env *object.Environment) string {
+	s := ""
+	for ; env != nil; env = env.Outer {
+		names := []string{}
+		for name := range env.Store {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			val := env.Store[name].Inspect()
+			if env.Store[name].Type() == object.FUNCTION_OBJ {
+				val = "fn"
+			}
+			s += " " + name + "=" + val
+		}
+	}
+	return "[" + strings.TrimPrefix(s, " ") + "]"
+}
+
+// BenchmarkTrace traces recursive programs with bindings in the global environment;
+// copyEnv copies the environment at each step, as the tracer used to, log records
+// the bindings set, and log+EnvSnap reconstructs the environment of each step afterwards
+func BenchmarkTrace(b *testing.B) {
+	globals := ""
+	for i := 0; i < 20; i++ {
+		globals += fmt.Sprintf("let g%d = %d; ", i, i)
+	}
+	for _, n := range []int{8, 12, 16} {
+		input := globals + fmt.Sprintf("let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } }; fib(%d)", n)
+		program := parser.New(lexer.New(input)).ParseProgram()
+
+		b.Run(fmt.Sprintf("copyEnv/fib(%d)", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				e := newEvaluation(limits)
+				e.tracer = newTracer()
+				e.debugger = &envCopier{snaps: make(map[int]*object.Environment)}
+				e.run(func() {
+					Eval(program, object.NewEnvironment())
+				})
+			}
+		})
+		b.Run(fmt.Sprintf("log/fib(%d)", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				EvalT(program, object.NewEnvironment(), true)
+			}
+		})
+		b.Run(fmt.Sprintf("log+EnvSnap/fib(%d)", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, trace := EvalT(program, object.NewEnvironment(), true)
+				for step := 0; step < trace.Steps(); step++ {
+					trace.EnvSnap(step)
+				}
+			}
+		})
+	}
+}
+
+// envCopier copies the environment at each step, as the tracer did before it logged the bindings set
+type envCopier struct {
+	step  int
+	snaps map[int]*object.Environment
+}
+
+func (c *envCopier) Call(node ast.Node, env *object.Environment, depth int) {
+	c.snaps[c.step] = copyEnv(env)
+	c.step++
+}
+
+func (c *envCopier) Exit(node ast.Node, env *object.Environment, depth int, val object.Object) {
+	c.snaps[c.step] = copyEnv(env)
+	c.step++
+}
+
+func copyEnv(env *object.Environment) *object.Environment {
+	newEnv := object.NewEnvironment()
+	for name, val := range env.Store {
+		newEnv.Set(name, val)
+	}
+	if env.Outer != nil {
+		newEnv.Outer = copyEnv(env.Outer)
+	}
+	return newEnv
+}
+
+func TestEvaluationStateDropped(t *testing.T) {
+	idle := current
+	calls, bodies := len(idle.tailCalls), len(idle.analyzedBodies)
+	input := "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(2)"
+	EvalT(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment(), true)
+
+	if current != idle {
+		t.Fatalf("the evaluation is still current after EvalT returned")
+	}
+	if len(idle.tailCalls) != calls || len(idle.analyzedBodies) != bodies || len(idle.callStack) != 0 || idle.tracer != nil {
+		t.Errorf("state of a former evaluation is kept: %d calls, %d bodies, %d frames",
+			len(idle.tailCalls)-calls, len(idle.analyzedBodies)-bodies, len(idle.callStack))
+	}
+}
+
+func exitOf(trace *Trace, id int) int {
+	for no, exit := range trace.Exits {
+		if exit.Id == id {
+			return no
+		}
+	}
+	return -1
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   Limits
+		expected string
+	}{
+		{"let f = fn(x) { f(x) }; f(1)", Limits{MaxSteps: 1000}, "step limit exceeded: 1000"},
+		{"let f = fn(x) { 1 + f(x) }; f(1)", Limits{MaxDepth: 100}, "call depth limit exceeded: 100"},
+		{"let f = fn(x) { f(x) }; f(1)", Limits{Timeout: 10 * time.Millisecond}, "timeout exceeded: 10ms"},
+		{"let f = fn(x) { if (x == 0) { 0 } else { 1 + f(x - 1) } }; f(99)", Limits{MaxDepth: 100}, ""},
+		{"let f = fn(x) { if (x == 0) { 0 } else { 1 + f(x - 1) } }; f(100)", Limits{MaxDepth: 100}, "call depth limit exceeded: 100"},
+		{"let f = fn(x) { 1 + f(x) }; try { f(1) } catch (e) { 0 }", Limits{MaxDepth: 100}, ""},
+	}
+
+	defer SetLimits(Limits{})
+
+	for _, tt := range tests {
+		SetLimits(tt.limits)
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated, _ := EvalT(program, object.NewEnvironment(), false)
+
+		errObj, ok := evaluated.(*object.Error)
+		if tt.expected == "" {
+			if ok {
+				t.Errorf("unexpected error for %q: %s", tt.input, errObj.Message)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
+// watchingDebugger evaluates a watch expression at each call, as the debuggers do
+type watchingDebugger struct {
+	watch  ast.Node
+	values []object.Object
+}
+
+func (d *watchingDebugger) Call(node ast.Node, env *object.Environment, depth int) {
+	d.values = append(d.values, EvalLimited(d.watch, object.NewEnclosedEnvironment(env), Limits{MaxSteps: 1000}))
+}
+
+func (d *watchingDebugger) Exit(node ast.Node, env *object.Environment, depth int, val object.Object) {
+}
+
+func TestEvalLimited(t *testing.T) {
+	defer SetLimits(Limits{})
+	SetLimits(Limits{MaxSteps: 500})
+
+	input := `let f = fn(x) { if (x == 0) { throw("zero") } else { f(x - 1) } }; let h = fn() { f(3) + 1 }; h()`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	expected, _ := EvalT(program, object.NewEnvironment(), false)
+
+	// the watch does not terminate, its steps and calls must not count for the evaluation
+	d := &watchingDebugger{watch: parser.New(lexer.New("let g = fn(n) { g(n) }; g(1)")).ParseProgram()}
+	evaluated := EvalD(program, object.NewEnvironment(), d)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.StackTrace() != expected.(*object.Error).StackTrace() {
+		t.Errorf("wrong stack trace. expected=%q, got=%q", expected.(*object.Error).StackTrace(), errObj.StackTrace())
+	}
+	for _, val := range d.values {
+		if errObj, ok := val.(*object.Error); !ok || errObj.Message != "step limit exceeded: 1000" {
+			t.Fatalf("expected the step limit of the watch to be exceeded, got %s", val.Inspect())
+		}
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	program := parser.New(lexer.New("let f = fn(x) { f(x) }; f(1)")).ParseProgram()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		Interrupt()
+	}()
+	evaluated, _ := EvalT(program, object.NewEnvironment(), false)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "evaluation interrupted" {
+		t.Errorf("wrong error message. expected=%q, got=%q", "evaluation interrupted", errObj.Message)
+	}
+}
+
+// recordingDebugger records the steps as the tracer does
+type recordingDebugger struct {
+	steps   []string
+	abortAt int // aborts the evaluation at the first call after this number of steps, if positive
+}
+
+func (d *recordingDebugger) Call(node ast.Node, env *object.Environment, depth int) {
+	d.steps = append(d.steps, fmt.Sprintf("call %d %s", depth, node))
+	if d.abortAt > 0 && len(d.steps) > d.abortAt {
+		Interrupt()
+	}
+}
+
+func (d *recordingDebugger) Exit(node ast.Node, env *object.Environment, depth int, val object.Object) {
+	d.steps = append(d.steps, fmt.Sprintf("exit %d %s", depth, node))
+}
+
+func TestDebugger(t *testing.T) {
+	input := "let f = fn(x) { if (x > 0) { f(x - 1) } else { x } }; f(2)"
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	_, trace := EvalT(program, object.NewEnvironment(), true)
+	d := &recordingDebugger{}
+	evaluated := EvalD(program, object.NewEnvironment(), d)
+	testIntegerObject(t, evaluated, 0)
+
+	if len(d.steps) != trace.Steps() {
+		t.Fatalf("wrong number of steps. expected=%d, got=%d", trace.Steps(), len(d.steps))
+	}
+	for i, step := range d.steps {
+		var expected string
+		if call, ok := trace.Calls[i]; ok {
+			expected = fmt.Sprintf("call %d %s", call.Depth, call.Node)
+		} else {
+			exit := trace.Exits[i]
+			expected = fmt.Sprintf("exit %d %s", exit.Depth, exit.Node)
+		}
+		if step != expected {
+			t.Errorf("step %d: expected=%q, got=%q", i, expected, step)
+		}
+	}
+
+	// the debugger is only consulted by EvalD
+	d.steps = nil
+	EvalT(program, object.NewEnvironment(), false)
+	if len(d.steps) != 0 {
+		t.Errorf("debugger consulted after EvalD returned")
+	}
+}
+
+func TestDebuggerAbort(t *testing.T) {
+	program := parser.New(lexer.New("let f = fn(x) { f(x) }; f(1)")).ParseProgram()
+
+	d := &recordingDebugger{abortAt: 20}
+	evaluated := EvalD(program, object.NewEnvironment(), d)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "evaluation interrupted" {
+		t.Errorf("wrong error message. expected=%q, got=%q", "evaluation interrupted", errObj.Message)
+	}
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
 	env := object.NewEnvironment()
 
-	return Eval(program, env)
+	evaluated := Eval(program, env)
+	diffEngines(input, evaluated)
+	return evaluated
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
@@ -606,6 +1323,23 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+type errorMessage string
+
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
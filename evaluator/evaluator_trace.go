@@ -3,25 +3,25 @@ package evaluator
 import (
 	"monkey/ast"
 	"monkey/object"
+	"sort"
 )
 
 type Call struct {
-	No      int
-	Id      int
-	Depth   int
-	Node    ast.Node
-	Env     *object.Environment
-	EnvSnap *object.Environment
+	No    int
+	Id    int
+	Depth int
+	Node  ast.Node
+	Env   *object.Environment
+	Tail  bool // the node is a call in tail position, applied by the caller's call
 }
 
 type Exit struct {
-	No      int
-	Id      int
-	Depth   int
-	Node    ast.Node
-	Env     *object.Environment
-	EnvSnap *object.Environment
-	Val     object.Object
+	No    int
+	Id    int
+	Depth int
+	Node  ast.Node
+	Env   *object.Environment
+	Val   object.Object
 }
 
 type Trace struct {
@@ -29,16 +29,39 @@ type Trace struct {
 	Exits        map[int]Exit
 	Environments []*object.Environment // not used by cmd/log TraceP // could be used for numbering environments?
 	counter      int
+	logs         map[*object.Environment]*envLog
+}
+
+/*
+Instead of copying the environments at each step, the tracer records the bindings
+of an environment when it is first seen at a step and then each binding set in it.
+The environments as they were at a step are reconstructed from these logs,
+see Trace.EnvAt; the bindings of each name are looked up by binary search,
+so that reconstructing an environment does not replay its whole log.
+*/
+
+// envLog is the history of an environment during the evaluation
+type envLog struct {
+	since   int                      // the step the environment was first seen at
+	initial map[string]object.Object // its bindings at that step
+	events  map[string][]envEvent    // the bindings set by name, in the order of the steps
+}
+
+// envEvent is a binding set after step-1 and before step
+type envEvent struct {
+	step int
+	val  object.Object
 }
 
 type tracer struct {
-	active       bool
 	counter      int
 	id           int
 	depth        int
 	calls        map[int]Call
 	exits        map[int]Exit
 	environments []*object.Environment
+	called       map[*object.Environment]bool // the environments in environments
+	logs         map[*object.Environment]*envLog
 }
 
 func newTracer() *tracer {
@@ -49,25 +72,18 @@ func newTracer() *tracer {
 	return &tracer{
 		calls:        calls,
 		exits:        exits,
-		active:       false,
 		counter:      0,
 		id:           0,
 		depth:        0,
 		environments: environments,
+		called:       make(map[*object.Environment]bool),
+		logs:         make(map[*object.Environment]*envLog),
 	}
 }
 
-func startTracer() {
-	t = newTracer()
-	t.active = true
-}
-
-func stopTracer() {
-	t.active = false
-}
-
 func traceCall(node ast.Node, env *object.Environment) int {
-	if !t.active {
+	t := current.tracer
+	if t == nil {
 		return 0
 	}
 	var call Call
@@ -79,23 +95,22 @@ func traceCall(node ast.Node, env *object.Environment) int {
 	call.Id = t.id
 	t.id++
 	call.Node = node
+	if callExp, ok := node.(*ast.CallExpression); ok {
+		call.Tail = isTailCall(callExp)
+	}
 	call.Env = env
-	call.EnvSnap = copyEnv(env)
+	t.observe(env, no)
 	t.calls[no] = call
-	new := true
-	for _, e := range t.environments {
-		if env == e {
-			new = false
-		}
-	}
-	if new {
+	if !t.called[env] {
+		t.called[env] = true
 		t.environments = append(t.environments, env)
 	}
 	return call.Id
 }
 
 func traceExit(id int, node ast.Node, env *object.Environment, val object.Object) {
-	if !t.active {
+	t := current.tracer
+	if t == nil {
 		return
 	}
 	var exit Exit
@@ -107,20 +122,35 @@ func traceExit(id int, node ast.Node, env *object.Environment, val object.Object
 	exit.Id = id
 	exit.Node = node
 	exit.Env = env
-	exit.EnvSnap = copyEnv(env)
+	t.observe(env, no)
 	exit.Val = val
 	t.exits[no] = exit
 }
 
-func copyEnv(env *object.Environment) *object.Environment {
-	newEnv := object.NewEnvironment()
-	for name, val := range env.Store {
-		newEnv.Set(name, val)
+// observe starts logging env and its outer environments if they are seen for the first time
+func (t *tracer) observe(env *object.Environment, step int) {
+	for ; env != nil; env = env.Outer {
+		if _, ok := t.logs[env]; ok {
+			return // so are its outer environments
+		}
+		initial := make(map[string]object.Object, len(env.Store))
+		for name, val := range env.Store {
+			initial[name] = val
+		}
+		t.logs[env] = &envLog{since: step, initial: initial, events: make(map[string][]envEvent)}
 	}
-	if env.Outer != nil {
-		newEnv.Outer = copyEnv(env.Outer)
+}
+
+// setBinding binds name to val in env and logs it if env is traced
+func setBinding(env *object.Environment, name string, val object.Object) {
+	env.Set(name, val)
+	t := current.tracer
+	if t == nil {
+		return
+	}
+	if log, ok := t.logs[env]; ok {
+		log.events[name] = append(log.events[name], envEvent{step: t.counter, val: val})
 	}
-	return newEnv
 }
 
 func (t tracer) getTrace() *Trace {
@@ -129,6 +159,7 @@ func (t tracer) getTrace() *Trace {
 		Exits:        t.exits,
 		Environments: t.environments,
 		counter:      t.counter,
+		logs:         t.logs,
 	}
 }
 
@@ -142,3 +173,69 @@ func (t Trace) GetRoot() ast.Node {
 func (t Trace) Steps() int {
 	return t.counter
 }
+
+// EnvSnap returns a copy of the environment of a step as it was at the step
+func (t Trace) EnvSnap(step int) *object.Environment {
+	if call, ok := t.Calls[step]; ok {
+		return t.EnvAt(call.Env, step)
+	}
+	if exit, ok := t.Exits[step]; ok {
+		return t.EnvAt(exit.Env, step)
+	}
+	return nil
+}
+
+// EnvAt returns a copy of env and its outer environments as they were at step;
+// environments not seen during the evaluation are copied as they are now
+func (t Trace) EnvAt(env *object.Environment, step int) *object.Environment {
+	if env == nil {
+		return nil
+	}
+	snap := object.NewEnvironment()
+	snap.Store = t.StoreAt(env, step)
+	snap.Outer = t.EnvAt(env.Outer, step)
+	return snap
+}
+
+// StoreAt returns the bindings of env, without those of its outer environments, as they were at step
+func (t Trace) StoreAt(env *object.Environment, step int) map[string]object.Object {
+	log, ok := t.logs[env]
+	if !ok {
+		store := make(map[string]object.Object, len(env.Store))
+		for name, val := range env.Store {
+			store[name] = val
+		}
+		return store
+	}
+	store := make(map[string]object.Object, len(log.initial))
+	for name, val := range log.initial {
+		store[name] = val
+	}
+	for name, events := range log.events {
+		// the first event after step
+		i := sort.Search(len(events), func(i int) bool { return events[i].step > step })
+		if i > 0 {
+			store[name] = events[i-1].val
+		}
+	}
+	return store
+}
+
+// EnvChanged reports whether a binding was set in env or its outer environments
+// after step from and up to step to
+func (t Trace) EnvChanged(env *object.Environment, from, to int) bool {
+	for ; env != nil; env = env.Outer {
+		log, ok := t.logs[env]
+		if !ok {
+			continue
+		}
+		for _, events := range log.events {
+			// the first event after from
+			i := sort.Search(len(events), func(i int) bool { return events[i].step > from })
+			if i < len(events) && events[i].step <= to {
+				return true
+			}
+		}
+	}
+	return false
+}
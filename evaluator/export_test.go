@@ -0,0 +1,64 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+)
+
+// Engines holds the engines besides the evaluator, registered by engines_test.go;
+// testEval runs its input through each of them and records differing results.
+var Engines = make(map[string]func(node ast.Node, env *object.Environment) object.Object)
+
+var EngineMismatches []string
+
+func diffEngines(input string, expected object.Object) {
+	for name, engine := range Engines {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		got, panicked := runEngine(engine, program)
+
+		if panicked != nil {
+			EngineMismatches = append(EngineMismatches,
+				fmt.Sprintf("%s panicked for %q: %v", name, input, panicked))
+			continue
+		}
+		if !sameResult(expected, got) {
+			EngineMismatches = append(EngineMismatches,
+				fmt.Sprintf("%s differs for %q. evaluator=%s, %s=%s",
+					name, input, inspect(expected), name, inspect(got)))
+		}
+	}
+}
+
+func runEngine(
+	engine func(node ast.Node, env *object.Environment) object.Object,
+	program *ast.Program,
+) (result object.Object, panicked interface{}) {
+	defer func() {
+		panicked = recover()
+	}()
+	return engine(program, object.NewEnvironment()), nil
+}
+
+func sameResult(a, b object.Object) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	if errA, ok := a.(*object.Error); ok {
+		errB := b.(*object.Error)
+		return errA.Message == errB.Message && errA.StackTrace() == errB.StackTrace()
+	}
+	return object.Equal(a, b) || a.Inspect() == b.Inspect()
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("%s %s", obj.Type(), obj.Inspect())
+}
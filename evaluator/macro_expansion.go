@@ -0,0 +1,143 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+)
+
+// DefineMacros binds the macros defined by let statements at the top level of program in env
+// and removes these statements from program.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := []ast.Statement{}
+
+	for _, statement := range program.Statements {
+		if letStatement, macroLiteral, ok := isMacroDefinition(statement); ok {
+			macro := &object.Macro{
+				Parameters: macroLiteral.Parameters,
+				Env:        env,
+				Body:       macroLiteral.Body,
+			}
+			env.Set(letStatement.Name.Value, macro)
+			continue
+		}
+		statements = append(statements, statement)
+	}
+
+	program.Statements = statements
+}
+
+func isMacroDefinition(node ast.Statement) (*ast.LetStatement, *ast.MacroLiteral, bool) {
+	letStatement, ok := node.(*ast.LetStatement)
+	if !ok {
+		return nil, nil, false
+	}
+
+	macroLiteral, ok := letStatement.Value.(*ast.MacroLiteral)
+	if !ok {
+		return nil, nil, false
+	}
+
+	return letStatement, macroLiteral, true
+}
+
+// ExpandMacros replaces the calls of the macros bound in env by their expansions:
+// a macro is applied to its quoted arguments and must return a quote.
+// The node passed in is not altered. Each expansion is an evaluation within the limits
+// set by SetLimits; it may be aborted by Interrupt.
+func ExpandMacros(node ast.Node, env *object.Environment) (ast.Node, error) {
+	var err error
+
+	expanded := ast.Modify(node, func(node ast.Node) ast.Node {
+		if err != nil {
+			return node
+		}
+
+		callExpression, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+
+		macro, ok := isMacroCall(callExpression, env)
+		if !ok {
+			return node
+		}
+
+		if len(callExpression.Arguments) != len(macro.Parameters) {
+			err = fmt.Errorf("wrong number of arguments to macro %s. got=%d, want=%d",
+				callExpression.Function, len(callExpression.Arguments), len(macro.Parameters))
+			return node
+		}
+
+		evalEnv := extendMacroEnv(macro, quoteArgs(callExpression))
+
+		evaluated := unwrapReturnValue(EvalLimited(macro.Body, evalEnv, limits))
+		if e, ok := evaluated.(*object.Error); ok {
+			err = fmt.Errorf("macro %s: %s", callExpression.Function, e.Message)
+			return node
+		}
+
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			err = fmt.Errorf("macro %s returned %s, macros must return quotes",
+				callExpression.Function, objectTypeOf(evaluated))
+			return node
+		}
+
+		return quote.Node
+	})
+
+	if err != nil {
+		return node, err
+	}
+	return expanded, nil
+}
+
+func isMacroCall(exp *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	identifier, ok := exp.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(identifier.Value)
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		return nil, false
+	}
+
+	return macro, true
+}
+
+func quoteArgs(exp *ast.CallExpression) []*object.Quote {
+	args := []*object.Quote{}
+
+	for _, a := range exp.Arguments {
+		args = append(args, &object.Quote{Node: a})
+	}
+
+	return args
+}
+
+func extendMacroEnv(
+	macro *object.Macro,
+	args []*object.Quote,
+) *object.Environment {
+	extended := object.NewEnclosedEnvironment(macro.Env)
+
+	for paramIdx, param := range macro.Parameters {
+		extended.Set(param.Value, args[paramIdx])
+	}
+
+	return extended
+}
+
+func objectTypeOf(obj object.Object) string {
+	if obj == nil {
+		return "nothing"
+	}
+	return string(obj.Type())
+}
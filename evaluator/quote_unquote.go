@@ -0,0 +1,83 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+)
+
+// quote is a special form: its argument is not evaluated, but wrapped in an object.Quote;
+// only the arguments of the calls to unquote within it are evaluated.
+
+func isQuoteCall(node *ast.CallExpression) bool {
+	return node.Function.TokenLiteral() == "quote"
+}
+
+func evalQuoteCall(node *ast.CallExpression, env *object.Environment) object.Object {
+	if len(node.Arguments) != 1 {
+		return newError("wrong number of arguments to quote. got=%d, want=1", len(node.Arguments))
+	}
+	return quote(node.Arguments[0], env)
+}
+
+func quote(node ast.Node, env *object.Environment) object.Object {
+	var err *object.Error
+
+	node = ast.Modify(node, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || call.Function.TokenLiteral() != "unquote" || err != nil {
+			return node
+		}
+		if len(call.Arguments) != 1 {
+			err = newError("wrong number of arguments to unquote. got=%d, want=1", len(call.Arguments))
+			return node
+		}
+
+		unquoted := Eval(call.Arguments[0], env)
+		if e, ok := unquoted.(*object.Error); ok {
+			err = e
+			return node
+		}
+
+		converted, ok := convertObjectToASTNode(unquoted)
+		if !ok {
+			err = newError("cannot unquote %s", unquoted.Type())
+			return node
+		}
+		return converted
+	})
+
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+func convertObjectToASTNode(obj object.Object) (ast.Node, bool) {
+	switch obj := obj.(type) {
+
+	case *object.Integer:
+		t := token.Token{Type: token.INT, Literal: fmt.Sprintf("%d", obj.Value)}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}, true
+
+	case *object.Boolean:
+		var t token.Token
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true"}
+		} else {
+			t = token.Token{Type: token.FALSE, Literal: "false"}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}, true
+
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}, true
+
+	case *object.Quote:
+		return obj.Node, true
+
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,147 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`quote(5)`,
+			`5`,
+		},
+		{
+			`quote(5 + 8)`,
+			`(5 + 8)`,
+		},
+		{
+			`quote(foobar)`,
+			`foobar`,
+		},
+		{
+			`quote(foobar + barfoo)`,
+			`(foobar + barfoo)`,
+		},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`quote(unquote(4))`,
+			`4`,
+		},
+		{
+			`quote(unquote(4 + 4))`,
+			`8`,
+		},
+		{
+			`quote(8 + unquote(4 + 4))`,
+			`(8 + 8)`,
+		},
+		{
+			`quote(unquote(4 + 4) + 8)`,
+			`(8 + 8)`,
+		},
+		{
+			`let foobar = 8;
+			quote(foobar)`,
+			`foobar`,
+		},
+		{
+			`let foobar = 8;
+			quote(unquote(foobar))`,
+			`8`,
+		},
+		{
+			`quote(unquote(true))`,
+			`true`,
+		},
+		{
+			`quote(unquote(true == false))`,
+			`false`,
+		},
+		{
+			`quote(unquote("monkey"))`,
+			`monkey`,
+		},
+		{
+			`quote(unquote(quote(4 + 4)))`,
+			`(4 + 4)`,
+		},
+		{
+			`let quotedInfixExpression = quote(4 + 4);
+			quote(unquote(4 + 4) + unquote(quotedInfixExpression))`,
+			`(8 + (4 + 4))`,
+		},
+		{
+			`let f = fn(x) { quote(1 + unquote(x)) };
+			f(2); f(3)`,
+			`(1 + 3)`,
+		},
+		{
+			`let f = fn(x) { let g = fn() { quote(unquote(x) + unquote(y)) }; g() };
+			let y = 2;
+			f(1)`,
+			`(1 + 2)`,
+		},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(1, 2)`, "wrong number of arguments to quote. got=2, want=1"},
+		{`quote(unquote())`, "wrong number of arguments to unquote. got=0, want=1"},
+		{`quote(unquote(x))`, "identifier not found: x"},
+		{`quote(unquote([1, 2]))`, "cannot unquote ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q",
+				tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func testQuoteObject(t *testing.T, evaluated object.Object, expected string) {
+	t.Helper()
+
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if quote.Node == nil {
+		t.Fatalf("quote.Node is nil")
+	}
+
+	if quote.Node.String() != expected {
+		t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), expected)
+	}
+}
@@ -0,0 +1,290 @@
+package formatter
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+)
+
+/*
+The canonical layout of Monkey source:
+
+- one statement per line; every statement ends with a semicolon,
+  except an expression statement closing a program or a block,
+  since its value is the value of the program or block
+- blocks are indented by two spaces; a block consisting of a single short expression
+  or return statement stays on one line: `fn(x) { x + 1 }`
+- operators are surrounded by spaces; parentheses are only kept where the structure requires them
+- hash pairs keep the order of the input
+*/
+
+const indent = "  "
+
+// blocks whose single statement is longer are spread over several lines
+const maxInlineBlock = 40
+
+// Format returns the canonical source of node
+func Format(node ast.Node) string {
+	p := &printer{}
+	p.node(node)
+	return p.out.String()
+}
+
+// Source formats Monkey source; it fails if src cannot be parsed
+func Source(src string) (string, error) {
+	par := parser.New(lexer.New(src))
+	program := par.ParseProgram()
+	if len(par.Errors()) != 0 {
+		msgs := []string{}
+		for _, err := range par.Errors() {
+			msgs = append(msgs, err.Position()+": "+err.Error())
+		}
+		return "", fmt.Errorf("cannot be parsed:\n\t%s", strings.Join(msgs, "\n\t"))
+	}
+	return Format(program) + "\n", nil
+}
+
+type printer struct {
+	out   bytes.Buffer
+	depth int
+}
+
+func (p *printer) print(a ...interface{}) {
+	fmt.Fprint(&p.out, a...)
+}
+
+func (p *printer) newline() {
+	p.print("\n", strings.Repeat(indent, p.depth))
+}
+
+func (p *printer) node(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		p.statements(node.Statements)
+	case ast.Statement:
+		p.statement(node, false)
+	case ast.Expression:
+		p.expression(node, parser.LOWEST)
+	}
+}
+
+func (p *printer) statements(statements []ast.Statement) {
+	for i, s := range statements {
+		if i > 0 {
+			p.newline()
+		}
+		p.statement(s, i == len(statements)-1)
+	}
+}
+
+func (p *printer) statement(s ast.Statement, last bool) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.print("let ", s.Name.Value, " = ")
+		p.expression(s.Value, parser.LOWEST)
+		p.print(";")
+	case *ast.ReturnStatement:
+		p.print("return ")
+		p.expression(s.ReturnValue, parser.LOWEST)
+		p.print(";")
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression, parser.LOWEST)
+		if !last {
+			p.print(";")
+		}
+	case *ast.BlockStatement:
+		p.block(s)
+	}
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 {
+		p.print("{}")
+		return
+	}
+
+	if inline, ok := inlineBlock(block); ok {
+		p.print("{ ", inline, " }")
+		return
+	}
+
+	p.print("{")
+	p.depth++
+	p.newline()
+	p.statements(block.Statements)
+	p.depth--
+	p.newline()
+	p.print("}")
+}
+
+// inlineBlock returns the single statement of block if it fits into one line
+func inlineBlock(block *ast.BlockStatement) (string, bool) {
+	if len(block.Statements) != 1 {
+		return "", false
+	}
+	switch block.Statements[0].(type) {
+	case *ast.ExpressionStatement, *ast.ReturnStatement:
+	default:
+		return "", false
+	}
+
+	inline := &printer{}
+	inline.statement(block.Statements[0], true)
+	str := inline.out.String()
+	if strings.Contains(str, "\n") || len(str) > maxInlineBlock {
+		return "", false
+	}
+	return str, true
+}
+
+// expression prints e, in parentheses if it binds less tightly than minPrecedence
+func (p *printer) expression(e ast.Expression, minPrecedence int) {
+	if precedence(e) < minPrecedence {
+		p.print("(")
+		p.expression(e, parser.LOWEST)
+		p.print(")")
+		return
+	}
+
+	switch e := e.(type) {
+
+	case *ast.Identifier:
+		p.print(e.Value)
+
+	case *ast.IntegerLiteral:
+		p.print(e.Value)
+
+	case *ast.Boolean:
+		p.print(e.Value)
+
+	case *ast.StringLiteral:
+		p.print(`"`, e.Value, `"`)
+
+	case *ast.PrefixExpression:
+		p.print(e.Operator)
+		p.expression(e.Right, parser.PREFIX)
+
+	case *ast.InfixExpression:
+		prec := precedence(e)
+		p.expression(e.Left, prec)
+		p.print(" ", e.Operator, " ")
+		p.expression(e.Right, prec+1) // infix operators are left associative
+
+	case *ast.IfExpression:
+		p.print("if (")
+		p.expression(e.Condition, parser.LOWEST)
+		p.print(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.print(" else ")
+			p.block(e.Alternative)
+		}
+
+	case *ast.TryExpression:
+		p.print("try ")
+		p.block(e.Block)
+		p.print(" catch (", e.Param.Value, ") ")
+		p.block(e.Handler)
+
+	case *ast.FunctionLiteral:
+		p.print("fn")
+		p.parameters(e.Parameters)
+		p.print(" ")
+		p.block(e.Body)
+
+	case *ast.MacroLiteral:
+		p.print("macro")
+		p.parameters(e.Parameters)
+		p.print(" ")
+		p.block(e.Body)
+
+	case *ast.CallExpression:
+		p.expression(e.Function, parser.CALL)
+		p.print("(")
+		p.expressions(e.Arguments)
+		p.print(")")
+
+	case *ast.ArrayLiteral:
+		p.print("[")
+		p.expressions(e.Elements)
+		p.print("]")
+
+	case *ast.IndexExpression:
+		p.expression(e.Left, parser.CALL)
+		p.print("[")
+		p.expression(e.Index, parser.LOWEST)
+		p.print("]")
+
+	case *ast.SliceExpression:
+		p.expression(e.Left, parser.CALL)
+		p.print("[")
+		if e.Start != nil {
+			p.expression(e.Start, parser.LOWEST)
+		}
+		p.print(":")
+		if e.End != nil {
+			p.expression(e.End, parser.LOWEST)
+		}
+		p.print("]")
+
+	case *ast.HashLiteral:
+		p.print("{")
+		for i, key := range ast.SortedKeys(e) {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.expression(key, parser.LOWEST)
+			p.print(": ")
+			p.expression(e.Pairs[key], parser.LOWEST)
+		}
+		p.print("}")
+	}
+}
+
+func (p *printer) expressions(expressions []ast.Expression) {
+	for i, e := range expressions {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.expression(e, parser.LOWEST)
+	}
+}
+
+func (p *printer) parameters(parameters []*ast.Identifier) {
+	p.print("(")
+	for i, param := range parameters {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.print(param.Value)
+	}
+	p.print(")")
+}
+
+// precedence is the precedence of the operator e has been built by, as in the parser;
+// literals and expressions enclosed by keywords or brackets bind most tightly
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		switch e.Operator {
+		case "==", "!=":
+			return parser.EQUALS
+		case "<", ">":
+			return parser.LESSGREATER
+		case "+", "-":
+			return parser.SUM
+		case "*", "/":
+			return parser.PRODUCT
+		}
+		return parser.LOWEST
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression, *ast.IndexExpression, *ast.SliceExpression:
+		return parser.CALL
+	default:
+		return parser.INDEX + 1
+	}
+}
@@ -0,0 +1,172 @@
+package formatter
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"reflect"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1 + 2 * 3", "let x = 1 + 2 * 3;"},
+		{"let x = (1 + 2) * 3;", "let x = (1 + 2) * 3;"},
+		{"((a - b) - c)", "a - b - c"},
+		{"a - (b - c)", "a - (b - c)"},
+		{"a + (b + c)", "a + (b + c)"},
+		{"(a < b) == (c > d)", "a < b == c > d"},
+		{"a < (b == c)", "a < (b == c)"},
+		{"-(a + b)", "-(a + b)"},
+		{"-a * b", "-a * b"},
+		{"-(a * b)", "-(a * b)"},
+		{"!(-a)", "!-a"},
+		{"-f(x)[0]", "-f(x)[0]"},
+		{"(-f)(x)", "(-f)(x)"},
+		{"(a + b)[0]", "(a + b)[0]"},
+		{"f(x)(y)[1:]", "f(x)(y)[1:]"},
+		{`arr[:2]; arr[1:2]; arr[:]`, "arr[:2];\narr[1:2];\narr[:]"},
+		{`[1,2,   3]`, "[1, 2, 3]"},
+		{`{"b" :1, "a": 2 }`, `{"b": 1, "a": 2}`},
+		{`{}`, `{}`},
+		{"007 + 1", "7 + 1"},
+		{"true; false", "true;\nfalse"},
+		{"return 1", "return 1;"},
+		{"fn() {}", "fn() {}"},
+		{"fn(x, y) { x + y; }", "fn(x, y) { x + y }"},
+		{"fn(x) { return x; }", "fn(x) { return x; }"},
+		{"fn(x) { let y = x; y }", "fn(x) {\n  let y = x;\n  y\n}"},
+		{
+			"let f = fn(x) { fn(y) { let z = x + y; z * 2 } };",
+			"let f = fn(x) {\n  fn(y) {\n    let z = x + y;\n    z * 2\n  }\n};",
+		},
+		{
+			"if (x > 1) { x } else { let y = 2; y }",
+			"if (x > 1) { x } else {\n  let y = 2;\n  y\n}",
+		},
+		{"if (x) { 1 }", "if (x) { 1 }"},
+		{
+			`try { throw("a") } catch (e) { e }`,
+			`try { throw("a") } catch (e) { e }`,
+		},
+		{
+			`fn() { puts("a rather long string that does not fit") }`,
+			"fn() {\n  puts(\"a rather long string that does not fit\")\n}",
+		},
+		{"macro(a, b) { quote(unquote(b) - unquote(a)) }", "macro(a, b) { quote(unquote(b) - unquote(a)) }"},
+		{"fn(x) { x }(1)", "fn(x) { x }(1)"},
+		{"if (a) { f } else { g }(1) + 1", "if (a) { f } else { g }(1) + 1"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+
+		formatted := Format(program)
+		if formatted != tt.expected {
+			t.Errorf("wrong format of %q.\nwant=\n%s\ngot=\n%s", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	formatted, err := Source("let x=1;x")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if formatted != "let x = 1;\nx\n" {
+		t.Errorf("wrong format. got=%q", formatted)
+	}
+
+	if _, err := Source("let = 1"); err == nil {
+		t.Errorf("no error for invalid source")
+	}
+}
+
+var roundTripInputs = []string{
+	"let x = 1 + 2 * 3 - 4 / 5;",
+	"1 + (2 + (3 + 4)) * ((5 - 6) - 7)",
+	"!(true == (1 < 2)) != false",
+	"-(-(1)) - -1",
+	"a * [1, 2, 3, 4][b * c] * d",
+	`add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))`,
+	"add(a + b + c * d / f + g)",
+	`let map = fn(arr, f) {
+		let iter = fn(arr, accumulated) {
+			if (len(arr) == 0) { accumulated } else { iter(rest(arr), push(accumulated, f(first(arr)))); }
+		};
+		iter(arr, []);
+	};
+	map([1, 2, 3], fn(x) { x * 2 })`,
+	`let h = {"one": 1, "two": fn(x) { let y = x; y }, true: [1, 2][0:1], 3: {}}; h["two"](2)`,
+	`let s = "abc"[1:]; s[:1] + s[-1]`,
+	`try { let x = throw({"code": 1}); x } catch (e) { if (e["code"] == 1) { return 2; } }`,
+	`let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) }; unless(1 > 2, 3, 4)`,
+	`fn(x) { fn(y) { x + y } }(1)(2)`,
+	`if (if (a) { b } else { c }) { (fn() { 1 })() }`,
+	`let f = fn() { return 1; 2 }`,
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, input := range roundTripInputs {
+		program := parse(t, input)
+		formatted := Format(program)
+
+		reparsed := parse(t, formatted)
+		if !reflect.DeepEqual(shape(program), shape(reparsed)) {
+			t.Errorf("formatting %q changes the ast.\nformatted=\n%s\nwant=%v\ngot= %v",
+				input, formatted, shape(program), shape(reparsed))
+		}
+
+		if again := Format(reparsed); again != formatted {
+			t.Errorf("formatting is not idempotent for %q.\nfirst=\n%s\nsecond=\n%s", input, formatted, again)
+		}
+	}
+}
+
+// shape lists the nodes of an ast in the order of the input without their tokens
+func shape(node ast.Node) []string {
+	nodes := []string{}
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case nil:
+			nodes = append(nodes, ")")
+			return true
+		case *ast.Identifier:
+			nodes = append(nodes, "ident "+node.Value)
+		case *ast.IntegerLiteral:
+			nodes = append(nodes, fmt.Sprintf("int %d", node.Value))
+		case *ast.StringLiteral:
+			nodes = append(nodes, "string "+node.Value)
+		case *ast.Boolean:
+			nodes = append(nodes, fmt.Sprintf("bool %t", node.Value))
+		case *ast.PrefixExpression:
+			nodes = append(nodes, "prefix "+node.Operator)
+		case *ast.InfixExpression:
+			nodes = append(nodes, "infix "+node.Operator)
+		case *ast.SliceExpression:
+			nodes = append(nodes, fmt.Sprintf("slice %t %t", node.Start != nil, node.End != nil))
+		case *ast.IfExpression:
+			nodes = append(nodes, fmt.Sprintf("if %t", node.Alternative != nil))
+		default:
+			nodes = append(nodes, fmt.Sprintf("%T", node))
+		}
+		nodes = append(nodes, "(")
+		return true
+	})
+	return nodes
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
@@ -7,19 +7,25 @@ type Lexer struct {
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
 	ch           byte // current char under examination
+	line         int  // line of current char, starting at 1
+	column       int  // column of current char, starting at 1
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
-func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
-
+func (l *Lexer) NextToken() (tok token.Token) {
 	l.skipWhitespace()
 
+	line, column := l.line, l.column
+	defer func() { // every token is marked with the position of its first char
+		tok.Line = line
+		tok.Column = column
+	}()
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -100,6 +106,12 @@ func (l *Lexer) skipWhitespace() {
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
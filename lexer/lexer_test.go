@@ -30,6 +30,7 @@ if (5 < 10) {
 "foo bar"
 [1, 2];
 {"foo": "bar"}
+macro(x, y) { x + y; };
 `
 
 	tests := []struct {
@@ -122,6 +123,19 @@ if (5 < 10) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.MACRO, "macro"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COMMA, ","},
+		{token.IDENT, "y"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.IDENT, "y"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
 		{token.EOF, ""},
 	}
 
@@ -141,3 +155,55 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let five = 5;
+let s = "a b";
+  try { x } catch (e) { e }
+`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 10},
+		{token.INT, 1, 12},
+		{token.SEMICOLON, 1, 13},
+		{token.LET, 2, 1},
+		{token.IDENT, 2, 5},
+		{token.ASSIGN, 2, 7},
+		{token.STRING, 2, 9},
+		{token.SEMICOLON, 2, 14},
+		{token.TRY, 3, 3},
+		{token.LBRACE, 3, 7},
+		{token.IDENT, 3, 9},
+		{token.RBRACE, 3, 11},
+		{token.CATCH, 3, 13},
+		{token.LPAREN, 3, 19},
+		{token.IDENT, 3, 20},
+		{token.RPAREN, 3, 21},
+		{token.LBRACE, 3, 23},
+		{token.IDENT, 3, 25},
+		{token.RBRACE, 3, 27},
+		{token.EOF, 4, 1},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position of %q wrong. expected=%d:%d, got=%d:%d",
+				i, tok.Literal, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
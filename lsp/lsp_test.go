@@ -0,0 +1,244 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client talks to a server over pipes
+type client struct {
+	t             *testing.T
+	w             io.WriteCloser
+	id            int
+	msgs          chan map[string]interface{}
+	notifications []map[string]interface{} // received while waiting for responses
+	done          chan error
+}
+
+func newClient(t *testing.T) *client {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	c := &client{t: t, w: clientW, msgs: make(chan map[string]interface{}, 100), done: make(chan error, 1)}
+	go func() {
+		c.done <- NewServer(serverR, serverW).Serve()
+		serverW.Close()
+	}()
+	go func() {
+		r := bufio.NewReader(clientR)
+		for {
+			content, err := readMessage(r)
+			if err != nil {
+				close(c.msgs)
+				return
+			}
+			var msg map[string]interface{}
+			json.Unmarshal(content, &msg)
+			c.msgs <- msg
+		}
+	}()
+	return c
+}
+
+func (c *client) next() map[string]interface{} {
+	select {
+	case msg, ok := <-c.msgs:
+		if !ok {
+			c.t.Fatal("server closed the connection")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("no message from the server")
+	}
+	return nil
+}
+
+// request returns the response to a request
+func (c *client) request(method string, params interface{}) map[string]interface{} {
+	c.id++
+	writeMessage(c.w, map[string]interface{}{"jsonrpc": "2.0", "id": c.id, "method": method, "params": params})
+	for {
+		msg := c.next()
+		if _, ok := msg["method"]; ok {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		if msg["id"] == float64(c.id) {
+			return msg
+		}
+	}
+}
+
+// result returns the result of a request, which must be successful
+func (c *client) result(method string, params interface{}) interface{} {
+	msg := c.request(method, params)
+	if msg["error"] != nil {
+		c.t.Fatalf("%s failed: %v", method, msg["error"])
+	}
+	return msg["result"]
+}
+
+func (c *client) notify(method string, params interface{}) {
+	writeMessage(c.w, map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// diagnostics returns the next diagnostics published
+func (c *client) diagnostics() []interface{} {
+	for {
+		var msg map[string]interface{}
+		if len(c.notifications) > 0 {
+			msg, c.notifications = c.notifications[0], c.notifications[1:]
+		} else {
+			msg = c.next()
+		}
+		if msg["method"] == "textDocument/publishDiagnostics" {
+			return msg["params"].(map[string]interface{})["diagnostics"].([]interface{})
+		}
+	}
+}
+
+const uri = "file:///program.mk"
+
+func (c *client) open(text string) []interface{} {
+	c.result("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	c.notify("initialized", map[string]interface{}{})
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "monkey", "version": 1, "text": text},
+	})
+	return c.diagnostics()
+}
+
+func at(line, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     map[string]interface{}{"line": line, "character": character},
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newClient(t)
+	diagnostics := c.open("let x = 1;\nlet = 2;\n")
+
+	if len(diagnostics) == 0 {
+		t.Fatalf("expected a parse error")
+	}
+	d := diagnostics[0].(map[string]interface{})
+	start := d["range"].(map[string]interface{})["start"].(map[string]interface{})
+	if d["severity"] != 1.0 || start["line"] != 1.0 || d["code"] == nil {
+		t.Errorf("wrong diagnostic: %v", d)
+	}
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []map[string]interface{}{{"text": "let x = 1;\nlet y = fn(x) { x };\nz\n"}},
+	})
+	diagnostics = c.diagnostics()
+	messages := []string{}
+	for _, d := range diagnostics {
+		messages = append(messages, d.(map[string]interface{})["message"].(string))
+	}
+	if len(diagnostics) != 2 || !strings.Contains(messages[0], "shadows") || messages[1] != "identifier not found: z" {
+		t.Errorf("wrong diagnostics of the resolver: %v", messages)
+	}
+	r := diagnostics[1].(map[string]interface{})["range"].(map[string]interface{})
+	if r["start"].(map[string]interface{})["line"] != 2.0 || r["end"].(map[string]interface{})["character"] != 1.0 {
+		t.Errorf("wrong range: %v", r)
+	}
+
+	c.notify("textDocument/didClose", map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}})
+	if diagnostics := c.diagnostics(); len(diagnostics) != 0 {
+		t.Errorf("expected the diagnostics to be cleared, got %v", diagnostics)
+	}
+}
+
+func TestHoverAndDefinition(t *testing.T) {
+	c := newClient(t)
+	c.open("let add = fn(a, b) { a + b };\nlet n = add(1, 2);\nlen([n])\n")
+
+	tests := []struct {
+		line, character int
+		hover           []string
+		definition      []float64 // line and character, nil if none
+	}{
+		{1, 9, []string{"let add: FUNCTION(INTEGER, INTEGER) -> INTEGER", "bound at 1:5"}, []float64{0, 4}},
+		{0, 21, []string{"parameter a\n", "bound at 1:14"}, []float64{0, 13}},
+		{0, 5, []string{"let add"}, []float64{0, 4}},
+		{2, 1, []string{"builtin len"}, nil},
+		{2, 5, []string{"let n: INTEGER"}, []float64{1, 4}},
+	}
+
+	for _, tt := range tests {
+		result, ok := c.result("textDocument/hover", at(tt.line, tt.character)).(map[string]interface{})
+		if !ok {
+			t.Errorf("no hover at %d:%d", tt.line, tt.character)
+			continue
+		}
+		value := result["contents"].(map[string]interface{})["value"].(string)
+		for _, s := range tt.hover {
+			if !strings.Contains(value, s) {
+				t.Errorf("hover at %d:%d does not contain %q: %q", tt.line, tt.character, s, value)
+			}
+		}
+
+		definition := c.result("textDocument/definition", at(tt.line, tt.character))
+		if tt.definition == nil {
+			if definition != nil {
+				t.Errorf("expected no definition at %d:%d, got %v", tt.line, tt.character, definition)
+			}
+			continue
+		}
+		location, ok := definition.(map[string]interface{})
+		if !ok {
+			t.Errorf("no definition at %d:%d", tt.line, tt.character)
+			continue
+		}
+		start := location["range"].(map[string]interface{})["start"].(map[string]interface{})
+		if location["uri"] != uri || start["line"] != tt.definition[0] || start["character"] != tt.definition[1] {
+			t.Errorf("wrong definition at %d:%d: %v", tt.line, tt.character, location)
+		}
+	}
+
+	if result := c.result("textDocument/hover", at(0, 0)); result != nil {
+		t.Errorf("expected no hover on a keyword, got %v", result)
+	}
+}
+
+func TestCompletionAndShutdown(t *testing.T) {
+	c := newClient(t)
+	c.open("")
+
+	items := c.result("textDocument/completion", at(0, 0)).([]interface{})
+	labels := map[string]string{}
+	for _, item := range items {
+		item := item.(map[string]interface{})
+		labels[item["label"].(string)], _ = item["detail"].(string)
+	}
+	for _, name := range []string{"len", "puts", "first", "push"} {
+		if _, ok := labels[name]; !ok {
+			t.Errorf("builtin %s is not offered, got %v", name, labels)
+		}
+	}
+	if !strings.Contains(labels["len"], "INTEGER") {
+		t.Errorf("wrong detail of len: %q", labels["len"])
+	}
+
+	if msg := c.request("textDocument/unknown", nil); msg["error"] == nil {
+		t.Errorf("expected an error for an unknown method, got %v", msg)
+	}
+
+	if msg := c.request("shutdown", nil); msg["error"] != nil || msg["result"] != nil {
+		t.Errorf("wrong response to shutdown: %v", msg)
+	}
+	c.notify("exit", nil)
+	select {
+	case err := <-c.done:
+		if err != nil {
+			t.Errorf("Serve returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server did not exit")
+	}
+}
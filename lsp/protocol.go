@@ -0,0 +1,162 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+/*
+The messages of the Language Server Protocol are JSON-RPC 2.0 objects, each
+preceded by a header with its length:
+
+	Content-Length: 113\r\n
+	\r\n
+	{"jsonrpc": "2.0", "id": 1, "method": "textDocument/hover", "params": {...}}
+
+Requests have an id and are answered with a response of the same id;
+notifications have none. Only the fields used by this server are declared.
+*/
+
+type message struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"` // a number or a string
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// a response has either a result, which may be null, or an error
+
+type response struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result"`
+}
+
+type errorResponse struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Error   responseError   `json:"error"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	invalidParams  = -32602
+	methodNotFound = -32601
+	invalidRequest = -32600 // requests after shutdown
+)
+
+type notification struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// positions are zero-based, unlike those of tokens
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type span struct { // Range in the protocol
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type location struct {
+	Uri   string `json:"uri"`
+	Range span   `json:"range"`
+}
+
+// parameters of requests and notifications
+
+type textDocumentIdentifier struct {
+	Uri string `json:"uri"`
+}
+
+type didOpenParams struct {
+	TextDocument struct {
+		Uri  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"` // the whole text, as the documents are synchronized in full
+	} `json:"contentChanges"`
+}
+
+type didCloseParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     position               `json:"position"`
+}
+
+// parts of results
+
+type diagnostic struct {
+	Range    span   `json:"range"`
+	Severity int    `json:"severity"` // 1 error, 2 warning
+	Code     string `json:"code,omitempty"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+type markupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type hover struct {
+	Contents markupContent `json:"contents"`
+	Range    span          `json:"range"`
+}
+
+type completionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"` // 3 function
+	Detail string `json:"detail,omitempty"`
+}
+
+// readMessage reads the content of the next message
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %v", err)
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+func writeMessage(w io.Writer, msg interface{}) error {
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(content)); err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
@@ -0,0 +1,303 @@
+// Package lsp implements a server of the Language Server Protocol, so that editors
+// can check Monkey programs as they are typed. The documents are parsed on each change;
+// parse errors and the diagnostics of the resolver are published, identifiers can be
+// hovered over and followed to their bindings, and builtins are offered for completion.
+// Positions are counted in bytes, which suffices for programs in ASCII.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/resolver"
+	"monkey/types"
+)
+
+type Server struct {
+	in       *bufio.Reader
+	out      io.Writer
+	docs     map[string]*document // by uri
+	shutdown bool                 // the shutdown request has been received
+}
+
+// document is an open text document; bindings and info are only known
+// while the program can be parsed
+type document struct {
+	uri      string
+	program  *ast.Program
+	errors   []*parser.ParseError
+	bindings map[*ast.Identifier]resolver.Binding
+	info     *types.Info
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: make(map[string]*document),
+	}
+}
+
+// Serve answers requests until the exit notification or the end of the input
+func (s *Server) Serve() error {
+	for {
+		content, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(content, &msg); err != nil {
+			return err
+		}
+		if msg.Method == "" { // a response to a request of the server
+			continue
+		}
+		if !s.handle(msg) {
+			return nil
+		}
+	}
+}
+
+// handle answers a request or takes note of a notification;
+// it reports whether further messages are to be served
+func (s *Server) handle(msg message) bool {
+	if s.shutdown && msg.Method != "exit" {
+		s.fail(msg, invalidRequest, "the server has been shut down")
+		return true
+	}
+	switch msg.Method {
+	case "initialize":
+		s.respond(msg, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // full
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]interface{}{},
+			},
+			"serverInfo": map[string]interface{}{"name": "monkey"},
+		})
+	case "initialized":
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := s.decode(msg, &params); err == nil {
+			s.update(params.TextDocument.Uri, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := s.decode(msg, &params); err == nil && len(params.ContentChanges) > 0 {
+			changes := params.ContentChanges
+			s.update(params.TextDocument.Uri, changes[len(changes)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := s.decode(msg, &params); err == nil {
+			delete(s.docs, params.TextDocument.Uri)
+			s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+				"uri":         params.TextDocument.Uri,
+				"diagnostics": []diagnostic{},
+			})
+		}
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := s.decode(msg, &params); err == nil {
+			s.hover(msg, params)
+		}
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := s.decode(msg, &params); err == nil {
+			s.definition(msg, params)
+		}
+	case "textDocument/completion":
+		s.completion(msg)
+	case "shutdown":
+		s.shutdown = true
+		s.respond(msg, nil)
+	case "exit":
+		return false
+	default:
+		if msg.Id != nil {
+			s.fail(msg, methodNotFound, "unsupported method "+msg.Method)
+		}
+	}
+	return true
+}
+
+// messages
+
+func (s *Server) respond(msg message, result interface{}) {
+	writeMessage(s.out, &response{Jsonrpc: "2.0", Id: msg.Id, Result: result})
+}
+
+func (s *Server) fail(msg message, code int, message string) {
+	if msg.Id == nil { // notifications are not answered
+		return
+	}
+	writeMessage(s.out, &errorResponse{Jsonrpc: "2.0", Id: msg.Id, Error: responseError{Code: code, Message: message}})
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	writeMessage(s.out, &notification{Jsonrpc: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) decode(msg message, params interface{}) error {
+	err := json.Unmarshal(msg.Params, params)
+	if err != nil {
+		s.fail(msg, invalidParams, err.Error())
+	}
+	return err
+}
+
+// documents
+
+// update parses the text of a document and publishes its diagnostics
+func (s *Server) update(uri, text string) {
+	p := parser.New(lexer.New(text))
+	doc := &document{uri: uri, program: p.ParseProgram(), errors: p.Errors()}
+	if len(doc.errors) == 0 {
+		doc.bindings = resolver.Resolve(doc.program)
+		doc.info = types.Infer(doc.program)
+	}
+	s.docs[uri] = doc
+
+	s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri":         uri,
+		"diagnostics": doc.diagnostics(),
+	})
+}
+
+// diagnostics returns the parse errors or, if there are none, the diagnostics of the resolver
+func (doc *document) diagnostics() []diagnostic {
+	diagnostics := []diagnostic{}
+	for _, err := range doc.errors {
+		message := err.Message
+		if err.Hint != "" {
+			message += "\n" + err.Hint
+		}
+		diagnostics = append(diagnostics, diagnostic{
+			Range:    spanOf(err.Span.Line, err.Span.Column, err.Span.Length),
+			Severity: 1,
+			Code:     string(err.Code),
+			Source:   "monkey",
+			Message:  message,
+		})
+	}
+	if len(doc.errors) != 0 {
+		return diagnostics
+	}
+
+	for _, d := range resolver.Check(doc.program) {
+		length := 1
+		if ident := doc.identAt(d.Line, d.Column); ident != nil {
+			length = len(ident.Value)
+		}
+		severity := 1
+		if d.Severity == resolver.Warning {
+			severity = 2
+		}
+		diagnostics = append(diagnostics, diagnostic{
+			Range:    spanOf(d.Line, d.Column, length),
+			Severity: severity,
+			Source:   "monkey",
+			Message:  d.Message,
+		})
+	}
+	return diagnostics
+}
+
+// identAt returns the identifier at the one-based line and column, or nil
+func (doc *document) identAt(line, column int) *ast.Identifier {
+	var found *ast.Identifier
+	ast.Inspect(doc.program, func(node ast.Node) bool {
+		if found != nil {
+			return false
+		}
+		if ident, ok := node.(*ast.Identifier); ok {
+			tok := ident.Token
+			if tok.Line == line && tok.Column <= column && column < tok.Column+len(ident.Value) {
+				found = ident
+			}
+		}
+		return true
+	})
+	return found
+}
+
+// spanOf returns the range of length characters from the one-based line and column
+func spanOf(line, column, length int) span {
+	start := position{Line: line - 1, Character: column - 1}
+	return span{Start: start, End: position{Line: start.Line, Character: start.Character + length}}
+}
+
+func identSpan(ident *ast.Identifier) span {
+	return spanOf(ident.Token.Line, ident.Token.Column, len(ident.Value))
+}
+
+// lookup returns the identifier at a position of a document and its binding
+func (s *Server) lookup(params textDocumentPositionParams) (*document, *ast.Identifier, resolver.Binding, bool) {
+	doc, ok := s.docs[params.TextDocument.Uri]
+	if !ok || doc.bindings == nil {
+		return nil, nil, resolver.Binding{}, false
+	}
+	ident := doc.identAt(params.Position.Line+1, params.Position.Character+1)
+	if ident == nil {
+		return nil, nil, resolver.Binding{}, false
+	}
+	b, ok := doc.bindings[ident]
+	return doc, ident, b, ok
+}
+
+// requests
+
+// hover shows the binding of an identifier and its type, if more than a type variable has been inferred
+func (s *Server) hover(msg message, params textDocumentPositionParams) {
+	doc, ident, b, ok := s.lookup(params)
+	if !ok {
+		s.respond(msg, nil)
+		return
+	}
+	value := fmt.Sprintf("```monkey\n%s %s", b.Kind, ident.Value)
+	if t, ok := doc.info.TypeOf(ident); ok && !isVar(t) {
+		value += ": " + t.String()
+	}
+	value += "\n```"
+	if b.Ident != nil && b.Ident != ident {
+		value += fmt.Sprintf("\nbound at %d:%d", b.Ident.Token.Line, b.Ident.Token.Column)
+	}
+	s.respond(msg, hover{Contents: markupContent{Kind: "markdown", Value: value}, Range: identSpan(ident)})
+}
+
+func isVar(t types.Type) bool {
+	_, ok := t.(*types.Var)
+	return ok
+}
+
+// definition jumps to the let or parameter that binds an identifier
+func (s *Server) definition(msg message, params textDocumentPositionParams) {
+	doc, _, b, ok := s.lookup(params)
+	if !ok || b.Ident == nil {
+		s.respond(msg, nil)
+		return
+	}
+	s.respond(msg, location{Uri: doc.uri, Range: identSpan(b.Ident)})
+}
+
+// completion offers the builtins; the client filters them by what has been typed
+func (s *Server) completion(msg message) {
+	items := []completionItem{}
+	for _, name := range evaluator.BuiltinNames() {
+		item := completionItem{Label: name, Kind: 3}
+		if t := types.Infer(&ast.Identifier{Value: name}).Type; t != nil {
+			item.Detail = t.String()
+		}
+		items = append(items, item)
+	}
+	s.respond(msg, items)
+}
@@ -1,13 +1,39 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"monkey/dap"
+	"monkey/evaluator"
+	"monkey/formatter"
+	"monkey/lexer"
+	"monkey/lsp"
+	"monkey/object"
+	"monkey/parser"
 	"monkey/session"
+	"monkey/visualizer"
+	"net"
 	"os"
 	"os/user"
+	"strings"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(runFmt(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "json" {
+		os.Exit(runJson(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "dap" {
+		os.Exit(runDap(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lsp" {
+		os.Exit(runLsp(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -20,3 +46,195 @@ func main() {
 		panic(err)
 	}
 }
+
+// runFmt implements the subcommand `fmt [-w] [files]`:
+// it formats the given files, or the standard input if there are none,
+// and prints the results or, given -w, writes them back to the files.
+func runFmt(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false, "write the result to the source file instead of printing it")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: monkey fmt [-w] [files]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(stderr, "cannot use -w with standard input")
+			return 2
+		}
+		src, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		formatted, err := formatter.Source(string(src))
+		if err != nil {
+			fmt.Fprintf(stderr, "<standard input> %v\n", err)
+			return 1
+		}
+		fmt.Fprint(stdout, formatted)
+		return 0
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			status = 1
+			continue
+		}
+		formatted, err := formatter.Source(string(src))
+		if err != nil {
+			fmt.Fprintf(stderr, "%s %v\n", path, err)
+			status = 1
+			continue
+		}
+		if !*write {
+			fmt.Fprint(stdout, formatted)
+			continue
+		}
+		if formatted == string(src) {
+			continue
+		}
+		if err := ioutil.WriteFile(path, []byte(formatted), 0644); err != nil {
+			fmt.Fprintln(stderr, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// runJson implements the subcommand `json [-eval] [files]`:
+// it prints the asts of the given files, or of the standard input if there are none,
+// as JSON or, given -eval, the traces of their evaluations.
+func runJson(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("json", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	eval := flags.Bool("eval", false, "print the trace of the evaluation instead of the ast")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: monkey json [-eval] [files]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	convert := func(src string) (string, error) {
+		p := parser.New(lexer.New(src))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			msgs := []string{}
+			for _, err := range p.Errors() {
+				msgs = append(msgs, err.Position()+": "+err.Error())
+			}
+			return "", fmt.Errorf("cannot be parsed:\n\t%s", strings.Join(msgs, "\n\t"))
+		}
+		if !*eval {
+			return visualizer.JsonParseTree(program)
+		}
+		_, trace := evaluator.EvalT(program, object.NewEnvironment(), true)
+		return visualizer.JsonEvalTrace(trace)
+	}
+
+	if flags.NArg() == 0 {
+		src, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		json, err := convert(string(src))
+		if err != nil {
+			fmt.Fprintf(stderr, "<standard input> %v\n", err)
+			return 1
+		}
+		fmt.Fprintln(stdout, json)
+		return 0
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			status = 1
+			continue
+		}
+		json, err := convert(string(src))
+		if err != nil {
+			fmt.Fprintf(stderr, "%s %v\n", path, err)
+			status = 1
+			continue
+		}
+		fmt.Fprintln(stdout, json)
+	}
+	return status
+}
+
+// runDap implements the subcommand `dap [-port n]`:
+// it serves the Debug Adapter Protocol on the standard input and output
+// or, given a port, to the first client connecting to it.
+func runDap(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("dap", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	port := flags.Int("port", 0, "listen on this port of localhost instead of using the standard input and output")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: monkey dap [-port n]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *port == 0 {
+		if err := dap.NewServer(stdin, stdout).Serve(); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", *port))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer listener.Close()
+	fmt.Fprintf(stderr, "listening on %v\n", listener.Addr())
+	conn, err := listener.Accept()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer conn.Close()
+	if err := dap.NewServer(conn, conn).Serve(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runLsp implements the subcommand `lsp`:
+// it serves the Language Server Protocol on the standard input and output
+func runLsp(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: monkey lsp")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := lsp.NewServer(stdin, stdout).Serve(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -1,6 +1,15 @@
 package main
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 func TestFake(t *testing.T) {
 	if 1-0 == 1+0 {
@@ -9,3 +18,133 @@ func TestFake(t *testing.T) {
 		t.Errorf("oh no")
 	}
 }
+
+func TestFmtStdin(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	status := runFmt(nil, strings.NewReader("let f=fn(x){x+1};f(2)"), &stdout, &stderr)
+	if status != 0 {
+		t.Fatalf("status %d, stderr: %s", status, stderr.String())
+	}
+
+	expected := "let f = fn(x) { x + 1 };\nf(2)\n"
+	if stdout.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, stdout.String())
+	}
+}
+
+func TestFmtInvalidInput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	status := runFmt(nil, strings.NewReader("let = 1"), &stdout, &stderr)
+	if status != 1 {
+		t.Errorf("wrong status. want=1, got=%d", status)
+	}
+	if stdout.Len() != 0 || !strings.Contains(stderr.String(), "cannot be parsed") {
+		t.Errorf("wrong output. stdout=%q, stderr=%q", stdout.String(), stderr.String())
+	}
+}
+
+func TestFmtWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkeyfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "f.mky")
+	if err := ioutil.WriteFile(path, []byte("if(x){1}else{2}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if status := runFmt([]string{"-w", path}, nil, &stdout, &stderr); status != 0 {
+		t.Fatalf("status %d, stderr: %s", status, stderr.String())
+	}
+
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "if (x) { 1 } else { 2 }\n"
+	if string(written) != expected {
+		t.Errorf("wrong file content. want=%q, got=%q", expected, string(written))
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("unexpected output: %q", stdout.String())
+	}
+}
+
+func TestJsonStdin(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	status := runJson([]string{"-eval"}, strings.NewReader("let x = 1; x"), &stdout, &stderr)
+	if status != 0 {
+		t.Fatalf("status %d, stderr: %s", status, stderr.String())
+	}
+
+	var trace struct {
+		Ast   struct{ Type string }
+		Steps []struct{ Kind string }
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &trace); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, stdout.String())
+	}
+	if trace.Ast.Type != "Program" || len(trace.Steps) == 0 || trace.Steps[0].Kind != "call" {
+		t.Errorf("unexpected trace: %s", stdout.String())
+	}
+}
+
+func TestJsonInvalidInput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	status := runJson(nil, strings.NewReader("let = 1"), &stdout, &stderr)
+	if status != 1 {
+		t.Errorf("wrong status. want=1, got=%d", status)
+	}
+	if stdout.Len() != 0 || !strings.Contains(stderr.String(), "cannot be parsed") {
+		t.Errorf("wrong output. stdout=%q, stderr=%q", stdout.String(), stderr.String())
+	}
+}
+
+func TestDapStdio(t *testing.T) {
+	var stdin, stdout, stderr bytes.Buffer
+	for _, req := range []string{
+		`{"seq":1,"type":"request","command":"initialize","arguments":{"adapterID":"monkey"}}`,
+		`{"seq":2,"type":"request","command":"disconnect"}`,
+	} {
+		fmt.Fprintf(&stdin, "Content-Length: %d\r\n\r\n%s", len(req), req)
+	}
+
+	status := runDap(nil, &stdin, &stdout, &stderr)
+	if status != 0 {
+		t.Errorf("wrong status. want=0, got=%d, stderr=%q", status, stderr.String())
+	}
+	for _, expected := range []string{`"command":"initialize"`, `"event":"initialized"`, `"command":"disconnect"`} {
+		if !strings.Contains(stdout.String(), expected) {
+			t.Errorf("expected %s in output, got %q", expected, stdout.String())
+		}
+	}
+}
+
+func TestLspStdio(t *testing.T) {
+	var stdin, stdout, stderr bytes.Buffer
+	for _, msg := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"capabilities":{}}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.mk","text":"let = 1;"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	} {
+		fmt.Fprintf(&stdin, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+
+	status := runLsp(nil, &stdin, &stdout, &stderr)
+	if status != 0 {
+		t.Errorf("wrong status. want=0, got=%d, stderr=%q", status, stderr.String())
+	}
+	for _, expected := range []string{`"hoverProvider":true`, `"method":"textDocument/publishDiagnostics"`, `"id":2,"result":null`} {
+		if !strings.Contains(stdout.String(), expected) {
+			t.Errorf("expected %s in output, got %q", expected, stdout.String())
+		}
+	}
+}
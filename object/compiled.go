@@ -0,0 +1,77 @@
+package object
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+)
+
+const (
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+)
+
+// A SourcePosition maps the instructions from Offset on to a position in the input
+type SourcePosition struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// PositionAt returns the position of the instruction at offset ip
+func PositionAt(positions []SourcePosition, ip int) (int, int) {
+	line, column := 0, 0
+	for _, pos := range positions {
+		if pos.Offset > ip {
+			break
+		}
+		line, column = pos.Line, pos.Column
+	}
+	return line, column
+}
+
+// A CompiledFunction is a function literal compiled to bytecode;
+// the main function of a program has no literal.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	LocalNames    []string         // names of the locals by index
+	Positions     []SourcePosition // positions of the nodes the instructions have been compiled from
+	Callees       []SourcePosition // positions of the functions of calls
+	Literal       *ast.FunctionLiteral
+	Constants     []Object // the constants of the input the function has been compiled from
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// The local bindings of a function call
+type Locals struct {
+	Names []string
+	Slots []Object
+	Outer *Locals // the locals of the call the function has been created in
+}
+
+// The state shared by the virtual machines evaluating in the same environment:
+// the global bindings; the constants are kept by the compiled functions
+type Globals struct {
+	Names []string
+	Slots []Object
+}
+
+// A Closure is a function created by a virtual machine;
+// it has the Monkey type of functions created by the evaluator.
+type Closure struct {
+	Name    string // name of the first let binding, "" if anonymous
+	Fn      *CompiledFunction
+	Env     *Locals
+	Globals *Globals
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	function := &Function{Parameters: c.Fn.Literal.Parameters, Body: c.Fn.Literal.Body}
+	return function.Inspect()
+}
@@ -12,8 +12,18 @@ func NewEnvironment() *Environment {
 }
 
 type Environment struct {
-	Store map[string]Object
-	Outer *Environment
+	Store   map[string]Object
+	Outer   *Environment
+	version int // incremented by Set
+}
+
+// Version changes whenever a binding is set in e or its outer environments
+func (e *Environment) Version() int {
+	version := 0
+	for ; e != nil; e = e.Outer {
+		version += e.version
+	}
+	return version
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -26,5 +36,6 @@ func (e *Environment) Get(name string) (Object, bool) {
 
 func (e *Environment) Set(name string, val Object) Object {
 	e.Store[name] = val
+	e.version++
 	return val
 }
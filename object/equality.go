@@ -0,0 +1,72 @@
+package object
+
+// Equal reports whether a and b are structurally equal:
+// integers, booleans and strings are compared by value,
+// arrays and hashes element by element;
+// all other objects are only equal to themselves.
+func Equal(a, b Object) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil || a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value == b.(*Integer).Value
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value
+	case *String:
+		return a.Value == b.(*String).Value
+	case *Null:
+		return true
+	case *Array:
+		return arraysEqual(a, b.(*Array))
+	case *Hash:
+		return hashesEqual(a, b.(*Hash))
+	default:
+		return false
+	}
+}
+
+func arraysEqual(a, b *Array) bool {
+	if len(a.Elements) != len(b.Elements) {
+		return false
+	}
+	for i := range a.Elements {
+		if !Equal(a.Elements[i], b.Elements[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func hashesEqual(a, b *Hash) bool {
+	if len(a.Pairs) != len(b.Pairs) {
+		return false
+	}
+	for key, pair := range a.Pairs {
+		other, ok := b.Pairs[key]
+		if !ok || !Equal(pair.Key, other.Key) || !Equal(pair.Value, other.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsHashable reports whether obj can be used as a hash key;
+// arrays are hashable if all their elements are.
+func IsHashable(obj Object) bool {
+	if _, ok := obj.(Hashable); !ok {
+		return false
+	}
+	if array, ok := obj.(*Array); ok {
+		for _, e := range array.Elements {
+			if !IsHashable(e) {
+				return false
+			}
+		}
+	}
+	return true
+}
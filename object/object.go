@@ -2,6 +2,7 @@ package object
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"hash/fnv"
 	"monkey/ast"
@@ -21,12 +22,16 @@ const (
 	STRING_OBJ  = "STRING"
 
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	TAIL_CALL_OBJ    = "TAIL_CALL"
 
 	FUNCTION_OBJ = "FUNCTION"
 	BUILTIN_OBJ  = "BUILTIN"
 
 	ARRAY_OBJ = "ARRAY"
 	HASH_OBJ  = "HASH"
+
+	QUOTE_OBJ = "QUOTE"
+	MACRO_OBJ = "MACRO"
 )
 
 type HashKey struct {
@@ -83,14 +88,63 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// a call in tail position that is still to be applied
+type TailCall struct {
+	Function  Object
+	Arguments []Object
+	Call      *ast.CallExpression
+}
+
+func (tc *TailCall) Type() ObjectType { return TAIL_CALL_OBJ }
+func (tc *TailCall) Inspect() string  { return "tail call " + tc.Call.String() }
+
 type Error struct {
 	Message string
+	Value   Object       // the value passed to throw, nil for runtime errors
+	Line    int          // position of the node the error has been raised by
+	Column  int          //
+	Stack   []StackFrame // innermost frame first
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
+// frames printed at each end of long stack traces
+const stackTraceEnds = 10
+
+// StackTrace lists the frames of the Monkey call stack at the time the
+// error has been raised, one per line, innermost frame first.
+func (e *Error) StackTrace() string {
+	var out bytes.Buffer
+
+	for i, frame := range e.Stack {
+		if len(e.Stack) > 2*stackTraceEnds && i == stackTraceEnds {
+			out.WriteString(fmt.Sprintf("\t... %d more frames\n", len(e.Stack)-2*stackTraceEnds))
+		}
+		if len(e.Stack) > 2*stackTraceEnds && stackTraceEnds <= i && i < len(e.Stack)-stackTraceEnds {
+			continue
+		}
+		out.WriteString("\tat ")
+		out.WriteString(frame.String())
+		out.WriteString("\n")
+	}
+
+	return out.String()
+}
+
+// A StackFrame is an active function call or the top level of the input
+type StackFrame struct {
+	Function string // name of the function
+	Line     int    // current position within the function
+	Column   int
+}
+
+func (f StackFrame) String() string {
+	return fmt.Sprintf("%s (%d:%d)", f.Function, f.Line, f.Column)
+}
+
 type Function struct {
+	Name       string // name of the first let binding, "" if anonymous
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
@@ -140,6 +194,30 @@ type Array struct {
 }
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
+
+// HashKey returns a key of type ERROR if an element is not hashable;
+// such arrays are rejected by IsHashable before they are used as keys.
+func (ao *Array) HashKey() HashKey {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+
+	for _, e := range ao.Elements {
+		hashable, ok := e.(Hashable)
+		if !ok {
+			return HashKey{Type: ERROR_OBJ}
+		}
+		key := hashable.HashKey()
+		if key.Type == ERROR_OBJ {
+			return key
+		}
+		h.Write([]byte(key.Type))
+		binary.LittleEndian.PutUint64(buf, key.Value)
+		h.Write(buf)
+	}
+
+	return HashKey{Type: ao.Type(), Value: h.Sum64()}
+}
+
 func (ao *Array) Inspect() string {
 	var out bytes.Buffer
 
@@ -180,3 +258,37 @@ func (h *Hash) Inspect() string {
 
 	return out.String()
 }
+
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
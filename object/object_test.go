@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -58,3 +61,127 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestArrayHashKey(t *testing.T) {
+	one := &Integer{Value: 1}
+	two := &Integer{Value: 2}
+	str := &String{Value: "1"}
+
+	oneTwo1 := &Array{Elements: []Object{one, two}}
+	oneTwo2 := &Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}}}
+	twoOne := &Array{Elements: []Object{two, one}}
+	intOne := &Array{Elements: []Object{one}}
+	strOne := &Array{Elements: []Object{str}}
+	nested := &Array{Elements: []Object{oneTwo1}}
+
+	if oneTwo1.HashKey() != oneTwo2.HashKey() {
+		t.Errorf("arrays with same content have different hash keys")
+	}
+
+	if oneTwo1.HashKey() == twoOne.HashKey() {
+		t.Errorf("arrays with different order have same hash keys")
+	}
+
+	if intOne.HashKey() == strOne.HashKey() {
+		t.Errorf("arrays with elements of different types have same hash keys")
+	}
+
+	if nested.HashKey() == oneTwo1.HashKey() {
+		t.Errorf("nested array has same hash key as its element")
+	}
+
+	unhashable := &Array{Elements: []Object{one, &Array{Elements: []Object{&Hash{}}}}}
+	if key := unhashable.HashKey(); key.Type != ERROR_OBJ {
+		t.Errorf("array with an unhashable element has hash key %+v", key)
+	}
+}
+
+func TestIsHashable(t *testing.T) {
+	tests := []struct {
+		obj      Object
+		expected bool
+	}{
+		{&Integer{Value: 1}, true},
+		{&String{Value: "a"}, true},
+		{&Boolean{Value: true}, true},
+		{&Array{}, true},
+		{&Array{Elements: []Object{&Integer{Value: 1}, &Array{}}}, true},
+		{&Array{Elements: []Object{&Hash{}}}, false},
+		{&Array{Elements: []Object{&Array{Elements: []Object{&Null{}}}}}, false},
+		{&Hash{}, false},
+		{&Null{}, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsHashable(tt.obj); got != tt.expected {
+			t.Errorf("IsHashable(%s) wrong. got=%t, want=%t", tt.obj.Inspect(), got, tt.expected)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	hash := func(pairs ...Object) *Hash {
+		h := &Hash{Pairs: make(map[HashKey]HashPair)}
+		for i := 0; i < len(pairs); i += 2 {
+			h.Pairs[pairs[i].(Hashable).HashKey()] = HashPair{Key: pairs[i], Value: pairs[i+1]}
+		}
+		return h
+	}
+	one := &Integer{Value: 1}
+	a := &String{Value: "a"}
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 1}, true},
+		{&Integer{Value: 1}, &Integer{Value: 2}, false},
+		{&String{Value: "a"}, &String{Value: "a"}, true},
+		{&String{Value: "1"}, &Integer{Value: 1}, false},
+		{&Null{}, &Null{}, true},
+		{&Array{Elements: []Object{one, a}}, &Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "a"}}}, true},
+		{&Array{Elements: []Object{one}}, &Array{Elements: []Object{one, one}}, false},
+		{hash(a, one), hash(&String{Value: "a"}, &Integer{Value: 1}), true},
+		{hash(a, one), hash(a, &Integer{Value: 2}), false},
+		{hash(a, one), hash(), false},
+		{&Function{}, &Function{}, false},
+		{nil, nil, true},
+		{nil, one, false},
+	}
+
+	for _, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("Equal(%v, %v) wrong. got=%t, want=%t", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	err := &Error{
+		Message: "oops",
+		Stack: []StackFrame{
+			{Function: "f", Line: 2, Column: 5},
+			{Function: "<program>", Line: 4, Column: 1},
+		},
+	}
+
+	expected := "\tat f (2:5)\n\tat <program> (4:1)\n"
+	if err.StackTrace() != expected {
+		t.Errorf("err.StackTrace() wrong. want=%q, got=%q", expected, err.StackTrace())
+	}
+}
+
+func TestLongErrorStackTrace(t *testing.T) {
+	err := &Error{Message: "oops"}
+	for i := 1; i <= 25; i++ {
+		err.Stack = append(err.Stack, StackFrame{Function: "f", Line: i, Column: 1})
+	}
+
+	lines := strings.Split(strings.TrimSuffix(err.StackTrace(), "\n"), "\n")
+	if len(lines) != 21 {
+		t.Fatalf("wrong number of lines. want=21, got=%d:\n%s", len(lines), err.StackTrace())
+	}
+	if lines[9] != "\tat f (10:1)" || lines[10] != "\t... 5 more frames" || lines[11] != "\tat f (16:1)" {
+		t.Errorf("wrong elision of frames:\n%s", err.StackTrace())
+	}
+}
@@ -0,0 +1,429 @@
+package optimizer
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+)
+
+/*
+The optimizer rewrites asts such that they evaluate to the same values with less work:
+
+- constant folding: operators applied to literals are replaced by the literal they evaluate to,
+  e.g. `2 * 3 + 1` by `7` and `!(1 < 2)` by `false`; operations the evaluator rejects,
+  e.g. `1 + true` or a division by zero, are kept to fail at runtime
+- dead branch elimination: an if expression with a literal condition is replaced by the branch
+  that is taken; as a statement, the statements of the branch take its place, since blocks
+  bind in the scope they are part of
+- constant inlining: an identifier bound by a single let to a literal is replaced by the literal
+  wherever the let is known to have been evaluated; the let itself is kept, since its binding
+  may be used later, e.g. by further inputs of a session
+
+Scopes are those of the evaluator: programs, function bodies and catch blocks.
+Quoted asts and macros are left as they are.
+*/
+
+// Optimize returns the optimized version of node; node itself is not altered
+func Optimize(node ast.Node) ast.Node {
+	o := &optimizer{}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		o.open(nil, node)
+		optimized := *node
+		optimized.Statements = o.statements(node.Statements, true)
+		return &optimized
+	case ast.Statement:
+		o.open(nil, node)
+		statements := o.statements([]ast.Statement{node}, true)
+		if len(statements) == 1 {
+			return statements[0]
+		}
+		return &ast.BlockStatement{Token: token.Token{Type: token.LBRACE, Literal: "{"}, Statements: statements}
+	case ast.Expression:
+		o.open(nil, node)
+		return o.expression(node)
+	}
+	return node
+}
+
+type scope struct {
+	outer  *scope
+	lets   map[string]int            // number of bindings of each name within the scope
+	consts map[string]ast.Expression // the literals of the lets known to have been evaluated
+}
+
+type optimizer struct {
+	scope *scope
+}
+
+// open enters the scope of node binding params
+func (o *optimizer) open(params []*ast.Identifier, node ast.Node) {
+	s := &scope{outer: o.scope, lets: make(map[string]int), consts: make(map[string]ast.Expression)}
+	for _, param := range params {
+		s.lets[param.Value]++
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+			return false
+		case *ast.TryExpression: // the catch block has its own scope
+			ast.Inspect(n.Block, func(n ast.Node) bool {
+				if let, ok := n.(*ast.LetStatement); ok {
+					s.lets[let.Name.Value]++
+				}
+				_, fn := n.(*ast.FunctionLiteral)
+				return !fn
+			})
+			return false
+		case *ast.CallExpression:
+			return !isQuoteCall(n)
+		case *ast.LetStatement:
+			s.lets[n.Name.Value]++
+		}
+		return true
+	})
+	o.scope = s
+}
+
+func (o *optimizer) close() {
+	o.scope = o.scope.outer
+}
+
+// constant returns the literal name is bound to, if any
+func (o *optimizer) constant(name string) (ast.Expression, bool) {
+	for s := o.scope; s != nil; s = s.outer {
+		if _, ok := s.lets[name]; ok {
+			c, ok := s.consts[name]
+			return c, ok
+		}
+	}
+	return nil, false
+}
+
+// statements optimizes the statements of a scope or of a block within it;
+// only the lets of the scope itself (top) are certainly evaluated before the following statements
+func (o *optimizer) statements(statements []ast.Statement, top bool) []ast.Statement {
+	optimized := make([]ast.Statement, 0, len(statements))
+
+	for i, s := range statements {
+		switch s := s.(type) {
+
+		case *ast.LetStatement:
+			let := *s
+			let.Value = o.expression(s.Value)
+			if top && isLiteral(let.Value) && o.scope.lets[s.Name.Value] == 1 {
+				o.scope.consts[s.Name.Value] = let.Value
+			}
+			optimized = append(optimized, &let)
+
+		case *ast.ReturnStatement:
+			ret := *s
+			ret.ReturnValue = o.expression(s.ReturnValue)
+			optimized = append(optimized, &ret)
+
+		case *ast.ExpressionStatement:
+			if ie, ok := s.Expression.(*ast.IfExpression); ok {
+				condition := o.expression(ie.Condition)
+				if branch, ok := o.branch(ie, condition); ok {
+					last := i == len(statements)-1
+					if branch != nil && (len(branch.Statements) > 0 || !last) {
+						optimized = append(optimized, o.statements(branch.Statements, false)...)
+						continue
+					}
+					if branch == nil && !last {
+						continue
+					}
+				}
+			}
+			stmt := *s
+			stmt.Expression = o.expression(s.Expression)
+			optimized = append(optimized, &stmt)
+
+		case *ast.BlockStatement:
+			optimized = append(optimized, o.block(s))
+
+		default:
+			optimized = append(optimized, s)
+		}
+	}
+
+	return optimized
+}
+
+func (o *optimizer) block(block *ast.BlockStatement) *ast.BlockStatement {
+	if block == nil {
+		return nil
+	}
+	optimized := *block
+	optimized.Statements = o.statements(block.Statements, false)
+	return &optimized
+}
+
+// body optimizes the block of a function or a catch block, which has a scope of its own
+func (o *optimizer) body(params []*ast.Identifier, block *ast.BlockStatement) *ast.BlockStatement {
+	o.open(params, block)
+	optimized := *block
+	optimized.Statements = o.statements(block.Statements, true)
+	o.close()
+	return &optimized
+}
+
+// branch returns the branch of ie taken for the literal condition, nil for a missing alternative
+func (o *optimizer) branch(ie *ast.IfExpression, condition ast.Expression) (*ast.BlockStatement, bool) {
+	truthy, ok := isTruthy(condition)
+	if !ok {
+		return nil, false
+	}
+	if truthy {
+		return ie.Consequence, true
+	}
+	return ie.Alternative, true
+}
+
+func (o *optimizer) expression(e ast.Expression) ast.Expression {
+	switch e := e.(type) {
+
+	case *ast.Identifier:
+		if c, ok := o.constant(e.Value); ok {
+			return relocate(c, e.Token)
+		}
+		return e
+
+	case *ast.PrefixExpression:
+		prefix := *e
+		prefix.Right = o.expression(e.Right)
+		if folded, ok := foldPrefix(&prefix); ok {
+			return folded
+		}
+		return &prefix
+
+	case *ast.InfixExpression:
+		infix := *e
+		infix.Left = o.expression(e.Left)
+		infix.Right = o.expression(e.Right)
+		if folded, ok := foldInfix(&infix); ok {
+			return folded
+		}
+		return &infix
+
+	case *ast.IfExpression:
+		ie := *e
+		ie.Condition = o.expression(e.Condition)
+		if branch, ok := o.branch(e, ie.Condition); ok && branch != nil {
+			branch = o.block(branch)
+			if len(branch.Statements) == 1 {
+				if stmt, ok := branch.Statements[0].(*ast.ExpressionStatement); ok {
+					return stmt.Expression
+				}
+			}
+			// the branch taken is kept as the consequence of a condition that is always true
+			ie.Condition = &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}
+			ie.Consequence = branch
+			ie.Alternative = nil
+			return &ie
+		}
+		ie.Consequence = o.block(e.Consequence)
+		ie.Alternative = o.block(e.Alternative)
+		return &ie
+
+	case *ast.FunctionLiteral:
+		fn := *e
+		fn.Body = o.body(e.Parameters, e.Body)
+		return &fn
+
+	case *ast.CallExpression:
+		if isQuoteCall(e) {
+			return e
+		}
+		call := *e
+		call.Function = o.expression(e.Function)
+		call.Arguments = o.expressions(e.Arguments)
+		return &call
+
+	case *ast.ArrayLiteral:
+		array := *e
+		array.Elements = o.expressions(e.Elements)
+		return &array
+
+	case *ast.HashLiteral:
+		hash := *e
+		hash.Pairs = make(map[ast.Expression]ast.Expression, len(e.Pairs))
+		for key, value := range e.Pairs {
+			hash.Pairs[o.expression(key)] = o.expression(value)
+		}
+		return &hash
+
+	case *ast.IndexExpression:
+		index := *e
+		index.Left = o.expression(e.Left)
+		index.Index = o.expression(e.Index)
+		return &index
+
+	case *ast.SliceExpression:
+		slice := *e
+		slice.Left = o.expression(e.Left)
+		if e.Start != nil {
+			slice.Start = o.expression(e.Start)
+		}
+		if e.End != nil {
+			slice.End = o.expression(e.End)
+		}
+		return &slice
+
+	case *ast.TryExpression:
+		try := *e
+		try.Block = o.block(e.Block)
+		try.Handler = o.body([]*ast.Identifier{e.Param}, e.Handler)
+		return &try
+	}
+
+	// literals, macros
+	return e
+}
+
+func (o *optimizer) expressions(expressions []ast.Expression) []ast.Expression {
+	optimized := make([]ast.Expression, len(expressions))
+	for i, e := range expressions {
+		optimized[i] = o.expression(e)
+	}
+	return optimized
+}
+
+func isQuoteCall(call *ast.CallExpression) bool {
+	return call.Function.TokenLiteral() == "quote"
+}
+
+func isLiteral(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	}
+	return false
+}
+
+// isTruthy tells whether the literal e is truthy; ok is false if e is no literal
+func isTruthy(e ast.Expression) (truthy bool, ok bool) {
+	switch e := e.(type) {
+	case *ast.Boolean:
+		return e.Value, true
+	case *ast.IntegerLiteral, *ast.StringLiteral:
+		return true, true
+	}
+	return false, false
+}
+
+func foldPrefix(prefix *ast.PrefixExpression) (ast.Expression, bool) {
+	switch prefix.Operator {
+	case "!":
+		if truthy, ok := isTruthy(prefix.Right); ok {
+			return newBoolean(!truthy, prefix.Token), true
+		}
+	case "-":
+		if integer, ok := prefix.Right.(*ast.IntegerLiteral); ok {
+			return newInteger(-integer.Value, prefix.Token), true
+		}
+	}
+	return nil, false
+}
+
+func foldInfix(infix *ast.InfixExpression) (ast.Expression, bool) {
+	tok := infix.Token
+
+	switch left := infix.Left.(type) {
+
+	case *ast.IntegerLiteral:
+		right, ok := infix.Right.(*ast.IntegerLiteral)
+		if !ok {
+			return nil, false
+		}
+		l, r := left.Value, right.Value
+		switch infix.Operator {
+		case "+":
+			return newInteger(l+r, tok), true
+		case "-":
+			return newInteger(l-r, tok), true
+		case "*":
+			return newInteger(l*r, tok), true
+		case "/":
+			if r == 0 {
+				return nil, false
+			}
+			return newInteger(l/r, tok), true
+		case "<":
+			return newBoolean(l < r, tok), true
+		case ">":
+			return newBoolean(l > r, tok), true
+		case "==":
+			return newBoolean(l == r, tok), true
+		case "!=":
+			return newBoolean(l != r, tok), true
+		}
+
+	case *ast.StringLiteral:
+		right, ok := infix.Right.(*ast.StringLiteral)
+		if !ok {
+			return nil, false
+		}
+		l, r := left.Value, right.Value
+		switch infix.Operator {
+		case "+":
+			return newString(l+r, tok), true
+		case "<":
+			return newBoolean(l < r, tok), true
+		case ">":
+			return newBoolean(l > r, tok), true
+		case "==":
+			return newBoolean(l == r, tok), true
+		case "!=":
+			return newBoolean(l != r, tok), true
+		}
+
+	case *ast.Boolean:
+		right, ok := infix.Right.(*ast.Boolean)
+		if !ok {
+			return nil, false
+		}
+		switch infix.Operator {
+		case "==":
+			return newBoolean(left.Value == right.Value, tok), true
+		case "!=":
+			return newBoolean(left.Value != right.Value, tok), true
+		}
+	}
+
+	return nil, false
+}
+
+// literals created by the optimizer take the position of the expression they replace
+
+func newInteger(value int64, at token.Token) *ast.IntegerLiteral {
+	return &ast.IntegerLiteral{Token: position(token.INT, fmt.Sprint(value), at), Value: value}
+}
+
+func newString(value string, at token.Token) *ast.StringLiteral {
+	return &ast.StringLiteral{Token: position(token.STRING, value, at), Value: value}
+}
+
+func newBoolean(value bool, at token.Token) *ast.Boolean {
+	if value {
+		return &ast.Boolean{Token: position(token.TRUE, "true", at), Value: true}
+	}
+	return &ast.Boolean{Token: position(token.FALSE, "false", at), Value: false}
+}
+
+func position(tokenType token.TokenType, literal string, at token.Token) token.Token {
+	return token.Token{Type: tokenType, Literal: literal, Line: at.Line, Column: at.Column}
+}
+
+func relocate(literal ast.Expression, at token.Token) ast.Expression {
+	switch literal := literal.(type) {
+	case *ast.IntegerLiteral:
+		return newInteger(literal.Value, at)
+	case *ast.StringLiteral:
+		return newString(literal.Value, at)
+	case *ast.Boolean:
+		return newBoolean(literal.Value, at)
+	}
+	return literal
+}
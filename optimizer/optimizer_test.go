@@ -0,0 +1,125 @@
+package optimizer
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/formatter"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// constant folding
+		{"2 * 3 + 1", "7"},
+		{"10 / 3 - -1", "4"},
+		{"!(1 < 2)", "false"},
+		{"!!5", "true"},
+		{`"mon" + "key" == "monkey"`, "true"},
+		{`"a" < "b"`, "true"},
+		{"true != (1 > 2)", "true"},
+		{"x * (2 + 3)", "x * 5"},
+		{"x + 1 + 2", "x + 1 + 2"},
+		{"1 + true", "1 + true"},
+		{"1 / 0", "1 / 0"},
+		{`-"a"`, `-"a"`},
+		{`{1 + 1: [2 * 2]}[2]`, `{2: [4]}[2]`},
+		{"quote(1 + 2)", "quote(1 + 2)"},
+		// dead branches
+		{"if (1 > 2) { a } else { b }", "b"},
+		{"if (true) { a }", "a"},
+		{"if (false) { a }", "if (false) { a }"},
+		{"if (false) { a }; b", "b"},
+		{"if (1) { let a = 1; a }", "let a = 1;\na"},
+		{"let x = if (true) { let a = 1; a } else { 2 };", "let x = if (true) {\n  let a = 1;\n  a\n};"},
+		{"if (c) { 1 + 1 } else { 2 + 2 }", "if (c) { 2 } else { 4 }"},
+		// inlining
+		{"let x = 2; let y = x * 3; y + 1", "let x = 2;\nlet y = 6;\n7"},
+		{"let s = \"a\"; fn() { s + s }", "let s = \"a\";\nfn() { \"aa\" }"},
+		{"let x = 1; let x = 2; x", "let x = 1;\nlet x = 2;\nx"},
+		{"let x = 1; if (c) { let x = 2 }; x", "let x = 1;\nif (c) {\n  let x = 2;\n};\nx"},
+		{"let f = fn() { x }; let x = 1; f()", "let f = fn() { x };\nlet x = 1;\nf()"},
+		{"let x = 1; fn(x) { x }", "let x = 1;\nfn(x) { x }"},
+		{"let x = 1; fn() { let x = 2; x }", "let x = 1;\nfn() {\n  let x = 2;\n  2\n}"},
+		{"let e = 1; try { e } catch (e) { e }", "let e = 1;\ntry { 1 } catch (e) { e }"},
+		{"let x = [1]; x", "let x = [1];\nx"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		optimized := formatter.Format(Optimize(program))
+		if optimized != tt.expected {
+			t.Errorf("wrong optimization of %q.\nwant=\n%s\ngot=\n%s", tt.input, tt.expected, optimized)
+		}
+	}
+}
+
+func TestOptimizeKeepsOriginal(t *testing.T) {
+	input := "let x = 1 + 2; if (x > 2) { x } else { 0 }"
+	program := parse(t, input)
+	before := program.String()
+
+	Optimize(program)
+
+	if program.String() != before {
+		t.Errorf("original has been altered. want=%s, got=%s", before, program.String())
+	}
+}
+
+var programs = []string{
+	"2 * 3 + 1",
+	"let a = 5; let b = a * a; b - a / 2",
+	`let greeting = "hello"; greeting + " " + "world"`,
+	"if (1 < 2) { 10 } else { 20 }",
+	"if (1 > 2) { 10 }",
+	"if (false) { 10 }; 20",
+	"let x = 1; if (true) { let x = 2 }; x",
+	"let x = 1; let f = fn() { x }; let x = 2; f()",
+	"let n = 3; let f = fn(n) { n * 2 }; f(4) + n",
+	`let f = fn(x) { if (true) { return x * 2; } x }; f(3)`,
+	`let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5)`,
+	`let limit = 3;
+	let count = fn(i) { if (i > limit) { i } else { count(i + 1) } };
+	count(0)`,
+	`let h = {1 + 1: "two", "t" + "hree": 3}; [h[2], h["three"]]`,
+	"[1, 2 * 2, 3][1:]",
+	"1 + true",
+	`-"a"`,
+	`let e = "outer"; try { throw(e + "!") } catch (e) { e }`,
+	`try { let a = 1; throw(a + 1) } catch (err) { err * 10 }`,
+	"let x = 10; let y = if (x > 5) { x - 5 } else { x }; y",
+	"!(1 == 1) == false",
+	`let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) }; 1`,
+}
+
+// optimized programs must evaluate to the same values as the original ones
+func TestOptimizedEvaluatesIdentically(t *testing.T) {
+	for _, input := range programs {
+		program := parse(t, input)
+		optimized := Optimize(program)
+
+		want := evaluator.Eval(program, object.NewEnvironment())
+		got := evaluator.Eval(optimized, object.NewEnvironment())
+
+		if want.Inspect() != got.Inspect() {
+			t.Errorf("optimization of %q changes its value.\noptimized=%s\nwant=%s\ngot= %s",
+				input, formatter.Format(optimized), want.Inspect(), got.Inspect())
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
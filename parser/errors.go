@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"fmt"
+	"monkey/token"
+	"sort"
+)
+
+type ErrorCode string
+
+const (
+	UnexpectedToken ErrorCode = "unexpected-token"   // the next token is not the one the grammar demands
+	NoPrefixParseFn ErrorCode = "no-prefix-parse-fn" // no expression can start with the current token
+	InvalidInteger  ErrorCode = "invalid-integer"    // an integer literal is out of range
+	UnclosedBlock   ErrorCode = "unclosed-block"     // the input ends within a block
+)
+
+// Span is the part of the input an error refers to; it does not extend over several lines
+type Span struct {
+	Line   int // starting at 1
+	Column int // starting at 1
+	Length int // at least 1, even at the end of the input
+}
+
+func spanOf(tok token.Token) Span {
+	length := len(tok.Literal)
+	if tok.Type == token.STRING {
+		length += 2 // the quotes
+	}
+	if length == 0 {
+		length = 1
+	}
+	return Span{Line: tok.Line, Column: tok.Column, Length: length}
+}
+
+type ParseError struct {
+	Code     ErrorCode
+	Message  string
+	Span     Span
+	Expected []token.TokenType // the tokens the parser would have accepted instead
+	Hint     string            // a guess at what is wrong; may be empty
+}
+
+func (e *ParseError) Error() string { return e.Message }
+
+// Position returns the position of the error in the form line:column
+func (e *ParseError) Position() string {
+	return fmt.Sprintf("%d:%d", e.Span.Line, e.Span.Column)
+}
+
+// expressionStarts returns the token types an expression can start with
+func (p *Parser) expressionStarts() []token.TokenType {
+	starts := []token.TokenType{}
+	for t := range p.prefixParseFns {
+		starts = append(starts, t)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	return starts
+}
+
+// hint guesses at the mistake that made the parser come across tok instead of one of expected
+func (p *Parser) hint(tok token.Token, expected []token.TokenType) string {
+	closing := ""
+	if len(expected) > 0 && p.isClosing(expected[0]) {
+		closing = string(expected[0])
+	}
+
+	// after an expression, an operator or the token closing it is expected
+	afterExpression := closing != "" || contains(expected, token.COMMA)
+
+	switch {
+	case p.curTokenIs(token.LET) && contains(expected, token.IDENT):
+		return "missing name after let: let name = value"
+	case tok.Type == token.ASSIGN && (expected == nil || afterExpression):
+		return "did you mean '=='? '=' only binds names in let statements"
+	case tok.Type == token.EQ && contains(expected, token.ASSIGN):
+		return "did you mean '='? names are bound by 'let name = value'"
+	case (p.curTokenIs(token.FUNCTION) || p.curTokenIs(token.MACRO)) && contains(expected, token.LPAREN):
+		if tok.Type == token.LBRACE {
+			return fmt.Sprintf("without parameters, %s is followed by empty parentheses: %s() { ... }",
+				p.curToken.Literal, p.curToken.Literal)
+		}
+		return fmt.Sprintf("parameters are enclosed in parentheses: %s(x, y) { ... }", p.curToken.Literal)
+	case p.curTokenIs(token.IF) && contains(expected, token.LPAREN):
+		return "conditions are enclosed in parentheses: if (x) { ... }"
+	case contains(expected, token.COMMA) && tok.Type == token.SEMICOLON:
+		return "elements are separated by ',', not by ';'"
+	case contains(expected, token.COMMA) && p.prefixParseFns[tok.Type] != nil:
+		return "is a ',' missing?"
+	case closing != "" && (tok.Type == token.SEMICOLON || tok.Type == token.EOF || isStatementStart(tok.Type)):
+		return fmt.Sprintf("is a '%s' missing?", closing)
+	case expected == nil && isStatementStart(tok.Type):
+		return fmt.Sprintf("'%s' starts a new statement; is a ';' missing or is the expression before it incomplete?",
+			tok.Literal)
+	}
+	return ""
+}
+
+func isStatementStart(t token.TokenType) bool {
+	return t == token.LET || t == token.RETURN
+}
+
+func contains(types []token.TokenType, t token.TokenType) bool {
+	for _, tt := range types {
+		if tt == t {
+			return true
+		}
+	}
+	return false
+}
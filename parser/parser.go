@@ -6,6 +6,7 @@ import (
 	"monkey/lexer"
 	"monkey/token"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -40,11 +41,16 @@ type (
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors []*ParseError
 
 	curToken  token.Token
 	peekToken token.Token
 
+	trail    []token.Token // the tokens of the current top-level statement read so far
+	pending  []token.Token // tokens put back, to be read before the lexer's next ones
+	rec      *recovery     // the error state of the innermost statement being parsed
+	unclosed bool          // a missing '}' at the end of the input has been reported
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -52,7 +58,7 @@ type Parser struct {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []*ParseError{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
@@ -68,6 +74,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -91,7 +99,21 @@ func New(l *lexer.Lexer) *Parser {
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	if len(p.pending) > 0 {
+		p.peekToken = p.pending[len(p.pending)-1]
+		p.pending = p.pending[:len(p.pending)-1]
+	} else {
+		p.peekToken = p.l.NextToken()
+	}
+	p.trail = append(p.trail, p.curToken)
+}
+
+// backup undoes the last call of nextToken
+func (p *Parser) backup() {
+	p.pending = append(p.pending, p.peekToken)
+	p.peekToken = p.curToken
+	p.trail = p.trail[:len(p.trail)-1]
+	p.curToken = p.trail[len(p.trail)-1]
 }
 
 func (p *Parser) curTokenIs(t token.TokenType) bool {
@@ -102,29 +124,148 @@ func (p *Parser) peekTokenIs(t token.TokenType) bool {
 	return p.peekToken.Type == t
 }
 
-func (p *Parser) expectPeek(t token.TokenType) bool {
+// expectPeek advances if the next token is of type t;
+// alternatives are types that would have been accepted by the caller as well
+func (p *Parser) expectPeek(t token.TokenType, alternatives ...token.TokenType) bool {
 	if p.peekTokenIs(t) {
 		p.nextToken()
 		return true
 	} else {
-		p.peekError(t)
+		p.peekError(t, alternatives...)
+		if p.rec != nil {
+			p.rec.broken = true
+		}
 		return false
 	}
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []*ParseError {
 	return p.errors
 }
 
-func (p *Parser) peekError(t token.TokenType) {
+// addError reports err unless it is a follow-up of an error in the same statement
+func (p *Parser) addError(err *ParseError) {
+	if p.rec != nil {
+		if p.rec.failed {
+			return
+		}
+		p.rec.failed = true
+	}
+	p.errors = append(p.errors, err)
+}
+
+func (p *Parser) peekError(t token.TokenType, alternatives ...token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	expected := append([]token.TokenType{t}, alternatives...)
+	p.addError(&ParseError{
+		Code:     UnexpectedToken,
+		Message:  msg,
+		Span:     spanOf(p.peekToken),
+		Expected: expected,
+		Hint:     p.hint(p.peekToken, expected),
+	})
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(&ParseError{
+		Code:     NoPrefixParseFn,
+		Message:  msg,
+		Span:     spanOf(p.curToken),
+		Expected: p.expressionStarts(),
+		Hint:     p.hint(p.curToken, nil),
+	})
+}
+
+/*
+Error recovery:
+Each statement keeps track of its errors. Only the first error of a statement is reported,
+since the following ones are usually caused by it. A statement is broken if an expected token
+is missing; the parser then skips the tokens up to the next synchronization point
+and puts an ast.BadStatement in its place. Synchronization points are
+- a ';' ending the statement,
+- a '}' closing the enclosing block,
+- a 'let' or 'return' starting the next statement,
+- the end of the input.
+Where no expression can start, an ast.BadExpression is put in and parsing goes on.
+*/
+
+type recovery struct {
+	start  int  // the index of the first token of the statement in the trail
+	failed bool // an error has been reported for the statement
+	broken bool // the statement cannot be completed
+}
+
+func (p *Parser) beginStatement() *recovery {
+	outer := p.rec
+	p.rec = &recovery{start: len(p.trail) - 1}
+	return outer
+}
+
+func (p *Parser) endStatement(outer *recovery) {
+	p.rec = outer
+}
+
+// parseRecoverableStatement parses a statement and replaces it by a placeholder if it is broken
+func (p *Parser) parseRecoverableStatement() ast.Statement {
+	outer := p.beginStatement()
+	defer p.endStatement(outer)
+
+	stmt := p.parseStatement()
+	if p.rec.broken {
+		p.synchronize()
+		return &ast.BadStatement{Token: p.trail[p.rec.start], Skipped: p.skipped()}
+	}
+	return stmt
+}
+
+// synchronize skips the tokens up to the next synchronization point
+func (p *Parser) synchronize() {
+	braces := 0   // the number of braces opened within the statement
+	brackets := 0 // the number of parentheses and brackets opened within the statement
+	count := func(tok token.Token) {
+		switch tok.Type {
+		case token.LBRACE:
+			braces++
+		case token.RBRACE:
+			braces--
+		case token.LPAREN, token.LBRACKET:
+			brackets++
+		case token.RPAREN, token.RBRACKET:
+			brackets--
+		}
+	}
+	for _, tok := range p.trail[p.rec.start:] {
+		count(tok)
+	}
+
+	for !p.peekTokenIs(token.EOF) {
+		if braces <= 0 {
+			if p.curTokenIs(token.SEMICOLON) && brackets <= 0 {
+				return
+			}
+			if p.peekTokenIs(token.RBRACE) || isStatementStart(p.peekToken.Type) {
+				return
+			}
+		}
+
+		p.nextToken()
+		count(p.curToken)
+	}
+}
+
+// skipped returns the tokens of the broken statement
+func (p *Parser) skipped() string {
+	skipped := []string{}
+	for _, tok := range p.trail[p.rec.start:] {
+		if tok.Type == token.STRING {
+			skipped = append(skipped, strconv.Quote(tok.Literal))
+		} else {
+			skipped = append(skipped, tok.Literal)
+		}
+	}
+	return strings.Join(skipped, " ")
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -132,10 +273,9 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			program.Statements = append(program.Statements, stmt)
-		}
+		p.trail = append(p.trail[:0], p.curToken)
+		stmt := p.parseRecoverableStatement()
+		program.Statements = append(program.Statements, stmt)
 		p.nextToken()
 	}
 
@@ -207,7 +347,14 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
+		bad := &ast.BadExpression{Token: p.curToken, Skipped: p.curToken.Literal}
+		// a closing delimiter is left to the construct it belongs to, e.g. in 'fn() { 1 + }',
+		// a keyword to the statement it starts; a stray delimiter is skipped
+		if (p.isOpened(p.curToken.Type) || isStatementStart(p.curToken.Type)) && len(p.trail)-1 > p.rec.start {
+			bad.Skipped = ""
+			p.backup()
+		}
+		return bad
 	}
 	leftExp := prefix()
 
@@ -225,6 +372,35 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	return leftExp
 }
 
+func (p *Parser) isClosing(t token.TokenType) bool {
+	return t == token.RPAREN || t == token.RBRACKET || t == token.RBRACE
+}
+
+var openers = map[token.TokenType]token.TokenType{
+	token.RPAREN:   token.LPAREN,
+	token.RBRACKET: token.LBRACKET,
+	token.RBRACE:   token.LBRACE,
+}
+
+// isOpened reports whether t closes a delimiter opened before the current token
+// within the current top-level statement
+func (p *Parser) isOpened(t token.TokenType) bool {
+	opener, ok := openers[t]
+	if !ok {
+		return false
+	}
+	open := 0
+	for _, tok := range p.trail[:len(p.trail)-1] {
+		switch tok.Type {
+		case opener:
+			open++
+		case t:
+			open--
+		}
+	}
+	return open > 0
+}
+
 func (p *Parser) peekPrecedence() int {
 	if p, ok := precedences[p.peekToken.Type]; ok {
 		return p
@@ -251,8 +427,8 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+		p.addError(&ParseError{Code: InvalidInteger, Message: msg, Span: spanOf(p.curToken)})
+		return &ast.BadExpression{Token: p.curToken, Skipped: p.curToken.Literal}
 	}
 
 	lit.Value = value
@@ -340,6 +516,42 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Block = p.parseBlockStatement()
+
+	if !p.expectPeek(token.CATCH) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Handler = p.parseBlockStatement()
+
+	return expression
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
@@ -347,13 +559,23 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			block.Statements = append(block.Statements, stmt)
-		}
+		stmt := p.parseRecoverableStatement()
+		block.Statements = append(block.Statements, stmt)
 		p.nextToken()
 	}
 
+	// if several blocks are left open, the missing braces are reported once
+	if p.curTokenIs(token.EOF) && !p.unclosed {
+		p.unclosed = true
+		p.addError(&ParseError{
+			Code:     UnclosedBlock,
+			Message:  fmt.Sprintf("expected next token to be %s, got %s instead", token.RBRACE, token.EOF),
+			Span:     spanOf(p.curToken),
+			Expected: []token.TokenType{token.RBRACE},
+			Hint:     fmt.Sprintf("the block opened at %d:%d is not closed", block.Token.Line, block.Token.Column),
+		})
+	}
+
 	return block
 }
 
@@ -375,6 +597,24 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 
@@ -383,19 +623,23 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return identifiers
 	}
 
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 
 	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	identifiers = append(identifiers, ident)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
-		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 		identifiers = append(identifiers, ident)
 	}
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectPeek(token.RPAREN, token.COMMA) {
 		return nil
 	}
 
@@ -425,7 +669,7 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 		list = append(list, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectPeek(end) {
+	if !p.expectPeek(end, token.COMMA) {
 		return nil
 	}
 
@@ -443,9 +687,35 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
 
+	if p.peekTokenIs(token.COLON) { // slice without start, e.g. arr[:2]
+		return p.parseSliceExpression(exp.Token, left, nil)
+	}
+
 	p.nextToken()
 	exp.Index = p.parseExpression(LOWEST)
 
+	if p.peekTokenIs(token.COLON) {
+		return p.parseSliceExpression(exp.Token, left, exp.Index)
+	}
+
+	if !p.expectPeek(token.RBRACKET, token.COLON) {
+		return nil
+	}
+
+	return exp
+}
+
+// precondition: peekToken is the ':' token
+func (p *Parser) parseSliceExpression(tok token.Token, left ast.Expression, start ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: start}
+
+	p.nextToken()
+
+	if !p.peekTokenIs(token.RBRACKET) { // slice with end, e.g. arr[1:2]
+		p.nextToken()
+		exp.End = p.parseExpression(LOWEST)
+	}
+
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
@@ -470,7 +740,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 		hash.Pairs[key] = value
 
-		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA, token.RBRACE) {
 			return nil
 		}
 	}
@@ -491,6 +761,9 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 }
 
 func (p *Parser) ParseStatement() ast.Statement {
+	outer := p.beginStatement()
+	defer p.endStatement(outer)
+
 	var stmt ast.Statement
 	switch p.curToken.Type {
 	case token.LBRACE:
@@ -499,13 +772,24 @@ func (p *Parser) ParseStatement() ast.Statement {
 	default:
 		stmt = p.parseStatement()
 	}
+	if p.rec.broken {
+		p.synchronize()
+		return &ast.BadStatement{Token: p.trail[p.rec.start], Skipped: p.skipped()}
+	}
 	p.expectPeek(token.EOF)
 	return stmt
 
 }
 
 func (p *Parser) ParseExpression() ast.Expression {
+	outer := p.beginStatement()
+	defer p.endStatement(outer)
+
 	expr := p.parseExpression(LOWEST)
+	if p.rec.broken {
+		p.synchronize()
+		return &ast.BadExpression{Token: p.trail[p.rec.start], Skipped: p.skipped()}
+	}
 	p.expectPeek(token.EOF)
 	return expr
 }
@@ -1,7 +1,10 @@
 package parser
 
 import (
+	"monkey/ast"
 	"monkey/lexer"
+	"monkey/token"
+	"reflect"
 
 	"strings"
 	"testing"
@@ -69,13 +72,184 @@ func TestFunctionLiteralsInvalidParametersCrowd(t *testing.T) {
 	}
 }
 
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the program's String()
+		errors   []string
+	}{
+		{
+			"let = 5; let y = 2; y",
+			"<bad statement: let = 5 ;>let y = 2;y",
+			[]string{"expected next token to be IDENT, got = instead"},
+		},
+		{
+			"1 + @; 2",
+			"(1 + <bad expression: @>)2",
+			[]string{"no prefix parse function for ILLEGAL found"},
+		},
+		{
+			"fn(@){}; 3",
+			"<bad statement: fn ( @ ) { } ;>3",
+			[]string{"expected next token to be IDENT, got ILLEGAL instead"},
+		},
+		{
+			"fn(x){ let = 1; x }",
+			"fn(x) <bad statement: let = 1 ;>x",
+			[]string{"expected next token to be IDENT, got = instead"},
+		},
+		{
+			`{"a" 1}; 2`,
+			`<bad statement: { "a" 1 } ;>2`,
+			[]string{"expected next token to be :, got INT instead"},
+		},
+		{
+			"foo(1, ); 4",
+			"foo(1, <missing expression>)4",
+			[]string{"no prefix parse function for ) found"},
+		},
+		{
+			"fn() { 1 + }",
+			"fn() (1 + <missing expression>)",
+			[]string{"no prefix parse function for } found"},
+		},
+		{
+			"if (x { 1 } let y = 2",
+			"<bad statement: if ( x { 1 }>let y = 2;",
+			[]string{"expected next token to be ), got { instead"},
+		},
+		{
+			"let max = fn(x,y){if(x>y){x}else{y",
+			"let max = fn(x, y) if(x > y) xelse y;",
+			[]string{"expected next token to be }, got EOF instead"},
+		},
+		{ // a stray delimiter is reported once
+			"let c = );",
+			"let c = <bad expression: )>;",
+			[]string{"no prefix parse function for ) found"},
+		},
+		{
+			"let a = (1; let b = @; fn(x) { x + }",
+			"<bad statement: let a = ( 1 ;>let b = <bad expression: @>;fn(x) (x + <missing expression>)",
+			[]string{
+				"expected next token to be ), got ; instead",
+				"no prefix parse function for ILLEGAL found",
+				"no prefix parse function for } found",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, program.String())
+		}
+		if !reflect.DeepEqual(messages(p.Errors()), tt.errors) {
+			t.Errorf("wrong errors for %q.\nwant=%q\ngot= %q", tt.input, tt.errors, messages(p.Errors()))
+		}
+	}
+}
+
+func TestErrorRecoveryPlaceholders(t *testing.T) {
+	l := lexer.New("1;\nlet 2 = 3;\n4 * @")
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	bs, ok := program.Statements[1].(*ast.BadStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] is not *ast.BadStatement. got=%T", program.Statements[1])
+	}
+	if bs.Token.Line != 2 || bs.Token.Column != 1 || bs.Skipped != "let 2 = 3 ;" {
+		t.Errorf("wrong bad statement. got=%+v", bs)
+	}
+
+	infix := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	be, ok := infix.Right.(*ast.BadExpression)
+	if !ok {
+		t.Fatalf("infix.Right is not *ast.BadExpression. got=%T", infix.Right)
+	}
+	if be.Token.Line != 3 || be.Token.Column != 5 || be.Skipped != "@" {
+		t.Errorf("wrong bad expression. got=%+v", be)
+	}
+}
+
+func TestParseErrorDetails(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     ErrorCode
+		span     Span
+		expected []token.TokenType
+		hint     string
+	}{
+		{"let x = (1 + 2;", UnexpectedToken, Span{1, 15, 1}, []token.TokenType{token.RPAREN}, "is a ')' missing?"},
+		{"if (x = 1) { x }", UnexpectedToken, Span{1, 7, 1}, []token.TokenType{token.RPAREN},
+			"did you mean '=='? '=' only binds names in let statements"},
+		{"x = 1", NoPrefixParseFn, Span{1, 3, 1}, nil, "did you mean '=='? '=' only binds names in let statements"},
+		{"let = 5", UnexpectedToken, Span{1, 5, 1}, []token.TokenType{token.IDENT}, "missing name after let: let name = value"},
+		{"let x == 1", UnexpectedToken, Span{1, 7, 2}, []token.TokenType{token.ASSIGN},
+			"did you mean '='? names are bound by 'let name = value'"},
+		{"fn x { x }", UnexpectedToken, Span{1, 4, 1}, []token.TokenType{token.LPAREN},
+			"parameters are enclosed in parentheses: fn(x, y) { ... }"},
+		{"fn { 1 }", UnexpectedToken, Span{1, 4, 1}, []token.TokenType{token.LPAREN},
+			"without parameters, fn is followed by empty parentheses: fn() { ... }"},
+		{"[1; 2]", UnexpectedToken, Span{1, 3, 1}, []token.TokenType{token.RBRACKET, token.COMMA},
+			"elements are separated by ',', not by ';'"},
+		{`{"a": 1 "b": 2}`, UnexpectedToken, Span{1, 9, 3}, []token.TokenType{token.COMMA, token.RBRACE},
+			"is a ',' missing?"},
+		{"let x = 1 +\nlet y = 2", NoPrefixParseFn, Span{2, 1, 3}, nil,
+			"'let' starts a new statement; is a ';' missing or is the expression before it incomplete?"},
+		{"fn(x) {\n  x", UnclosedBlock, Span{2, 4, 1}, []token.TokenType{token.RBRACE},
+			"the block opened at 1:7 is not closed"},
+		{"99999999999999999999", InvalidInteger, Span{1, 1, 20}, nil, ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) != 1 {
+			t.Errorf("wrong number of errors for %q. got=%q", tt.input, messages(p.Errors()))
+			continue
+		}
+		err := p.Errors()[0]
+		if err.Code != tt.code {
+			t.Errorf("wrong code for %q. want=%s, got=%s", tt.input, tt.code, err.Code)
+		}
+		if err.Span != tt.span {
+			t.Errorf("wrong span for %q. want=%+v, got=%+v", tt.input, tt.span, err.Span)
+		}
+		if tt.code != NoPrefixParseFn && !reflect.DeepEqual(err.Expected, tt.expected) {
+			t.Errorf("wrong expected tokens for %q. want=%v, got=%v", tt.input, tt.expected, err.Expected)
+		}
+		if err.Hint != tt.hint {
+			t.Errorf("wrong hint for %q.\nwant=%q\ngot= %q", tt.input, tt.hint, err.Hint)
+		}
+	}
+}
+
 func parseErrors(input string) []string {
 
 	l := lexer.New(input)
 	p := New(l)
 	p.ParseProgram()
 
-	return p.Errors()
+	return messages(p.Errors())
+}
+
+func messages(errors []*ParseError) []string {
+	msgs := []string{}
+	for _, err := range errors {
+		msgs = append(msgs, err.Message)
+	}
+	return msgs
 }
 
 var invalidParams = []string{
@@ -349,6 +349,14 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a * b[1:2] * c",
+			"((a * (b[1:2])) * c)",
+		},
+		{
+			"a[:n - 1][-1]",
+			"((a[:(n - 1)])[(-1)])",
+		},
 	}
 
 	for _, tt := range tests {
@@ -509,6 +517,84 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestTryExpression(t *testing.T) {
+	input := `try { x } catch (e) { e }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if len(exp.Block.Statements) != 1 {
+		t.Errorf("block is not 1 statements. got=%d\n",
+			len(exp.Block.Statements))
+	}
+
+	block, ok := exp.Block.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Block.Statements[0])
+	}
+
+	if !testIdentifier(t, block.Expression, "x") {
+		return
+	}
+
+	if !testIdentifier(t, exp.Param, "e") {
+		return
+	}
+
+	handler, ok := exp.Handler.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Handler.Statements[0])
+	}
+
+	if !testIdentifier(t, handler.Expression, "e") {
+		return
+	}
+
+	if exp.String() != "try x catch(e) e" {
+		t.Errorf("exp.String() wrong. got=%q", exp.String())
+	}
+}
+
+func TestTryExpressionParseErrors(t *testing.T) {
+	tests := []string{
+		"try { x }",
+		"try { x } catch { e }",
+		"try { x } catch (1) { e }",
+		"try x catch (e) { e }",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("parser failed to detect error in: %q", input)
+		}
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -556,6 +642,53 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -762,6 +895,53 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStart interface{}
+		expectedEnd   interface{}
+	}{
+		{"myArray[1:2]", 1, 2},
+		{"myArray[1:]", 1, nil},
+		{"myArray[:2]", nil, 2},
+		{"myArray[:]", nil, nil},
+		{"myArray[i:j]", "i", "j"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		sliceExp, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+		}
+
+		if !testIdentifier(t, sliceExp.Left, "myArray") {
+			return
+		}
+
+		if tt.expectedStart == nil {
+			if sliceExp.Start != nil {
+				t.Errorf("sliceExp.Start not nil. got=%q", sliceExp.Start)
+			}
+		} else if !testLiteralExpression(t, sliceExp.Start, tt.expectedStart) {
+			return
+		}
+
+		if tt.expectedEnd == nil {
+			if sliceExp.End != nil {
+				t.Errorf("sliceExp.End not nil. got=%q", sliceExp.End)
+			}
+		} else if !testLiteralExpression(t, sliceExp.End, tt.expectedEnd) {
+			return
+		}
+	}
+}
+
 func TestParsingEmptyHashLiteral(t *testing.T) {
 	input := "{}"
 
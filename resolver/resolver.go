@@ -0,0 +1,307 @@
+package resolver
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"sort"
+	"strings"
+)
+
+/*
+The resolver mirrors the environments of the evaluator:
+
+- the program, every function (and macro) call and every catch block has its own scope;
+  other blocks bind in the scope they are part of
+- within a scope, statements are evaluated in order: an identifier refers to the bindings made so far
+- a function body is only evaluated when the function is called, i.e. usually after the enclosing
+  scopes have been evaluated: it may refer to any binding of the enclosing scopes, e.g. to the
+  function itself or to functions defined later
+- within quote(...), only the arguments of unquote(...) are evaluated
+
+Identifiers neither bound in the input nor in the given environments nor builtins are reported as errors;
+shadowed and unused bindings as warnings. Unused bindings are reported for function and catch scopes only,
+since the bindings of a program are kept for later inputs.
+*/
+
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("%d", int(s))
+	}
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+	Line     int
+	Column   int
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", d.Line, d.Column, d.Severity, d.Message)
+}
+
+// Check resolves the identifiers of node; envs hold the bindings made before,
+// e.g. by former inputs of a session. The diagnostics are sorted by position.
+func Check(node ast.Node, envs ...*object.Environment) []Diagnostic {
+	r := run(node, envs)
+
+	sort.SliceStable(r.diagnostics, func(i, j int) bool {
+		a, b := r.diagnostics[i], r.diagnostics[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return r.diagnostics
+}
+
+// Binding is what an identifier refers to
+type Binding struct {
+	Ident *ast.Identifier // bound by a let or as a parameter; nil for bindings of envs and builtins
+	Kind  string          // let, parameter, catch parameter, environment, builtin
+}
+
+// Resolve returns the bindings the identifiers of node refer to, with envs as for Check;
+// identifiers bound by lets and as parameters refer to themselves, unbound identifiers are missing.
+func Resolve(node ast.Node, envs ...*object.Environment) map[*ast.Identifier]Binding {
+	return run(node, envs).bindings
+}
+
+func run(node ast.Node, envs []*object.Environment) *resolver {
+	r := &resolver{scope: newScope(nil, false), envs: envs, bindings: make(map[*ast.Identifier]Binding)}
+	r.declareLets(node)
+	ast.Walk(r, node)
+	return r
+}
+
+type binding struct {
+	ident *ast.Identifier
+	kind  string // let, parameter, catch parameter
+	used  bool
+}
+
+type scope struct {
+	outer    *scope
+	function bool                       // the scope of a function or macro call
+	declared map[string]*ast.Identifier // the first let of each name, hoisted
+	defined  map[string]*binding        // the bindings made so far
+	order    []*binding
+	late     map[string]bool // used by functions before being defined
+}
+
+func newScope(outer *scope, function bool) *scope {
+	return &scope{
+		outer:    outer,
+		function: function,
+		declared: make(map[string]*ast.Identifier),
+		defined:  make(map[string]*binding),
+		late:     make(map[string]bool),
+	}
+}
+
+type resolver struct {
+	scope       *scope
+	envs        []*object.Environment
+	diagnostics []Diagnostic
+	bindings    map[*ast.Identifier]Binding
+}
+
+func (r *resolver) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+
+	case *ast.Identifier:
+		r.resolve(node)
+		return nil
+
+	case *ast.LetStatement:
+		ast.Walk(r, node.Value)
+		r.define(node.Name, "let")
+		return nil
+
+	case *ast.FunctionLiteral:
+		r.function(node.Parameters, node.Body)
+		return nil
+
+	case *ast.MacroLiteral:
+		r.function(node.Parameters, node.Body)
+		return nil
+
+	case *ast.TryExpression:
+		ast.Walk(r, node.Block)
+
+		r.scope = newScope(r.scope, false)
+		r.define(node.Param, "catch parameter")
+		r.declareLets(node.Handler)
+		ast.Walk(r, node.Handler)
+		r.closeScope()
+		return nil
+
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			for _, arg := range node.Arguments {
+				r.unquoted(arg)
+			}
+			return nil
+		}
+	}
+
+	return r
+}
+
+func (r *resolver) function(parameters []*ast.Identifier, body *ast.BlockStatement) {
+	r.scope = newScope(r.scope, true)
+	for _, param := range parameters {
+		r.define(param, "parameter")
+	}
+	r.declareLets(body)
+	ast.Walk(r, body)
+	r.closeScope()
+}
+
+// unquoted resolves the arguments of the calls to unquote within a quoted node
+func (r *resolver) unquoted(quoted ast.Node) {
+	ast.Inspect(quoted, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || call.Function.TokenLiteral() != "unquote" {
+			return true
+		}
+		for _, arg := range call.Arguments {
+			ast.Walk(r, arg)
+		}
+		return false
+	})
+}
+
+// declareLets hoists the lets binding in the current scope
+func (r *resolver) declareLets(node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+			return false
+		case *ast.TryExpression: // the catch block has its own scope
+			r.declareLets(node.Block)
+			return false
+		case *ast.CallExpression:
+			return node.Function.TokenLiteral() != "quote"
+		case *ast.LetStatement:
+			if _, ok := r.scope.declared[node.Name.Value]; !ok {
+				r.scope.declared[node.Name.Value] = node.Name
+			}
+		}
+		return true
+	})
+}
+
+func (r *resolver) define(ident *ast.Identifier, kind string) {
+	s := r.scope
+	name := ident.Value
+	r.bindings[ident] = Binding{Ident: ident, Kind: kind}
+
+	b := &binding{ident: ident, kind: kind, used: s.late[name]}
+
+	if old, ok := s.defined[name]; ok { // a redefinition replaces the binding, as in the evaluator
+		b.used = b.used || old.used // e.g. by another branch of an if
+		s.defined[name] = b
+		for i := range s.order {
+			if s.order[i] == old {
+				s.order[i] = b
+			}
+		}
+		return
+	}
+
+	if shadowed, ok := r.shadowed(name); ok {
+		r.report(Warning, ident, "%s %s shadows %s", kind, name, shadowed)
+	}
+
+	s.defined[name] = b
+	s.order = append(s.order, b)
+}
+
+// shadowed describes the binding of an enclosing scope named name
+func (r *resolver) shadowed(name string) (string, bool) {
+	if r.scope.outer == nil { // bindings of a program replace former ones
+		return "", false
+	}
+
+	for s := r.scope.outer; s != nil; s = s.outer {
+		if b, ok := s.defined[name]; ok {
+			return fmt.Sprintf("the %s at %d:%d", b.kind, b.ident.Token.Line, b.ident.Token.Column), true
+		}
+		if ident, ok := s.declared[name]; ok {
+			return fmt.Sprintf("the let at %d:%d", ident.Token.Line, ident.Token.Column), true
+		}
+	}
+	for _, env := range r.envs {
+		if _, ok := env.Get(name); ok {
+			return "a binding of the environment", true
+		}
+	}
+	if _, ok := evaluator.LookupBuiltin(name); ok {
+		return "a builtin", true
+	}
+	return "", false
+}
+
+func (r *resolver) resolve(ident *ast.Identifier) {
+	name := ident.Value
+
+	late := false // whether bindings made later are available
+	for s := r.scope; s != nil; s = s.outer {
+		if b, ok := s.defined[name]; ok {
+			b.used = true
+			r.bindings[ident] = Binding{Ident: b.ident, Kind: b.kind}
+			return
+		}
+		if declared, ok := s.declared[name]; ok && late {
+			s.late[name] = true
+			r.bindings[ident] = Binding{Ident: declared, Kind: "let"}
+			return
+		}
+		if s.function {
+			late = true
+		}
+	}
+
+	for _, env := range r.envs {
+		if _, ok := env.Get(name); ok {
+			r.bindings[ident] = Binding{Kind: "environment"}
+			return
+		}
+	}
+	if _, ok := evaluator.LookupBuiltin(name); ok {
+		r.bindings[ident] = Binding{Kind: "builtin"}
+		return
+	}
+
+	r.report(Error, ident, "identifier not found: %s", name)
+}
+
+func (r *resolver) closeScope() {
+	for _, b := range r.scope.order {
+		if !b.used && !strings.HasPrefix(b.ident.Value, "_") {
+			r.report(Warning, b.ident, "%s %s is not used", b.kind, b.ident.Value)
+		}
+	}
+	r.scope = r.scope.outer
+}
+
+func (r *resolver) report(severity Severity, ident *ast.Identifier, format string, a ...interface{}) {
+	r.diagnostics = append(r.diagnostics, Diagnostic{
+		Severity: severity,
+		Message:  fmt.Sprintf(format, a...),
+		Line:     ident.Token.Line,
+		Column:   ident.Token.Column,
+	})
+}
@@ -0,0 +1,200 @@
+package resolver
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; x + len([])", []string{}},
+		{"foo", []string{"1:1: error: identifier not found: foo"}},
+		{"x; let x = 1;", []string{"1:1: error: identifier not found: x"}},
+		{"let x = x;", []string{"1:9: error: identifier not found: x"}},
+		{
+			// functions may refer to bindings made later
+			"let f = fn(n) { if (n == 0) { 0 } else { g(n - 1) } }; let g = fn(n) { f(n) }; f(3)",
+			[]string{},
+		},
+		{
+			"let f = fn() { y }; f()",
+			[]string{"1:16: error: identifier not found: y"},
+		},
+		{
+			// bindings of the function itself are made in order
+			"let f = fn() { let a = b; let b = 1; a }",
+			[]string{
+				"1:24: error: identifier not found: b",
+				"1:31: warning: let b is not used",
+			},
+		},
+		{
+			// blocks bind in the scope they are part of
+			"let f = fn(c) { if (c) { let a = 1 } else { let a = 2 }; a }",
+			[]string{},
+		},
+		{
+			"let f = fn(x, y) { x }",
+			[]string{"1:15: warning: parameter y is not used"},
+		},
+		{
+			"let f = fn(_unused) { let a = 1; 2 }",
+			[]string{"1:27: warning: let a is not used"},
+		},
+		{
+			"let x = 1; let f = fn(x) { x }",
+			[]string{"1:23: warning: parameter x shadows the let at 1:5"},
+		},
+		{
+			"let f = fn(len) { len }",
+			[]string{"1:12: warning: parameter len shadows a builtin"},
+		},
+		{
+			"let f = fn() { let x = 1; fn() { let x = 2; x } }",
+			[]string{
+				"1:20: warning: let x is not used",
+				"1:38: warning: let x shadows the let at 1:20",
+			},
+		},
+		{
+			"try { throw(1) } catch (e) { e }; e",
+			[]string{"1:35: error: identifier not found: e"},
+		},
+		{
+			"try { 1 } catch (e) { let a = 1; 2 }",
+			[]string{
+				"1:18: warning: catch parameter e is not used",
+				"1:27: warning: let a is not used",
+			},
+		},
+		{
+			// only the arguments of unquote are evaluated
+			"let m = macro(a) { quote(b + unquote(a)) }",
+			[]string{},
+		},
+		{
+			"quote(unquote(c))",
+			[]string{"1:15: error: identifier not found: c"},
+		},
+		{
+			"let m = macro(a, b) { quote(unquote(a)) }",
+			[]string{"1:18: warning: parameter b is not used"},
+		},
+	}
+
+	for _, tt := range tests {
+		diagnostics := Check(parse(t, tt.input))
+
+		got := []string{}
+		for _, d := range diagnostics {
+			got = append(got, d.String())
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("wrong diagnostics for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestCheckEnvironments(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("x", &object.Integer{Value: 1})
+	macros := object.NewEnvironment()
+	macros.Set("m", &object.Macro{})
+
+	diagnostics := Check(parse(t, "let y = m(x); let f = fn(x) { x + y }; z"), env, macros)
+
+	expected := []Diagnostic{
+		{Severity: Warning, Message: "parameter x shadows a binding of the environment", Line: 1, Column: 26},
+		{Severity: Error, Message: "identifier not found: z", Line: 1, Column: 40},
+	}
+	if !reflect.DeepEqual(diagnostics, expected) {
+		t.Errorf("wrong diagnostics.\nwant=%v\ngot= %v", expected, diagnostics)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("e", &object.Integer{Value: 1})
+	program := parse(t, "let f = fn(x) { g(x) + len(e) }; let g = fn(y) { y }; z")
+
+	tests := []struct {
+		name string
+		kind string
+		at   string // position of the binding identifier, empty if none
+	}{
+		{"f", "let", "1:5"},
+		{"x", "parameter", "1:12"},
+		{"g", "let", "1:38"},
+		{"len", "builtin", ""},
+		{"e", "environment", ""},
+		{"y", "parameter", "1:45"},
+	}
+
+	bindings := Resolve(program, env)
+	for _, tt := range tests {
+		found := false
+		ast.Inspect(program, func(node ast.Node) bool {
+			ident, ok := node.(*ast.Identifier)
+			if !ok || ident.Value != tt.name {
+				return true
+			}
+			found = true
+			b, ok := bindings[ident]
+			if !ok {
+				t.Errorf("%s at %d:%d is not bound", tt.name, ident.Token.Line, ident.Token.Column)
+				return true
+			}
+			at := ""
+			if b.Ident != nil {
+				at = fmt.Sprintf("%d:%d", b.Ident.Token.Line, b.Ident.Token.Column)
+			}
+			if b.Kind != tt.kind || at != tt.at {
+				t.Errorf("wrong binding of %s. want=%s %s, got=%s %s", tt.name, tt.kind, tt.at, b.Kind, at)
+			}
+			return true
+		})
+		if !found {
+			t.Errorf("identifier %s not found", tt.name)
+		}
+	}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok && ident.Value == "z" {
+			if _, ok := bindings[ident]; ok {
+				t.Errorf("unbound identifier z has a binding")
+			}
+		}
+		return true
+	})
+}
+
+func TestResolveRedefinition(t *testing.T) {
+	program := parse(t, "let x = 1; let x = 2; x")
+	use := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.Identifier)
+
+	b, ok := Resolve(program)[use]
+	if !ok || b.Ident == nil {
+		t.Fatalf("x is not bound by a let")
+	}
+	if b.Ident.Token.Line != 1 || b.Ident.Token.Column != 16 {
+		t.Errorf("x refers to the let at %d:%d, want the later one at 1:16", b.Ident.Token.Line, b.Ident.Token.Column)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
@@ -373,6 +373,42 @@ func (s *Session) init_commands() error {
 		return err
 	}
 
+	// process: infer
+	c_infer := &command{
+		name:     "inf[er]",
+		with_arg: s.exec_infer,
+		usage: []struct {
+			args string
+			msg  string
+		}{
+			{"~ <input>", "show type inferred for <input> without evaluating it\n\t and the type errors found"},
+		},
+	}
+	if err := commands.register("infer", c_infer); err != nil {
+		return err
+	}
+	if err := commands.register("inf", c_infer); err != nil {
+		return err
+	}
+
+	// process: infertree
+	c_infertree := &command{
+		name:     "i[nfer]tree",
+		with_arg: s.exec_infertree,
+		usage: []struct {
+			args string
+			msg  string
+		}{
+			{"~ <input>", "print tree representation of <input>' ast annotated with\n\t the types inferred to all set displays"},
+		},
+	}
+	if err := commands.register("infertree", c_infertree); err != nil {
+		return err
+	}
+	if err := commands.register("itree", c_infertree); err != nil {
+		return err
+	}
+
 	// process: trace
 	c_trace := &command{
 		name:     "tr[ace]",
@@ -381,7 +417,7 @@ func (s *Session) init_commands() error {
 			args string
 			msg  string
 		}{
-			{"~ <input>", "show evaluation trace interactively step by step"},
+			{"~ <input>", "show evaluation trace interactively step by step;\n\t steps can be taken back, over and out, h lists breakpoints, watches and more"},
 		},
 	}
 	if err := commands.register("trace", c_trace); err != nil {
@@ -390,6 +426,136 @@ func (s *Session) init_commands() error {
 	if err := commands.register("tr", c_trace); err != nil {
 		return err
 	}
+	// process: debug
+	c_debug := &command{
+		name:     "d[e]b[u]g",
+		with_arg: s.exec_debug,
+		usage: []struct {
+			args string
+			msg  string
+		}{
+			{"~ <input>", "step through the evaluation of <input> while it runs,\n\t without recording a trace; h lists the options"},
+		},
+	}
+	if err := commands.register("debug", c_debug); err != nil {
+		return err
+	}
+	if err := commands.register("dbg", c_debug); err != nil {
+		return err
+	}
+	// process: compile
+	c_compile := &command{
+		name:     "compile, disasm",
+		with_arg: s.exec_compile,
+		usage: []struct {
+			args string
+			msg  string
+		}{
+			{"~ <input>", "print the bytecode <input> is compiled to"},
+		},
+	}
+	if err := commands.register("compile", c_compile); err != nil {
+		return err
+	}
+	if err := commands.register("disasm", c_compile); err != nil {
+		return err
+	}
+	// process: check
+	c_check := &command{
+		name:     "[ch]eck",
+		with_arg: s.exec_check,
+		usage: []struct {
+			args string
+			msg  string
+		}{
+			{"~ <input>", "report unbound identifiers, shadowed and unused bindings\n\t of <input> without evaluating it"},
+		},
+	}
+	if err := commands.register("check", c_check); err != nil {
+		return err
+	}
+	if err := commands.register("ch", c_check); err != nil {
+		return err
+	}
+	// process: fmt
+	c_fmt := &command{
+		name:     "fmt",
+		with_arg: s.exec_fmt,
+		usage: []struct {
+			args string
+			msg  string
+		}{
+			{"~ <input>", "print <input> formatted canonically"},
+		},
+	}
+	if err := commands.register("fmt", c_fmt); err != nil {
+		return err
+	}
+	// process: expand
+	c_expand := &command{
+		name:     "ex[pand]",
+		with_arg: s.exec_expand,
+		usage: []struct {
+			args string
+			msg  string
+		}{
+			{"~ <input>", "show <input> before and after macro expansion\n\t and the parsetree of the expansion"},
+		},
+	}
+	if err := commands.register("expand", c_expand); err != nil {
+		return err
+	}
+	if err := commands.register("ex", c_expand); err != nil {
+		return err
+	}
+	// process: optimize
+	c_optimize := &command{
+		name:     "opt[imize]",
+		with_arg: s.exec_optimize,
+		usage: []struct {
+			args string
+			msg  string
+		}{
+			{"~ <input>", "show <input> next to its optimized version:\n\t constants folded and inlined, dead branches eliminated"},
+		},
+	}
+	if err := commands.register("optimize", c_optimize); err != nil {
+		return err
+	}
+	if err := commands.register("opt", c_optimize); err != nil {
+		return err
+	}
+	// process: vmtrace
+	c_vmtrace := &command{
+		name:     "vmtr[ace]",
+		with_arg: s.exec_vmtrace,
+		usage: []struct {
+			args string
+			msg  string
+		}{
+			{"~ <input>", "show the states of the virtual machine running <input>\n\t interactively step by step"},
+		},
+	}
+	if err := commands.register("vmtrace", c_vmtrace); err != nil {
+		return err
+	}
+	if err := commands.register("vmtr", c_vmtrace); err != nil {
+		return err
+	}
+	// process: serve
+	c_serve := &command{
+		name:     "serve",
+		with_arg: s.exec_serve,
+		usage: []struct {
+			args string
+			msg  string
+		}{
+			{"~ <input>", "present trees and evaluation trace of <input> on a local web page\n\t on which the steps can be scrubbed through; the page is updated\n\t by each further ~"},
+		},
+	}
+	if err := commands.register("serve", c_serve); err != nil {
+		return err
+	}
 	// process: evaltree
 	c_evaltree := &command{
 		name:     "e[val]tree",
@@ -434,15 +600,25 @@ func (s *Session) init_commands() error {
 			{"~ prompt <prompt>", "set prompt string to <prompt>"},
 			{"~ paste", "enable multiline support"},
 			{"~ level <l>", "<l> must be: p[rogram], s[tatement], e[xpression]"},
-			{"~ process <p>", "<p> must be: p[arse], p[arse]tree, e[val], e[val]tree,\n\t [t]ype, [tr]ace"},
-			{"~ logs <+|-l_0...+|-l_n>", "<l_i> must be: p[arse]tree, e[val]tree, [t]ype, [tr]ace"},
-			{"~ displays <+|-d_0...+|-d_n>", "<d_i> must be: c[ons[ole]], p[df]"},
+			{"~ process <p>", "<p> must be: p[arse], p[arse]tree, e[val], e[val]tree,\n\t [t]ype, [tr]ace, compile, vmtr[ace],\n\t ex[pand], fmt, [ch]eck, inf[er], i[nfer]tree,\n\t opt[imize]"},
+			{"~ logs <+|-l_0...+|-l_n>", "<l_i> must be: p[arse]tree, e[val]tree, [t]ype, [tr]ace, [ch]eck,\n\t inf[er]"},
+			{"~ displays <+|-d_0...+|-d_n>", "<d_i> must be: c[ons[ole]], p[df], d[ot], s[vg], m[ark]d[own], j[son]"},
 			{"~ verbosity <v>", "<v> must be 0, 1, 2"},
 			{"~ inclToken", "include tokens in representations of asts"},
 			{"~ inclEnv", "include environments in representations of asts"},
 			{"~ pfile <f>", "set file for parsetree to <f>"},
 			{"~ efile <f>", "set file for evaltree to <f>"},
+			{"~ pdotfile <f>", "set file for parsetree in DOT to <f>"},
+			{"~ edotfile <f>", "set file for evaltree in DOT to <f>"},
+			{"~ psvgfile <f>", "set file for parsetree in SVG to <f>"},
+			{"~ esvgfile <f>", "set file for evaltree in SVG to <f>"},
+			{"~ pjsonfile <f>", "set file for parsetree in JSON to <f>"},
+			{"~ ejsonfile <f>", "set file for evaluation trace in JSON to <f>"},
 			{"~ goObjType", "display Go type instead of Monkey type"},
+			{"~ maxsteps <n>", "abort evaluations after <n> steps, 0: no limit"},
+			{"~ maxdepth <n>", "abort evaluations after <n> nested calls, 0: no limit"},
+			{"~ timeout <d>", "abort evaluations after duration <d>, e.g. 500ms, 2s,\n\t 0: no limit"},
+			{"~ engine <e>", "<e> must be: tree, vm\n\t traces and evaltrees are always produced by tree"},
 		},
 	}
 	if err := commands.register("set", c_set); err != nil {
@@ -8,12 +8,19 @@ import (
 	"log"
 	"monkey/ast"
 	"monkey/evaluator"
+	"monkey/formatter"
 	"monkey/lexer"
 	"monkey/object"
+	"monkey/optimizer"
 	"monkey/parser"
+	"monkey/resolver"
+	"monkey/types"
+	"monkey/viewer"
 	"monkey/visualizer"
+	"monkey/vm"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
 )
 
@@ -46,7 +53,10 @@ type Session struct {
 	scanner       *bufio.Scanner
 	out           io.Writer
 	environment   *object.Environment
+	vmState       *vm.State           // of the virtual machines evaluating in environment
+	macros        *object.Environment // the macros defined so far
 	path_pdflatex string
+	viewer        *viewer.Server // started by the first :serve
 }
 
 // NewSession creates a new Session.
@@ -61,8 +71,10 @@ func NewSession(in io.Reader, out io.Writer) (*Session, error) {
 		scanner:       bufio.NewScanner(in),
 		out:           out,
 		environment:   object.NewEnvironment(),
+		macros:        object.NewEnvironment(),
 		path_pdflatex: path,
 	}
+	s.vmState = vm.NewState(s.environment)
 
 	if err := s.init_commands(); err != nil {
 		return nil, err
@@ -125,6 +137,8 @@ func (s *Session) f_exec_clearscreen() func() {
 // environment
 func (s *Session) exec_clear() {
 	s.environment = object.NewEnvironment()
+	s.vmState = vm.NewState(s.environment)
+	s.macros = object.NewEnvironment()
 }
 
 func (s *Session) exec_list() {
@@ -227,6 +241,46 @@ func (s *Session) exec_trace(line string) {
 	s.process_input_dim(currentSettings.paste, currentSettings.level, TraceP, line)
 }
 
+func (s *Session) exec_compile(line string) {
+	s.process_input_dim(currentSettings.paste, currentSettings.level, CompileP, line)
+}
+
+func (s *Session) exec_infer(line string) {
+	s.process_input_dim(currentSettings.paste, currentSettings.level, InferP, line)
+}
+
+func (s *Session) exec_infertree(line string) {
+	s.process_input_dim(currentSettings.paste, currentSettings.level, InferTreeP, line)
+}
+
+func (s *Session) exec_optimize(line string) {
+	s.process_input_dim(currentSettings.paste, currentSettings.level, OptimizeP, line)
+}
+
+func (s *Session) exec_check(line string) {
+	s.process_input_dim(currentSettings.paste, currentSettings.level, CheckP, line)
+}
+
+func (s *Session) exec_fmt(line string) {
+	s.process_input_dim(currentSettings.paste, currentSettings.level, FormatP, line)
+}
+
+func (s *Session) exec_expand(line string) {
+	s.process_input_dim(currentSettings.paste, currentSettings.level, ExpandP, line)
+}
+
+func (s *Session) exec_vmtrace(line string) {
+	s.process_input_dim(currentSettings.paste, currentSettings.level, VmTraceP, line)
+}
+
+func (s *Session) exec_debug(line string) {
+	s.process_input_dim(currentSettings.paste, currentSettings.level, DebugP, line)
+}
+
+func (s *Session) exec_serve(line string) {
+	s.process_input_dim(currentSettings.paste, currentSettings.level, ServeP, line)
+}
+
 func (s *Session) exec_evaltree(line string) {
 	s.process_input_dim(currentSettings.paste, currentSettings.level, EvalTreeP, line)
 }
@@ -244,6 +298,8 @@ func (s *Session) process_input_dim(paste bool, level inputLevel, process inputP
 	logType := false
 	logTrace := false
 	logEtree := false
+	logCheck := false
+	logInfer := false
 
 	if process == ParseP {
 		logPtree = currentSettings.logs[ParseTreeP]
@@ -253,6 +309,8 @@ func (s *Session) process_input_dim(paste bool, level inputLevel, process inputP
 		logTrace = currentSettings.logs[TraceP]
 		logPtree = currentSettings.logs[ParseTreeP]
 		logEtree = currentSettings.logs[EvalTreeP]
+		logCheck = currentSettings.logs[CheckP]
+		logInfer = currentSettings.logs[InferP]
 	}
 
 	// parse input dependent on LEVEL
@@ -263,66 +321,153 @@ func (s *Session) process_input_dim(paste bool, level inputLevel, process inputP
 
 	// PROCESS / [ LOGs ]
 
-	if process == ParseTreeP || logPtree {
-		if currentSettings.displays[ConsD] {
-			if process != ParseTreeP {
-				fmt.Fprint(s.out, "log parsetree:\n")
+	if process == ParseTreeP {
+		s.display_parsetree(input, node, "")
+	} else if logPtree {
+		s.display_parsetree(input, node, "log parsetree:\n")
+	}
+
+	if process == ParseP {
+		fmt.Fprintln(s.out, node) // Stringer method
+	}
+
+	if len(p.Errors()) != 0 {
+		s.printParserErrors(input, p.Errors(), level)
+		return
+	}
+
+	if process == ParseP || process == ParseTreeP { // in these cases, we do not care about logging related to evaluation
+		return
+	}
+
+	if process == FormatP {
+		fmt.Fprintln(s.out, formatter.Format(node))
+		return
+	}
+
+	if process == CheckP || logCheck {
+		diagnostics := resolver.Check(node, s.environment, s.macros)
+		if process == CheckP {
+			if len(diagnostics) == 0 {
+				fmt.Fprintln(s.out, "no problems found")
 			}
-			consPtree := visualizer.ConsParseTree(
-				node,
-				currentSettings.verbosity,
-				currentSettings.inclToken,
-				prefixCons,
-				indentCons,
-			)
-			//fmt.Fprintln(s.out, "display ptree in console: ")
-			fmt.Fprintln(s.out, consPtree)
+		} else if len(diagnostics) != 0 {
+			fmt.Fprint(s.out, "log check:\n")
+		}
+		for _, d := range diagnostics {
+			fmt.Fprintln(s.out, d)
+		}
+		if process == CheckP {
+			return
+		}
+	}
 
+	// macros are defined and expanded before the input is processed any further;
+	// the expansion evaluates the bodies of macros, so it is bounded and can be interrupted
+	unexpanded := node.String()
+	var err error
+	s.interruptible(func() {
+		if program, ok := node.(*ast.Program); ok {
+			evaluator.DefineMacros(program, s.macros)
 		}
-		if currentSettings.displays[PdfD] {
-			if !s.supportsPdflatex() {
-				fmt.Fprintln(s.out, "Displaying trees as pdfs is not available to you, since you have not installed pdflatex.")
-			} else {
-				err := visualizer.TeXParseTree(input, node, currentSettings.verbosity, currentSettings.inclToken, currentSettings.pfile, s.path_pdflatex)
-				if err != nil {
-					fmt.Fprintln(s.out, err)
-				} else {
-					fmt.Fprintf(s.out, "parsetree is printed to %v\n", currentSettings.pfile)
+		node, err = evaluator.ExpandMacros(node, s.macros)
+	})
+	if err != nil {
+		fmt.Fprintf(s.out, "... cannot be expanded: %v\n", err)
+		return
+	}
 
-				}
-			}
+	if process == ExpandP {
+		fmt.Fprintf(s.out, "before:\t%s\n", unexpanded)
+		fmt.Fprintf(s.out, "after:\t%s\n", node)
+		s.display_parsetree(node.String(), node, "parsetree of the expansion:\n")
+		return
+	}
+
+	if process == OptimizeP {
+		s.display_optimization(node, optimizer.Optimize(node))
+		return
+	}
+
+	if process == InferP || process == InferTreeP || logInfer {
+		info := types.Infer(node, s.environment)
+		if process == InferTreeP {
+			s.display_typetree(input, node, info)
+			return
+		}
+		if process != InferP {
+			fmt.Fprint(s.out, "log infer:\t")
+		}
+		fmt.Fprintln(s.out, info.Type)
+		for _, err := range info.Errors {
+			fmt.Fprintln(s.out, err)
+		}
+		if process == InferP {
+			return
 		}
 	}
 
-	if process == ParseP {
-		fmt.Fprintln(s.out, node) // Stringer method
+	if process == CompileP {
+		bytecode, err := s.vmState.Compile(node)
+		if err != nil {
+			fmt.Fprintf(s.out, "... cannot be compiled: %v\n", err)
+			return
+		}
+		fmt.Fprint(s.out, bytecode.Disassemble())
+		return
 	}
 
-	if len(p.Errors()) != 0 {
-		s.printParserErrors(p.Errors(), level)
+	if process == VmTraceP {
+		var trace *vm.Trace
+		s.interruptible(func() {
+			_, trace = s.vmState.EvalTrace(node)
+		})
+		visualizer.VmTraceInteractive(trace, s.out, s.scanner, currentSettings.verbosity, currentSettings.goObjType)
 		return
 	}
 
-	if process == ParseP || process == ParseTreeP { // in these cases, we do not care about logging related to evaluation
+	if process == DebugP { // the evaluator is consulted while it runs, nothing is recorded
+		s.noteTreeEngine("debugging")
+		var obj object.Object
+		s.interruptible(func() {
+			debugger := visualizer.NewConsDebugger(s.out, s.scanner, currentSettings.verbosity, currentSettings.goObjType)
+			obj = evaluator.EvalD(node, s.environment, debugger)
+		})
+		if obj != nil {
+			fmt.Fprintln(s.out, obj.Inspect())
+		}
 		return
 	}
 
 	// evaluate ast - trace dependent on process + DISPLAYED logs
 
 	trace_required := false
-	if process == TraceP || process == EvalTreeP || logTrace || logEtree {
+	if process == TraceP || process == EvalTreeP || process == ServeP || logTrace || logEtree {
 		trace_required = true
 	}
 
 	obj, trace := s.eval_process(node, trace_required)
 
 	if process == TraceP {
+		if currentSettings.displays[MdD] { // to be pasted, not stepped through
+			visualizer.TraceMarkdown(trace, s.out, currentSettings.verbosity, currentSettings.goObjType)
+			return
+		}
 		visualizer.TraceInteractive(trace, s.out, s.scanner, currentSettings.verbosity, currentSettings.goObjType)
 		return // no additional evaluation logging !
 	}
 
+	if process == ServeP {
+		s.serve(input, node, trace)
+		return
+	}
+
 	if logTrace {
-		visualizer.TraceTable(trace, s.out, currentSettings.verbosity, currentSettings.goObjType)
+		if currentSettings.displays[MdD] {
+			visualizer.TraceMarkdown(trace, s.out, currentSettings.verbosity, currentSettings.goObjType)
+		} else {
+			visualizer.TraceTable(trace, s.out, currentSettings.verbosity, currentSettings.goObjType)
+		}
 	}
 
 	if process == TypeP || logType {
@@ -354,7 +499,7 @@ func (s *Session) process_input_dim(paste bool, level inputLevel, process inputP
 		}
 		if currentSettings.displays[PdfD] {
 			if !s.supportsPdflatex() {
-				fmt.Fprintln(s.out, "Displaying trees as pdfs is not available to you, since you have not installed pdflatex.")
+				fmt.Fprintln(s.out, "Displaying trees as pdfs is not available to you, since you have not installed pdflatex. Try :set displays +svg")
 			} else {
 				err := visualizer.TeXEvalTree(
 					input,
@@ -373,6 +518,48 @@ func (s *Session) process_input_dim(paste bool, level inputLevel, process inputP
 
 			}
 		}
+		if currentSettings.displays[DotD] {
+			err := visualizer.DotEvalTree(
+				input,
+				trace,
+				currentSettings.verbosity,
+				currentSettings.inclToken,
+				currentSettings.goObjType,
+				currentSettings.inclEnv,
+				currentSettings.edotfile)
+			if err != nil {
+				fmt.Fprintln(s.out, err)
+			} else {
+				fmt.Fprintf(s.out, "evaltree is written to %v\n", currentSettings.edotfile)
+			}
+		}
+		if currentSettings.displays[SvgD] {
+			err := visualizer.SvgEvalTree(
+				input,
+				trace,
+				currentSettings.verbosity,
+				currentSettings.inclToken,
+				currentSettings.goObjType,
+				currentSettings.inclEnv,
+				currentSettings.esvgfile)
+			if err != nil {
+				fmt.Fprintln(s.out, err)
+			} else {
+				fmt.Fprintf(s.out, "evaltree is written to %v\n", currentSettings.esvgfile)
+			}
+		}
+		if currentSettings.displays[MdD] {
+			fmt.Fprintln(s.out, visualizer.MermaidEvalTree(
+				trace,
+				currentSettings.verbosity,
+				currentSettings.inclToken,
+				currentSettings.goObjType,
+				currentSettings.inclEnv))
+		}
+		if currentSettings.displays[JsonD] {
+			json, err := visualizer.JsonEvalTrace(trace)
+			s.write_json(json, err, currentSettings.ejsonfile, "evaluation trace")
+		}
 
 		if process == EvalTreeP {
 			return
@@ -383,6 +570,9 @@ func (s *Session) process_input_dim(paste bool, level inputLevel, process inputP
 		if obj != nil { // TODO: Umgang mit nil würdig?
 			fmt.Fprintln(s.out, obj.Inspect())
 		}
+		if err, ok := obj.(*object.Error); ok {
+			fmt.Fprint(s.out, err.StackTrace())
+		}
 		// } else {
 		// 	fmt.Fprintln(s.out, nil)
 		// }
@@ -390,6 +580,157 @@ func (s *Session) process_input_dim(paste bool, level inputLevel, process inputP
 
 }
 
+// display_parsetree displays the parsetree of node as the displays are set;
+// the header precedes the tree in the console
+func (s *Session) display_parsetree(input string, node ast.Node, header string) {
+	if currentSettings.displays[ConsD] {
+		fmt.Fprint(s.out, header)
+		consPtree := visualizer.ConsParseTree(
+			node,
+			currentSettings.verbosity,
+			currentSettings.inclToken,
+			prefixCons,
+			indentCons,
+		)
+		//fmt.Fprintln(s.out, "display ptree in console: ")
+		fmt.Fprintln(s.out, consPtree)
+
+	}
+	if currentSettings.displays[PdfD] {
+		if !s.supportsPdflatex() {
+			fmt.Fprintln(s.out, "Displaying trees as pdfs is not available to you, since you have not installed pdflatex. Try :set displays +svg")
+		} else {
+			err := visualizer.TeXParseTree(input, node, currentSettings.verbosity, currentSettings.inclToken, currentSettings.pfile, s.path_pdflatex)
+			if err != nil {
+				fmt.Fprintln(s.out, err)
+			} else {
+				fmt.Fprintf(s.out, "parsetree is printed to %v\n", currentSettings.pfile)
+
+			}
+		}
+	}
+	if currentSettings.displays[DotD] {
+		err := visualizer.DotParseTree(input, node, currentSettings.verbosity, currentSettings.inclToken, currentSettings.pdotfile)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+		} else {
+			fmt.Fprintf(s.out, "parsetree is written to %v\n", currentSettings.pdotfile)
+		}
+	}
+	if currentSettings.displays[SvgD] {
+		err := visualizer.SvgParseTree(input, node, currentSettings.verbosity, currentSettings.inclToken, currentSettings.psvgfile)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+		} else {
+			fmt.Fprintf(s.out, "parsetree is written to %v\n", currentSettings.psvgfile)
+		}
+	}
+	if currentSettings.displays[MdD] {
+		fmt.Fprintln(s.out, visualizer.MermaidParseTree(node, currentSettings.verbosity, currentSettings.inclToken))
+	}
+	if currentSettings.displays[JsonD] {
+		json, err := visualizer.JsonParseTree(node)
+		s.write_json(json, err, currentSettings.pjsonfile, "parsetree")
+	}
+}
+
+// display_optimization shows the sources and, in the console, the parsetrees
+// of node and its optimized version side by side
+func (s *Session) display_optimization(node ast.Node, optimized ast.Node) {
+	column := func(header string, node ast.Node) string {
+		col := header + "\n" + formatter.Format(node)
+		if currentSettings.displays[ConsD] {
+			tree := visualizer.ConsParseTree(node, currentSettings.verbosity, currentSettings.inclToken, prefixCons, indentCons)
+			col += "\n\n" + strings.TrimLeft(tree, "\n")
+		}
+		return col
+	}
+
+	fmt.Fprintln(s.out, visualizer.SideBySide(column("original:", node), column("optimized:", optimized), 4))
+}
+
+// display_typetree displays the parsetree of node annotated with the types of info
+func (s *Session) display_typetree(input string, node ast.Node, info *types.Info) {
+	if currentSettings.displays[ConsD] {
+		consTtree := visualizer.ConsTypeTree(
+			node,
+			info,
+			currentSettings.verbosity,
+			currentSettings.inclToken,
+			prefixCons,
+			indentCons,
+		)
+		fmt.Fprintln(s.out, consTtree)
+		for _, err := range info.Errors {
+			fmt.Fprintln(s.out, err)
+		}
+	}
+	if currentSettings.displays[PdfD] {
+		if !s.supportsPdflatex() {
+			fmt.Fprintln(s.out, "Displaying trees as pdfs is not available to you, since you have not installed pdflatex. Try :set displays +svg")
+		} else {
+			err := visualizer.TeXTypeTree(input, node, info, currentSettings.verbosity, currentSettings.inclToken, currentSettings.pfile, s.path_pdflatex)
+			if err != nil {
+				fmt.Fprintln(s.out, err)
+			} else {
+				fmt.Fprintf(s.out, "typed parsetree is printed to %v\n", currentSettings.pfile)
+			}
+		}
+	}
+	if currentSettings.displays[DotD] {
+		err := visualizer.DotTypeTree(input, node, info, currentSettings.verbosity, currentSettings.inclToken, currentSettings.pdotfile)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+		} else {
+			fmt.Fprintf(s.out, "typed parsetree is written to %v\n", currentSettings.pdotfile)
+		}
+	}
+	if currentSettings.displays[SvgD] {
+		err := visualizer.SvgTypeTree(input, node, info, currentSettings.verbosity, currentSettings.inclToken, currentSettings.psvgfile)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+		} else {
+			fmt.Fprintf(s.out, "typed parsetree is written to %v\n", currentSettings.psvgfile)
+		}
+	}
+	if currentSettings.displays[MdD] {
+		fmt.Fprintln(s.out, visualizer.MermaidTypeTree(node, info, currentSettings.verbosity, currentSettings.inclToken))
+	}
+	if currentSettings.displays[JsonD] {
+		json, err := visualizer.JsonTypeTree(node, info)
+		s.write_json(json, err, currentSettings.pjsonfile, "typed parsetree")
+	}
+}
+
+// write_json writes json, unless it could not be created, to file and reports it as what
+func (s *Session) write_json(json string, err error, file string, what string) {
+	if err == nil {
+		err = visualizer.WriteJson(json, file)
+	}
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+	} else {
+		fmt.Fprintf(s.out, "%v is written to %v\n", what, file)
+	}
+}
+
+// serve presents the trace on the page of the viewer, which is started if necessary
+func (s *Session) serve(input string, node ast.Node, trace *evaluator.Trace) {
+	if s.viewer == nil {
+		server, err := viewer.Start("127.0.0.1:0")
+		if err != nil {
+			fmt.Fprintf(s.out, "... cannot be served: %v\n", err)
+			return
+		}
+		s.viewer = server
+	}
+	if err := s.viewer.Show(input, node, trace, currentSettings.verbosity); err != nil {
+		fmt.Fprintf(s.out, "... cannot be served: %v\n", err)
+		return
+	}
+	fmt.Fprintf(s.out, "trace is served at %v\n", s.viewer.URL())
+}
+
 func parse_level(p *parser.Parser, level inputLevel) ast.Node {
 	switch level {
 	case ExpressionL:
@@ -405,8 +746,57 @@ func parse_level(p *parser.Parser, level inputLevel) ast.Node {
 
 func (s *Session) eval_process(node ast.Node, trace_required bool) (object.Object, *evaluator.Trace) {
 
-	return evaluator.EvalT(node, s.environment, trace_required)
+	var obj object.Object
+	var trace *evaluator.Trace
+
+	if trace_required {
+		s.noteTreeEngine("traces and evaltrees")
+	}
+	s.interruptible(func() {
+		if currentSettings.engine == VmE && !trace_required {
+			obj = s.vmState.Eval(node)
+			return
+		}
+		obj, trace = evaluator.EvalT(node, s.environment, trace_required)
+	})
+
+	return obj, trace
+}
 
+// noteTreeEngine tells that the evaluator is used for what, though the engine is vm
+func (s *Session) noteTreeEngine(what string) {
+	if currentSettings.engine == VmE {
+		fmt.Fprintf(s.out, "note: engine vm does not support %s, evaluating with engine tree (see :vmtrace)\n", what)
+	}
+}
+
+// interruptible runs an evaluation within the limits of the settings
+func (s *Session) interruptible(eval func()) {
+
+	evaluator.ResetInterrupt() // of a former evaluation, interrupted after it had returned
+	evaluator.SetLimits(evaluator.Limits{
+		MaxSteps: currentSettings.maxSteps,
+		MaxDepth: currentSettings.maxDepth,
+		Timeout:  currentSettings.timeout,
+	})
+
+	// Ctrl-C interrupts the evaluation instead of the session
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	done := make(chan struct{})
+	defer func() {
+		signal.Stop(interrupts)
+		close(done)
+	}()
+	go func() {
+		select {
+		case <-interrupts:
+			evaluator.Interrupt()
+		case <-done:
+		}
+	}()
+
+	eval()
 }
 
 func (s *Session) supportsPdflatex() bool {
@@ -429,11 +819,40 @@ func (s *Session) multiline_input(input string) string {
 	}
 }
 
-func (s *Session) printParserErrors(errors []string, level inputLevel) {
+func (s *Session) printParserErrors(input string, errors []*parser.ParseError, level inputLevel) {
 
 	fmt.Fprintf(s.out, "... cannot be parsed as %v\n", level)
 	//io.WriteString(s.out, " parser errors:\n")
-	for _, msg := range errors {
-		fmt.Fprintf(s.out, "\t%v\n", msg)
+	lines := strings.Split(input, "\n")
+	for _, err := range errors {
+		fmt.Fprintf(s.out, "\t%s: %v\n", err.Position(), err)
+		if err.Span.Line <= len(lines) {
+			line := lines[err.Span.Line-1]
+			fmt.Fprintf(s.out, "\t\t%s\n", line)
+			fmt.Fprintf(s.out, "\t\t%s\n", caret(line, err.Span))
+		}
+		if err.Hint != "" {
+			fmt.Fprintf(s.out, "\t\thint: %s\n", err.Hint)
+		}
+	}
+}
+
+// caret underlines the span within line; tabs are kept to stay aligned
+func caret(line string, span parser.Span) string {
+	var out strings.Builder
+	for i, ch := range line {
+		if i >= span.Column-1 {
+			break
+		}
+		if ch == '\t' {
+			out.WriteRune('\t')
+		} else {
+			out.WriteRune(' ')
+		}
+	}
+	if span.Column-1 > len(line) { // e.g. the end of the input after a trailing blank
+		out.WriteString(strings.Repeat(" ", span.Column-1-len(line)))
 	}
+	out.WriteString(strings.Repeat("^", span.Length))
+	return out.String()
 }
@@ -0,0 +1,56 @@
+package session
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDefaultLimits(t *testing.T) {
+	var out bytes.Buffer
+	s, err := NewSession(strings.NewReader(""), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a tail call does not reach maxdepth
+	s.exec_cmd("let f = fn(x) { f(x) }; f(1)")
+
+	if !strings.Contains(out.String(), "step limit exceeded") {
+		t.Errorf("expected the evaluation to exceed the step limit, got %q", out.String())
+	}
+}
+
+func TestTraceWithEngineVm(t *testing.T) {
+	var out bytes.Buffer
+	s, err := NewSession(strings.NewReader(""), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { currentSettings = newSettings() })
+
+	s.exec_cmd(":set engine vm")
+	s.exec_cmd(":set logs +trace")
+	s.exec_cmd("1 + 2")
+
+	if !strings.Contains(out.String(), "engine vm does not support traces") {
+		t.Errorf("expected a note on the engine, got %q", out.String())
+	}
+}
+
+func TestMacroLimits(t *testing.T) {
+	var out bytes.Buffer
+	s, err := NewSession(strings.NewReader(""), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { currentSettings = newSettings() })
+
+	// the first input, the limits have not been set by an evaluation before
+	s.exec_cmd(":set maxsteps 1000")
+	s.exec_cmd("let m = macro() { let f = fn(x) { f(x) }; f(1) }; m()")
+
+	if !strings.Contains(out.String(), "cannot be expanded: macro m: step limit exceeded: 1000") {
+		t.Errorf("expected the expansion to exceed the step limit, got %q", out.String())
+	}
+}
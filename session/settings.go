@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
 )
@@ -21,7 +22,17 @@ type settings struct {
 	inclEnv   bool
 	pfile     string
 	efile     string
+	pdotfile  string
+	edotfile  string
+	psvgfile  string
+	esvgfile  string
+	pjsonfile string
+	ejsonfile string
 	goObjType bool
+	maxSteps  int
+	maxDepth  int
+	timeout   time.Duration
+	engine    engine
 }
 
 func newSettings() *settings {
@@ -29,12 +40,18 @@ func newSettings() *settings {
 	displays := visDisplays{
 		ConsD: true,
 		PdfD:  false,
+		DotD:  false,
+		SvgD:  false,
+		MdD:   false,
+		JsonD: false,
 	}
 	logs := logs{
 		ParseTreeP: false,
 		EvalTreeP:  false,
 		TypeP:      false,
 		TraceP:     false,
+		CheckP:     false,
+		InferP:     false,
 	}
 
 	s := settings{
@@ -49,7 +66,17 @@ func newSettings() *settings {
 		inclEnv:   false,
 		pfile:     "pTree.pdf",
 		efile:     "eTree.pdf",
+		pdotfile:  "pTree.dot",
+		edotfile:  "eTree.dot",
+		psvgfile:  "pTree.svg",
+		esvgfile:  "eTree.svg",
+		pjsonfile: "pTree.json",
+		ejsonfile: "eTrace.json",
 		goObjType: false,
+		maxSteps:  10000000,
+		maxDepth:  10000,
+		timeout:   0,
+		engine:    TreeE,
 	}
 
 	return &s
@@ -82,7 +109,17 @@ func menuSettings() string {
 	t.AppendRow([]interface{}{"inclEnv", currentSettings.inclEnv, defaultSettings.inclEnv})
 	t.AppendRow([]interface{}{"pfile", currentSettings.pfile, defaultSettings.pfile})
 	t.AppendRow([]interface{}{"efile", currentSettings.efile, defaultSettings.efile})
+	t.AppendRow([]interface{}{"pdotfile", currentSettings.pdotfile, defaultSettings.pdotfile})
+	t.AppendRow([]interface{}{"edotfile", currentSettings.edotfile, defaultSettings.edotfile})
+	t.AppendRow([]interface{}{"psvgfile", currentSettings.psvgfile, defaultSettings.psvgfile})
+	t.AppendRow([]interface{}{"esvgfile", currentSettings.esvgfile, defaultSettings.esvgfile})
+	t.AppendRow([]interface{}{"pjsonfile", currentSettings.pjsonfile, defaultSettings.pjsonfile})
+	t.AppendRow([]interface{}{"ejsonfile", currentSettings.ejsonfile, defaultSettings.ejsonfile})
 	t.AppendRow([]interface{}{"goObjType", currentSettings.goObjType, defaultSettings.goObjType})
+	t.AppendRow([]interface{}{"maxsteps", currentSettings.maxSteps, defaultSettings.maxSteps})
+	t.AppendRow([]interface{}{"maxdepth", currentSettings.maxDepth, defaultSettings.maxDepth})
+	t.AppendRow([]interface{}{"timeout", currentSettings.timeout, defaultSettings.timeout})
+	t.AppendRow([]interface{}{"engine", currentSettings.engine, defaultSettings.engine})
 
 	//t.SetStyle(table.StyleColoredBright)
 	t.Render()
@@ -175,6 +212,70 @@ func set(input string) bool {
 			}
 			currentSettings.efile = arg
 			return true
+		case "pdotfile":
+			if !strings.HasSuffix(arg, ".dot") {
+				arg = arg + ".dot"
+			}
+			currentSettings.pdotfile = arg
+			return true
+		case "edotfile":
+			if !strings.HasSuffix(arg, ".dot") {
+				arg = arg + ".dot"
+			}
+			currentSettings.edotfile = arg
+			return true
+		case "psvgfile":
+			if !strings.HasSuffix(arg, ".svg") {
+				arg = arg + ".svg"
+			}
+			currentSettings.psvgfile = arg
+			return true
+		case "esvgfile":
+			if !strings.HasSuffix(arg, ".svg") {
+				arg = arg + ".svg"
+			}
+			currentSettings.esvgfile = arg
+			return true
+		case "pjsonfile":
+			if !strings.HasSuffix(arg, ".json") {
+				arg = arg + ".json"
+			}
+			currentSettings.pjsonfile = arg
+			return true
+		case "ejsonfile":
+			if !strings.HasSuffix(arg, ".json") {
+				arg = arg + ".json"
+			}
+			currentSettings.ejsonfile = arg
+			return true
+		case "maxsteps":
+			i, err := strconv.Atoi(arg)
+			if err == nil && 0 <= i {
+				currentSettings.maxSteps = i
+				return true
+			}
+		case "maxdepth":
+			i, err := strconv.Atoi(arg)
+			if err == nil && 0 <= i {
+				currentSettings.maxDepth = i
+				return true
+			}
+		case "timeout":
+			if arg == "0" {
+				currentSettings.timeout = 0
+				return true
+			}
+			d, err := time.ParseDuration(arg)
+			if err == nil && 0 <= d {
+				currentSettings.timeout = d
+				return true
+			}
+		case "engine":
+			engine, ok := getEngine(arg)
+			if ok {
+				currentSettings.engine = engine
+				return true
+			}
 		}
 	}
 	return false
@@ -208,8 +309,28 @@ func reset(input string) bool {
 		currentSettings.pfile = defaultSettings.pfile
 	case "efile":
 		currentSettings.efile = defaultSettings.efile
+	case "pdotfile":
+		currentSettings.pdotfile = defaultSettings.pdotfile
+	case "edotfile":
+		currentSettings.edotfile = defaultSettings.edotfile
+	case "psvgfile":
+		currentSettings.psvgfile = defaultSettings.psvgfile
+	case "esvgfile":
+		currentSettings.esvgfile = defaultSettings.esvgfile
+	case "pjsonfile":
+		currentSettings.pjsonfile = defaultSettings.pjsonfile
+	case "ejsonfile":
+		currentSettings.ejsonfile = defaultSettings.ejsonfile
 	case "goObjType":
 		currentSettings.goObjType = defaultSettings.goObjType
+	case "maxsteps":
+		currentSettings.maxSteps = defaultSettings.maxSteps
+	case "maxdepth":
+		currentSettings.maxDepth = defaultSettings.maxDepth
+	case "timeout":
+		currentSettings.timeout = defaultSettings.timeout
+	case "engine":
+		currentSettings.engine = defaultSettings.engine
 	default:
 		return false
 	}
@@ -260,6 +381,16 @@ const (
 	EvalTreeP
 	TypeP
 	TraceP
+	CompileP
+	VmTraceP
+	ExpandP
+	FormatP
+	CheckP
+	InferP
+	InferTreeP
+	OptimizeP
+	ServeP
+	DebugP
 )
 
 func (i inputProcess) String() string {
@@ -276,6 +407,26 @@ func (i inputProcess) String() string {
 		return "type"
 	case TraceP:
 		return "trace"
+	case CompileP:
+		return "compile"
+	case VmTraceP:
+		return "vmtrace"
+	case ExpandP:
+		return "expand"
+	case FormatP:
+		return "fmt"
+	case CheckP:
+		return "check"
+	case InferP:
+		return "infer"
+	case InferTreeP:
+		return "infertree"
+	case OptimizeP:
+		return "optimize"
+	case ServeP:
+		return "serve"
+	case DebugP:
+		return "debug"
 	default:
 		return fmt.Sprintf("%d", int(i))
 	}
@@ -296,16 +447,70 @@ func getInputProcess(s string) (inputProcess, bool) {
 		return TypeP, true
 	case "tr", "trace":
 		return TraceP, true
+	case "compile", "disasm":
+		return CompileP, true
+	case "vmtr", "vmtrace":
+		return VmTraceP, true
+	case "ex", "expand":
+		return ExpandP, true
+	case "fmt", "format":
+		return FormatP, true
+	case "ch", "check":
+		return CheckP, true
+	case "inf", "infer":
+		return InferP, true
+	case "itree", "infertree":
+		return InferTreeP, true
+	case "opt", "optimize":
+		return OptimizeP, true
+	case "serve":
+		return ServeP, true
+	case "dbg", "debug":
+		return DebugP, true
 	default:
 		return EvalP, false
 	}
 }
 
+type engine int
+
+const (
+	TreeE engine = iota // evaluator
+	VmE                 // compiler and virtual machine
+)
+
+func (e engine) String() string {
+	switch e {
+	case TreeE:
+		return "tree"
+	case VmE:
+		return "vm"
+	default:
+		return fmt.Sprintf("%d", int(e))
+	}
+}
+
+func getEngine(s string) (engine, bool) {
+
+	switch s {
+	case "tree":
+		return TreeE, true
+	case "vm":
+		return VmE, true
+	default:
+		return TreeE, false
+	}
+}
+
 type Display int
 
 const (
 	ConsD Display = iota
 	PdfD
+	DotD
+	SvgD
+	MdD
+	JsonD
 )
 
 func (d Display) String() string {
@@ -314,6 +519,14 @@ func (d Display) String() string {
 		return "console"
 	case PdfD:
 		return "pdf"
+	case DotD:
+		return "dot"
+	case SvgD:
+		return "svg"
+	case MdD:
+		return "markdown"
+	case JsonD:
+		return "json"
 	default:
 		return fmt.Sprintf("%d", int(d))
 	}
@@ -354,6 +567,14 @@ func setDisplays(current visDisplays, arg string) bool {
 			current[ConsD] = val
 		case "p", "pdf":
 			current[PdfD] = val
+		case "d", "dot":
+			current[DotD] = val
+		case "s", "svg":
+			current[SvgD] = val
+		case "m", "md", "markdown", "mermaid":
+			current[MdD] = val
+		case "j", "json":
+			current[JsonD] = val
 		default:
 			return false
 		}
@@ -403,6 +624,10 @@ func setLogs(current logs, arg string) bool {
 			current[TypeP] = val
 		case "tr", "trace":
 			current[TraceP] = val
+		case "ch", "check":
+			current[CheckP] = val
+		case "inf", "infer":
+			current[InferP] = val
 		default:
 			return false
 		}
@@ -45,11 +45,16 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	MACRO    = "MACRO"
 )
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // line of the first character, starting at 1
+	Column  int // column of the first character, starting at 1
 }
 
 var keywords = map[string]TokenType{
@@ -60,6 +65,9 @@ var keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"try":    TRY,
+	"catch":  CATCH,
+	"macro":  MACRO,
 }
 
 func LookupIdent(ident string) TokenType {
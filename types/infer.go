@@ -0,0 +1,640 @@
+package types
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"sort"
+)
+
+/*
+The inferencer follows Hindley-Milner: every let binding gets the most general type of its value,
+e.g. `let id = fn(x) { x }` binds id to FUNCTION(a) -> a, which can be applied to values of any type.
+
+Type errors are reported where the evaluator would fail, whatever the values are:
+operands of operators, calls of non-functions, missing arguments, arguments that do not fit
+the parameters, indexes of values that cannot be indexed, unusable hash keys.
+Identifiers neither bound in the input nor in the given environments are of type ANY;
+the resolver reports them.
+*/
+
+// Error is a type error found without evaluating
+type Error struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+func (e Error) String() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+type Info struct {
+	Type   Type              // the type of the node inferred
+	Types  map[ast.Node]Type // the types of its expressions, blocks and programs
+	Errors []Error           // sorted by position
+}
+
+// TypeOf returns the type inferred for node
+func (info *Info) TypeOf(node ast.Node) (Type, bool) {
+	t, ok := info.Types[node]
+	return t, ok
+}
+
+// Infer infers the type of node; envs hold the bindings made before,
+// e.g. by former inputs of a session
+func Infer(node ast.Node, envs ...*object.Environment) *Info {
+	in := newInferer(envs, make(map[object.Object]Type))
+	in.record = true
+
+	t := in.infer(node)
+	for _, r := range in.scope.returns {
+		t = join(t, r)
+	}
+
+	info := &Info{Type: resolve(t), Types: make(map[ast.Node]Type), Errors: in.errors}
+	for node, t := range in.types {
+		info.Types[node] = resolve(t)
+	}
+	sort.SliceStable(info.Errors, func(i, j int) bool {
+		a, b := info.Errors[i], info.Errors[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return info
+}
+
+// scheme is a type whose variables vars are instantiated afresh at every use of the binding
+type scheme struct {
+	vars []*Var
+	t    Type
+}
+
+type scope struct {
+	outer    *scope
+	bindings map[string]*scheme
+	function bool   // the scope of a function call or of a program
+	returns  []Type // the types of the values returned to it
+}
+
+func newScope(outer *scope, function bool) *scope {
+	return &scope{outer: outer, bindings: make(map[string]*scheme), function: function}
+}
+
+type inferer struct {
+	scope   *scope
+	envs    []*object.Environment
+	objects map[object.Object]Type // the types of the objects of the environments
+	record  bool
+	types   map[ast.Node]Type
+	errors  []Error
+}
+
+func newInferer(envs []*object.Environment, objects map[object.Object]Type) *inferer {
+	return &inferer{
+		scope:   newScope(nil, true),
+		envs:    envs,
+		objects: objects,
+		types:   make(map[ast.Node]Type),
+	}
+}
+
+func (in *inferer) fresh() *Var {
+	return &Var{}
+}
+
+func (in *inferer) infer(node ast.Node) Type {
+	t := in.inferNode(node)
+	if in.record {
+		switch node.(type) {
+		case ast.Expression, *ast.BlockStatement, *ast.Program:
+			in.types[node] = t
+		}
+	}
+	return t
+}
+
+func (in *inferer) inferNode(node ast.Node) Type {
+	switch node := node.(type) {
+
+	// Statements
+	case *ast.Program:
+		return in.statements(node.Statements)
+
+	case *ast.BlockStatement:
+		return in.statements(node.Statements)
+
+	case *ast.ExpressionStatement:
+		return in.infer(node.Expression)
+
+	case *ast.ReturnStatement:
+		t := in.infer(node.ReturnValue)
+		s := in.scope
+		for !s.function {
+			s = s.outer
+		}
+		s.returns = append(s.returns, t)
+		return t
+
+	case *ast.LetStatement:
+		in.let(node)
+		return Null
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		return Integer
+
+	case *ast.StringLiteral:
+		return String
+
+	case *ast.Boolean:
+		return Boolean
+
+	case *ast.Identifier:
+		return in.lookup(node.Value)
+
+	case *ast.PrefixExpression:
+		return in.prefix(node)
+
+	case *ast.InfixExpression:
+		return in.infix(node)
+
+	case *ast.IfExpression:
+		in.infer(node.Condition) // any value is either truthy or not
+		consequence := in.infer(node.Consequence)
+		alternative := Type(Null)
+		if node.Alternative != nil {
+			alternative = in.infer(node.Alternative)
+		}
+		return join(consequence, alternative)
+
+	case *ast.FunctionLiteral:
+		return in.function(node.Parameters, node.Body)
+
+	case *ast.MacroLiteral:
+		return Macro
+
+	case *ast.CallExpression:
+		return in.call(node)
+
+	case *ast.ArrayLiteral:
+		elem := Type(in.fresh())
+		for _, e := range node.Elements {
+			elem = join(elem, in.infer(e))
+		}
+		return &Array{Elem: elem}
+
+	case *ast.HashLiteral:
+		key, value := Type(in.fresh()), Type(in.fresh())
+		for _, k := range ast.SortedKeys(node) {
+			kt := in.infer(k)
+			if !isHashable(kt) {
+				in.errorf(k, "unusable as hash key: %s", kt)
+			}
+			key = join(key, kt)
+			value = join(value, in.infer(node.Pairs[k]))
+		}
+		return &Hash{Key: key, Value: value}
+
+	case *ast.IndexExpression:
+		return in.index(node)
+
+	case *ast.SliceExpression:
+		return in.slice(node)
+
+	case *ast.TryExpression:
+		block := in.infer(node.Block)
+
+		in.scope = newScope(in.scope, false)
+		in.bind(node.Param, &scheme{t: Any}) // anything can be thrown
+		handler := in.infer(node.Handler)
+		in.scope = in.scope.outer
+
+		return join(block, handler)
+	}
+
+	return Any
+}
+
+func (in *inferer) statements(statements []ast.Statement) Type {
+	t := Type(Null)
+	for _, s := range statements {
+		t = in.infer(s)
+	}
+	return t
+}
+
+func (in *inferer) let(node *ast.LetStatement) {
+	name := node.Name.Value
+
+	var t Type
+	if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+		// the function may call itself: within its body, it has a single type
+		self := in.fresh()
+		in.scope.bindings[name] = &scheme{t: self}
+		t = in.infer(fn)
+		unify(self, t)
+		delete(in.scope.bindings, name)
+	} else {
+		t = in.infer(node.Value)
+	}
+
+	in.bind(node.Name, in.generalize(t))
+}
+
+func (in *inferer) bind(ident *ast.Identifier, s *scheme) {
+	in.scope.bindings[ident.Value] = s
+	if in.record {
+		in.types[ident] = s.t
+	}
+}
+
+func (in *inferer) function(parameters []*ast.Identifier, body *ast.BlockStatement) Type {
+	in.scope = newScope(in.scope, true)
+
+	params := make([]Type, len(parameters))
+	for i, param := range parameters {
+		params[i] = in.fresh()
+		in.bind(param, &scheme{t: params[i]})
+	}
+	result := in.infer(body)
+	for _, r := range in.scope.returns {
+		result = join(result, r)
+	}
+
+	in.scope = in.scope.outer
+	return &Function{Params: params, Result: result}
+}
+
+func (in *inferer) lookup(name string) Type {
+	for s := in.scope; s != nil; s = s.outer {
+		if scheme, ok := s.bindings[name]; ok {
+			return in.instantiate(scheme)
+		}
+	}
+	for _, env := range in.envs {
+		if obj, ok := env.Get(name); ok {
+			t := in.objectType(obj)
+			return in.instantiate(&scheme{vars: freeVars(t, nil), t: t})
+		}
+	}
+	if _, ok := evaluator.LookupBuiltin(name); ok {
+		return builtinType(name)
+	}
+	return Any
+}
+
+// objectType is the type of an object bound in an environment
+func (in *inferer) objectType(obj object.Object) Type {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return Integer
+	case *object.Boolean:
+		return Boolean
+	case *object.String:
+		return String
+	case *object.Null:
+		return Null
+	case *object.Quote:
+		return Quote
+	case *object.Macro:
+		return Macro
+	case *object.Array:
+		elem := Type(in.fresh())
+		for _, e := range obj.Elements {
+			elem = join(elem, in.objectType(e))
+		}
+		return &Array{Elem: elem}
+	case *object.Hash:
+		key, value := Type(in.fresh()), Type(in.fresh())
+		for _, pair := range obj.Pairs {
+			key = join(key, in.objectType(pair.Key))
+			value = join(value, in.objectType(pair.Value))
+		}
+		return &Hash{Key: key, Value: value}
+	case *object.Builtin:
+		for _, name := range evaluator.BuiltinNames() {
+			if builtin, _ := evaluator.LookupBuiltin(name); builtin == obj {
+				return builtinType(name)
+			}
+		}
+	case *object.Function:
+		if t, ok := in.objects[obj]; ok {
+			return in.instantiate(&scheme{vars: freeVars(t, nil), t: t})
+		}
+		self := in.fresh()
+		in.objects[obj] = self // the function may refer to itself
+
+		// errors within the function have been reported when it was defined
+		sub := newInferer([]*object.Environment{obj.Env}, in.objects)
+		t := sub.function(obj.Parameters, obj.Body)
+		unify(self, t)
+		in.objects[obj] = t
+		return in.instantiate(&scheme{vars: freeVars(t, nil), t: t})
+	}
+	return Any
+}
+
+// generalize quantifies the variables of t that are not bound by the enclosing scopes
+func (in *inferer) generalize(t Type) *scheme {
+	bound := map[*Var]bool{}
+	for s := in.scope; s != nil; s = s.outer {
+		for _, scheme := range s.bindings {
+			quantified := map[*Var]bool{}
+			for _, v := range scheme.vars {
+				quantified[v] = true
+			}
+			for _, v := range freeVars(scheme.t, nil) {
+				if !quantified[v] {
+					bound[v] = true
+				}
+			}
+		}
+	}
+
+	var vars []*Var
+	for _, v := range freeVars(t, nil) {
+		if !bound[v] {
+			vars = append(vars, v)
+		}
+	}
+	return &scheme{vars: vars, t: t}
+}
+
+func (in *inferer) instantiate(s *scheme) Type {
+	if len(s.vars) == 0 {
+		return s.t
+	}
+	fresh := make(map[*Var]Type, len(s.vars))
+	for _, v := range s.vars {
+		fresh[v] = in.fresh()
+	}
+	return substitute(s.t, fresh)
+}
+
+func substitute(t Type, m map[*Var]Type) Type {
+	switch t := prune(t).(type) {
+	case *Var:
+		if s, ok := m[t]; ok {
+			return s
+		}
+		return t
+	case *Array:
+		return &Array{Elem: substitute(t.Elem, m)}
+	case *Hash:
+		return &Hash{Key: substitute(t.Key, m), Value: substitute(t.Value, m)}
+	case *Function:
+		params := make([]Type, len(t.Params))
+		for i, p := range t.Params {
+			params[i] = substitute(p, m)
+		}
+		return &Function{Params: params, Result: substitute(t.Result, m), Exact: t.Exact}
+	default:
+		return t
+	}
+}
+
+// freeVars appends the unbound variables of t to vars, each once
+func freeVars(t Type, vars []*Var) []*Var {
+	switch t := prune(t).(type) {
+	case *Var:
+		for _, v := range vars {
+			if v == t {
+				return vars
+			}
+		}
+		return append(vars, t)
+	case *Array:
+		return freeVars(t.Elem, vars)
+	case *Hash:
+		return freeVars(t.Value, freeVars(t.Key, vars))
+	case *Function:
+		for _, p := range t.Params {
+			vars = freeVars(p, vars)
+		}
+		return freeVars(t.Result, vars)
+	}
+	return vars
+}
+
+func (in *inferer) prefix(node *ast.PrefixExpression) Type {
+	right := in.infer(node.Right)
+
+	switch node.Operator {
+	case "!":
+		return Boolean
+	case "-":
+		if !unify(right, Integer) {
+			in.errorf(node, "unknown operator: -%s", right)
+			return Any
+		}
+		return Integer
+	}
+	return Any
+}
+
+func (in *inferer) infix(node *ast.InfixExpression) Type {
+	left := in.infer(node.Left)
+	right := in.infer(node.Right)
+
+	switch node.Operator {
+	case "==", "!=": // any values can be compared
+		return Boolean
+	case "+", "-", "*", "/", "<", ">":
+	default:
+		return Any
+	}
+
+	// both operands are integers, or strings for +, < and >
+	unify(left, right)
+	operand := prune(left)
+	if operand == Any {
+		operand = prune(right)
+	}
+
+	allowed := func(t Type) bool {
+		switch prune(t) {
+		case Integer, Any:
+			return true
+		case String:
+			return node.Operator == "+" || node.Operator == "<" || node.Operator == ">"
+		}
+		_, isVar := prune(t).(*Var)
+		return isVar
+	}
+	if !allowed(left) || !allowed(right) || !unify(left, right) {
+		if left.String() != right.String() {
+			in.errorf(node, "type mismatch: %s %s %s", left, node.Operator, right)
+		} else {
+			in.errorf(node, "unknown operator: %s %s %s", left, node.Operator, right)
+		}
+		return Any
+	}
+
+	if node.Operator == "-" || node.Operator == "*" || node.Operator == "/" {
+		unify(operand, Integer)
+	}
+	if node.Operator == "<" || node.Operator == ">" {
+		return Boolean
+	}
+	return operand
+}
+
+func (in *inferer) call(node *ast.CallExpression) Type {
+	if fn, ok := node.Function.(*ast.Identifier); ok && fn.Value == "quote" {
+		return Quote
+	}
+
+	callee := in.infer(node.Function)
+	args := make([]Type, len(node.Arguments))
+	for i, arg := range node.Arguments {
+		args[i] = in.infer(arg)
+	}
+
+	if in.isBuiltin(node.Function, "push") && len(args) == 2 {
+		// arrays are not bound to a single element type: pushing joins the types
+		elem := Type(in.fresh())
+		if !unify(args[0], &Array{Elem: elem}) {
+			in.errorf(node.Arguments[0], "argument to `push` must be ARRAY, got %s", args[0])
+			return Any
+		}
+		return &Array{Elem: join(elem, args[1])}
+	}
+
+	switch f := prune(callee).(type) {
+	case *Var:
+		result := in.fresh()
+		unify(f, &Function{Params: args, Result: result})
+		return result
+
+	case *Function:
+		if f.Exact && len(args) != len(f.Params) {
+			in.errorf(node, "wrong number of arguments. got=%d, want=%d", len(args), len(f.Params))
+			return Any
+		}
+		if len(args) < len(f.Params) {
+			in.errorf(node, "wrong number of arguments: want=%d, got=%d", len(f.Params), len(args))
+			return Any
+		}
+		for i, param := range f.Params {
+			if !unify(param, args[i]) {
+				in.errorf(node.Arguments[i], "argument %d: want=%s, got=%s", i+1, param, args[i])
+			}
+		}
+		return f.Result
+	}
+
+	if callee != Any {
+		in.errorf(node, "not a function: %s", callee)
+	}
+	return Any
+}
+
+// isBuiltin tells whether e refers to the builtin of the given name
+func (in *inferer) isBuiltin(e ast.Expression, name string) bool {
+	ident, ok := e.(*ast.Identifier)
+	if !ok || ident.Value != name {
+		return false
+	}
+	for s := in.scope; s != nil; s = s.outer {
+		if _, ok := s.bindings[name]; ok {
+			return false
+		}
+	}
+	for _, env := range in.envs {
+		if _, ok := env.Get(name); ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (in *inferer) index(node *ast.IndexExpression) Type {
+	left := in.infer(node.Left)
+	index := in.infer(node.Index)
+
+	switch l := prune(left).(type) {
+	case *Array:
+		if unify(index, Integer) {
+			return l.Elem
+		}
+	case *Hash:
+		if !isHashable(index) {
+			in.errorf(node.Index, "unusable as hash key: %s", index)
+			return Any
+		}
+		unify(l.Key, index) // keys of other types are just not found
+		return l.Value
+	case *Var:
+		return Any // an array, a string or a hash
+	case Basic:
+		if l == Any {
+			return Any
+		}
+		if l == String && unify(index, Integer) {
+			return String
+		}
+	}
+
+	in.errorf(node, "index operator not supported: %s", left)
+	return Any
+}
+
+func (in *inferer) slice(node *ast.SliceExpression) Type {
+	left := in.infer(node.Left)
+	for _, bound := range []ast.Expression{node.Start, node.End} {
+		if bound == nil {
+			continue
+		}
+		if t := in.infer(bound); !unify(t, Integer) {
+			in.errorf(bound, "slice bound must be INTEGER, got %s", t)
+		}
+	}
+
+	switch l := prune(left).(type) {
+	case *Array:
+		return l
+	case *Var:
+		return Any // an array or a string
+	case Basic:
+		if l == String || l == Any {
+			return l
+		}
+	}
+
+	in.errorf(node, "slice operator not supported: %s", left)
+	return Any
+}
+
+func (in *inferer) errorf(node ast.Node, format string, a ...interface{}) {
+	if !in.record {
+		return
+	}
+	tok, _ := ast.TokenOf(node)
+	in.errors = append(in.errors, Error{
+		Message: fmt.Sprintf(format, a...),
+		Line:    tok.Line,
+		Column:  tok.Column,
+	})
+}
+
+// builtinType returns the type of a builtin with fresh variables;
+// each builtin of the evaluator needs a case here
+func builtinType(name string) Type {
+	a := &Var{}
+	switch name {
+	case "len":
+		return &Function{Params: []Type{Any}, Result: Integer, Exact: true}
+	case "puts":
+		return &Function{Params: []Type{}, Result: Null}
+	case "first", "last":
+		return &Function{Params: []Type{&Array{Elem: a}}, Result: a, Exact: true}
+	case "rest":
+		return &Function{Params: []Type{&Array{Elem: a}}, Result: &Array{Elem: a}, Exact: true}
+	case "push":
+		return &Function{Params: []Type{&Array{Elem: a}, a}, Result: &Array{Elem: a}, Exact: true}
+	case "throw", "error": // never returns
+		return &Function{Params: []Type{Any}, Result: a, Exact: true}
+	}
+	return Any
+}
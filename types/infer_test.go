@@ -0,0 +1,209 @@
+package types
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"testing"
+)
+
+func TestInfer(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "INTEGER"},
+		{`"a" + "b"`, "STRING"},
+		{`"a" < "b"`, "BOOLEAN"},
+		{"!5", "BOOLEAN"},
+		{"[1, 2] == 3", "BOOLEAN"},
+		{"let x = 1;", "NULL"},
+		{"[1, 2, 3]", "ARRAY[INTEGER]"},
+		{`[1, "a"]`, "ARRAY[ANY]"},
+		{"[]", "ARRAY[a]"},
+		{`{"a": 1, "b": 2}`, "HASH[STRING, INTEGER]"},
+		{`{"a": 1}["a"]`, "INTEGER"},
+		{`"abc"[0]`, "STRING"},
+		{"[[1]][0][1:]", "ARRAY[INTEGER]"},
+		{"if (true) { 1 } else { 2 }", "INTEGER"},
+		{"if (true) { 1 }", "ANY"},
+		{"if (true) { throw(1) } else { 2 }", "INTEGER"},
+		{`try { 1 } catch (e) { len(e) }`, "INTEGER"},
+		{"fn(x) { x }", "FUNCTION(a) -> a"},
+		{"fn(x, y) { x + y }", "FUNCTION(a, a) -> a"},
+		{"fn(x, y) { x < y }", "FUNCTION(a, a) -> BOOLEAN"},
+		{"fn(x) { -x }", "FUNCTION(INTEGER) -> INTEGER"},
+		{"fn(f) { f(1) + 1 }", "FUNCTION(FUNCTION(INTEGER) -> INTEGER) -> INTEGER"},
+		{"fn(x) { if (x) { return 1; } 2 }", "FUNCTION(a) -> INTEGER"},
+		{"let id = fn(x) { x }; [id(1), id(true)]", "ARRAY[ANY]"},
+		{"let id = fn(x) { x }; id(1) + id(2)", "INTEGER"},
+		{
+			"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact",
+			"FUNCTION(INTEGER) -> INTEGER",
+		},
+		{
+			`let map = fn(arr, f) {
+				let iter = fn(arr, acc) {
+					if (len(arr) == 0) { acc } else { iter(rest(arr), push(acc, f(first(arr)))) }
+				};
+				iter(arr, [])
+			};
+			map`,
+			"FUNCTION(ARRAY[a], FUNCTION(a) -> b) -> ARRAY[b]",
+		},
+		{`push([1], "a")`, "ARRAY[ANY]"},
+		{"first", "FUNCTION(ARRAY[a]) -> a"},
+		{"let f = fn(x) { x }; f(1, 2)", "INTEGER"},
+		{"quote(1 + 2)", "QUOTE"},
+		{"unknown + 1", "INTEGER"},
+	}
+
+	for _, tt := range tests {
+		info := Infer(parse(t, tt.input))
+		if len(info.Errors) != 0 {
+			t.Errorf("unexpected errors for %q: %v", tt.input, info.Errors)
+		}
+		if info.Type.String() != tt.expected {
+			t.Errorf("wrong type of %q. want=%s, got=%s", tt.input, tt.expected, info.Type)
+		}
+	}
+}
+
+func TestInferErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`1 + "a"`, []string{"1:3: type mismatch: INTEGER + STRING"}},
+		{`"a" - "b"`, []string{"1:5: unknown operator: STRING - STRING"}},
+		{"true + false", []string{"1:6: unknown operator: BOOLEAN + BOOLEAN"}},
+		{`-"a"`, []string{"1:1: unknown operator: -STRING"}},
+		{"fn(x) { x * 2 }(true)", []string{"1:17: argument 1: want=INTEGER, got=BOOLEAN"}},
+		{"fn(x, y) { x }(1)", []string{"1:15: wrong number of arguments: want=2, got=1"}},
+		{`len("a", "b")`, []string{"1:4: wrong number of arguments. got=2, want=1"}},
+		{"1(2)", []string{"1:2: not a function: INTEGER"}},
+		{"first(1)", []string{"1:7: argument 1: want=ARRAY[a], got=INTEGER"}},
+		{"5[0]", []string{"1:2: index operator not supported: INTEGER"}},
+		{`[1]["a"]`, []string{"1:4: index operator not supported: ARRAY[INTEGER]"}},
+		{`{"a": 1}[fn() { 1 }]`, []string{"1:10: unusable as hash key: FUNCTION() -> INTEGER"}},
+		{`{[1]: 1, {}: 2}`, []string{"1:10: unusable as hash key: HASH[a, b]"}},
+		{"1[1:]", []string{"1:2: slice operator not supported: INTEGER"}},
+		{`"abc"["a":]`, []string{`1:7: slice bound must be INTEGER, got STRING`}},
+		{
+			// errors are reported where the evaluator would fail, whatever the values are
+			`let f = fn(x) { if (x) { x + 1 } else { x + "a" } }`,
+			[]string{"1:43: type mismatch: INTEGER + STRING"},
+		},
+		{
+			"let x = 1 + true; x - false",
+			[]string{
+				"1:11: type mismatch: INTEGER + BOOLEAN",
+				"1:21: type mismatch: ANY - BOOLEAN",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		info := Infer(parse(t, tt.input))
+
+		got := []string{}
+		for _, err := range info.Errors {
+			got = append(got, err.String())
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("wrong errors for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestInferTypesOfNodes(t *testing.T) {
+	program := parse(t, "let f = fn(x) { x + 1 }; f(2)")
+	info := Infer(program)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{let.Name, "FUNCTION(INTEGER) -> INTEGER"},
+		{fn.Parameters[0], "INTEGER"},
+		{fn.Body, "INTEGER"},
+		{call, "INTEGER"},
+		{program, "INTEGER"},
+	}
+
+	for _, tt := range tests {
+		typ, ok := info.TypeOf(tt.node)
+		if !ok {
+			t.Errorf("no type for %s", tt.node)
+			continue
+		}
+		if typ.String() != tt.expected {
+			t.Errorf("wrong type of %s. want=%s, got=%s", tt.node, tt.expected, typ)
+		}
+	}
+
+	if _, ok := info.TypeOf(let); ok {
+		t.Errorf("let statements have no type")
+	}
+}
+
+func TestInferEnvironments(t *testing.T) {
+	env := object.NewEnvironment()
+	evaluator.Eval(parse(t, `
+		let n = 1;
+		let names = ["a", "b"];
+		let twice = fn(f, x) { f(f(x)) };
+		let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } };
+		let p = push;
+	`), env)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"n", "INTEGER"},
+		{"names", "ARRAY[STRING]"},
+		{"twice", "FUNCTION(FUNCTION(a) -> a, a) -> a"},
+		{"twice(fn(x) { x + 1 }, 1)", "INTEGER"},
+		{"count", "FUNCTION(INTEGER) -> INTEGER"},
+		{"p", "FUNCTION(ARRAY[a], a) -> ARRAY[a]"},
+	}
+
+	for _, tt := range tests {
+		info := Infer(parse(t, tt.input), env)
+		if info.Type.String() != tt.expected {
+			t.Errorf("wrong type of %q. want=%s, got=%s", tt.input, tt.expected, info.Type)
+		}
+	}
+
+	info := Infer(parse(t, `n + "a"`), env)
+	if len(info.Errors) != 1 || info.Errors[0].Message != "type mismatch: INTEGER + STRING" {
+		t.Errorf("wrong errors. got=%v", info.Errors)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestBuiltinTypes(t *testing.T) {
+	for _, name := range evaluator.BuiltinNames() {
+		if builtinType(name) == Any {
+			t.Errorf("builtin %s has no type", name)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Types are named like the object types they describe: INTEGER, ARRAY[STRING], ...
+
+Monkey does not demand that the elements of an array or the branches of an if expression
+have the same type. Where types need not agree and do not, the inferencer falls back to ANY,
+the type of values nothing is known about; ANY is compatible with every type.
+*/
+
+type Type interface {
+	String() string
+}
+
+type Basic string
+
+const (
+	Integer Basic = "INTEGER"
+	Boolean Basic = "BOOLEAN"
+	String  Basic = "STRING"
+	Null    Basic = "NULL"
+	Quote   Basic = "QUOTE"
+	Macro   Basic = "MACRO"
+	Any     Basic = "ANY"
+)
+
+func (b Basic) String() string { return string(b) }
+
+type Array struct {
+	Elem Type
+}
+
+func (a *Array) String() string { return format(a, map[*Var]string{}) }
+
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+func (h *Hash) String() string { return format(h, map[*Var]string{}) }
+
+type Function struct {
+	Params []Type
+	Result Type
+	Exact  bool // builtins do not accept more arguments than parameters
+}
+
+func (f *Function) String() string { return format(f, map[*Var]string{}) }
+
+// Var is a type variable; it stands for its instance as soon as it has got one
+type Var struct {
+	id       int
+	instance Type
+}
+
+func (v *Var) String() string { return format(v, map[*Var]string{}) }
+
+// format names the unbound variables of t a, b, c, ... in the order they appear
+func format(t Type, names map[*Var]string) string {
+	switch t := prune(t).(type) {
+	case *Var:
+		name, ok := names[t]
+		if !ok {
+			name = varName(len(names))
+			names[t] = name
+		}
+		return name
+	case *Array:
+		return "ARRAY[" + format(t.Elem, names) + "]"
+	case *Hash:
+		return "HASH[" + format(t.Key, names) + ", " + format(t.Value, names) + "]"
+	case *Function:
+		params := make([]string, len(t.Params))
+		for i, p := range t.Params {
+			params[i] = format(p, names)
+		}
+		return "FUNCTION(" + strings.Join(params, ", ") + ") -> " + format(t.Result, names)
+	default:
+		return t.String()
+	}
+}
+
+func varName(n int) string {
+	name := string(rune('a' + n%26))
+	if n >= 26 {
+		name += fmt.Sprint(n / 26)
+	}
+	return name
+}
+
+// prune returns the type a chain of bound variables stands for
+func prune(t Type) Type {
+	if v, ok := t.(*Var); ok && v.instance != nil {
+		v.instance = prune(v.instance)
+		return v.instance
+	}
+	return t
+}
+
+// resolve replaces all bound variables within t by their instances
+func resolve(t Type) Type {
+	switch t := prune(t).(type) {
+	case *Array:
+		return &Array{Elem: resolve(t.Elem)}
+	case *Hash:
+		return &Hash{Key: resolve(t.Key), Value: resolve(t.Value)}
+	case *Function:
+		params := make([]Type, len(t.Params))
+		for i, p := range t.Params {
+			params[i] = resolve(p)
+		}
+		return &Function{Params: params, Result: resolve(t.Result), Exact: t.Exact}
+	default:
+		return t
+	}
+}
+
+func occurs(v *Var, t Type) bool {
+	switch t := prune(t).(type) {
+	case *Var:
+		return t == v
+	case *Array:
+		return occurs(v, t.Elem)
+	case *Hash:
+		return occurs(v, t.Key) || occurs(v, t.Value)
+	case *Function:
+		for _, p := range t.Params {
+			if occurs(v, p) {
+				return true
+			}
+		}
+		return occurs(v, t.Result)
+	}
+	return false
+}
+
+// unifier binds variables such that types become equal;
+// the bindings of a failed unification are undone
+type unifier struct {
+	trail []*Var
+}
+
+func unify(a, b Type) bool {
+	u := &unifier{}
+	if u.unify(a, b) {
+		return true
+	}
+	for _, v := range u.trail {
+		v.instance = nil
+	}
+	return false
+}
+
+func (u *unifier) unify(a, b Type) bool {
+	a, b = prune(a), prune(b)
+
+	if a == Any || b == Any {
+		return true
+	}
+	if v, ok := a.(*Var); ok {
+		return u.bind(v, b)
+	}
+	if v, ok := b.(*Var); ok {
+		return u.bind(v, a)
+	}
+
+	switch a := a.(type) {
+	case Basic:
+		return a == b
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && u.unify(a.Elem, b.Elem)
+	case *Hash:
+		b, ok := b.(*Hash)
+		return ok && u.unify(a.Key, b.Key) && u.unify(a.Value, b.Value)
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok {
+			return false
+		}
+		// surplus arguments are ignored by functions, hence only the common parameters need to agree
+		for i := 0; i < len(a.Params) && i < len(b.Params); i++ {
+			if !u.unify(a.Params[i], b.Params[i]) {
+				return false
+			}
+		}
+		return u.unify(a.Result, b.Result)
+	}
+	return false
+}
+
+func (u *unifier) bind(v *Var, t Type) bool {
+	if v == t {
+		return true
+	}
+	if occurs(v, t) {
+		return false
+	}
+	v.instance = t
+	u.trail = append(u.trail, v)
+	return true
+}
+
+// join is the type of values that are either of type a or of type b
+func join(a, b Type) Type {
+	if unify(a, b) {
+		return a
+	}
+	return Any
+}
+
+// isHashable tells whether values of type t can be used as hash keys
+func isHashable(t Type) bool {
+	switch t := prune(t).(type) {
+	case Basic:
+		return t == Integer || t == Boolean || t == String || t == Any
+	case *Array:
+		return isHashable(t.Elem)
+	case *Var:
+		return true
+	}
+	return false
+}
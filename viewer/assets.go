@@ -0,0 +1,313 @@
+package viewer
+
+// the page presents the trace of data.json; the trees are drawn by the visualizer
+
+const indexHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Monkey trace viewer</title>
+<link rel="stylesheet" href="viewer.css">
+</head>
+<body>
+<header>
+  <h1>Monkey trace viewer</h1>
+  <pre id="input"></pre>
+</header>
+<nav>
+  <button data-tab="trace" class="active">Trace</button>
+  <button data-tab="ptree">Parsetree</button>
+  <button data-tab="etree">Evaltree</button>
+</nav>
+<section id="trace" class="tab active">
+  <div class="controls">
+    <button id="first" title="first step (Home)">|&lt;</button>
+    <button id="prev" title="previous step (&larr;)">&lt;</button>
+    <input id="scrub" type="range" min="0" max="0" value="0">
+    <button id="next" title="next step (&rarr;)">&gt;</button>
+    <button id="last" title="last step (End)">&gt;|</button>
+    <span id="stepinfo"></span>
+  </div>
+  <div class="panes">
+    <div class="pane">
+      <h2>Ast <small>click a node to highlight its steps</small></h2>
+      <ul id="ast" class="tree"></ul>
+    </div>
+    <div class="pane steps">
+      <h2>Steps</h2>
+      <table>
+        <thead><tr><th>no</th><th>step</th><th>node</th><th>env</th><th>value</th></tr></thead>
+        <tbody id="steps"></tbody>
+      </table>
+    </div>
+    <div class="pane">
+      <h2>Environments</h2>
+      <div id="env"></div>
+    </div>
+  </div>
+</section>
+<section id="ptree" class="tab"><img alt="parsetree"></section>
+<section id="etree" class="tab"><img alt="evaltree"></section>
+<script src="viewer.js"></script>
+</body>
+</html>
+`
+
+const viewerCSS = `body { font-family: sans-serif; margin: 0; }
+header { background: steelblue; color: white; padding: 0.5em 1em; }
+header h1 { font-size: 1.2em; margin: 0; }
+header pre { margin: 0.5em 0 0; white-space: pre-wrap; }
+nav { padding: 0.5em 1em; border-bottom: 1px solid #ccc; }
+nav button.active { font-weight: bold; }
+.tab { display: none; padding: 0.5em 1em; }
+.tab.active { display: block; }
+.tab img { max-width: none; }
+#ptree, #etree { overflow: auto; }
+.controls { margin-bottom: 0.5em; }
+#scrub { width: 40%; vertical-align: middle; }
+.panes { display: flex; gap: 1em; align-items: flex-start; }
+.pane { flex: 1; max-height: 75vh; overflow: auto; border: 1px solid #ccc; padding: 0 0.5em; }
+.pane.steps { flex: 2; }
+h2 { font-size: 1em; }
+h2 small { font-weight: normal; color: gray; }
+.tree, .tree ul { list-style: none; padding-left: 1.2em; margin: 0; font-family: monospace; }
+.tree .node { cursor: pointer; border-radius: 3px; padding: 0 2px; }
+.tree .field { color: gray; }
+.tree .leaf { color: darkgreen; }
+.tree .ref { color: gray; font-style: italic; }
+.tree .current { background: gold; }
+.tree .selected { outline: 2px solid red; }
+table { border-collapse: collapse; font-family: monospace; width: 100%; }
+th, td { text-align: left; padding: 1px 6px; white-space: nowrap; }
+tbody tr { cursor: pointer; }
+tr.call td:nth-child(2) { color: firebrick; }
+tr.exit td:nth-child(2) { color: darkgreen; }
+tr.hit { background: #fde0dc; }
+tr.current { background: gold; }
+.env { margin-bottom: 0.8em; font-family: monospace; }
+.env h3 { font-size: 1em; margin: 0.3em 0; }
+.env td { border: 1px solid #ddd; }
+`
+
+const viewerJS = `"use strict";
+(function () {
+  var steps = [], envs = [], current = 0, selected = null;
+
+  function $(id) { return document.getElementById(id); }
+
+  function el(tag, cls, text) {
+    var e = document.createElement(tag);
+    if (cls) { e.className = cls; }
+    if (text !== undefined) { e.textContent = text; }
+    return e;
+  }
+
+  // show returns a short representation of an object of the trace
+  function show(obj) {
+    if (!obj) { return ""; }
+    switch (obj.type) {
+    case "STRING": return JSON.stringify(obj.value);
+    case "NULL": return "null";
+    case "ERROR": return "ERROR: " + obj.message;
+    case "ARRAY": return "[" + obj.elements.map(show).join(", ") + "]";
+    case "HASH": return "{" + obj.pairs.map(function (p) { return show(p.key) + ": " + show(p.value); }).join(", ") + "}";
+    case "FUNCTION": return "fn(" + obj.parameters.join(", ") + ")" + (obj.name ? " " + obj.name : "");
+    case "MACRO": return "macro(" + obj.parameters.join(", ") + ")";
+    case "RETURN_VALUE": return show(obj.value);
+    default: return obj.value !== undefined ? String(obj.value) : obj.type;
+    }
+  }
+
+  var labels = {};
+
+  function label(node) {
+    var l = node.type;
+    if (node.token) { l += " " + node.token.literal + " (" + node.token.line + ":" + node.token.column + ")"; }
+    return l;
+  }
+
+  // the ast as nested list
+
+  function addNode(node, list, name) {
+    var li = el("li");
+    if (name) { li.appendChild(el("span", "field", name + ": ")); }
+    if (node.ref !== undefined) {
+      li.appendChild(el("span", "ref", "see " + labels[node.ref]));
+      list.appendChild(li);
+      return;
+    }
+    labels[node.id] = label(node);
+    var span = el("span", "node", labels[node.id]);
+    span.id = "node" + node.id;
+    span.onclick = function () { select(node.id); };
+    li.appendChild(span);
+
+    var children = el("ul");
+    Object.keys(node.fields || {}).forEach(function (field) {
+      addValue(node.fields[field], children, field);
+    });
+    li.appendChild(children);
+    list.appendChild(li);
+  }
+
+  function addValue(value, list, name) {
+    if (Array.isArray(value)) {
+      if (value.length === 0) { addLeaf("[]", list, name); }
+      value.forEach(function (v, i) { addValue(v, list, name + "[" + i + "]"); });
+    } else if (value === null) {
+      addLeaf("nil", list, name);
+    } else if (typeof value !== "object") {
+      addLeaf(String(value), list, name);
+    } else if (value.id !== undefined || value.ref !== undefined) {
+      addNode(value, list, name);
+    } else if (value.key !== undefined) { // a pair of a hash literal
+      addValue(value.key, list, name + ".key");
+      addValue(value.value, list, name + ".value");
+    } else if (value.literal !== undefined) { // a token
+      addLeaf(value.literal, list, name);
+    }
+  }
+
+  function addLeaf(text, list, name) {
+    var li = el("li");
+    li.appendChild(el("span", "field", name + ": "));
+    li.appendChild(el("span", "leaf", text));
+    list.appendChild(li);
+  }
+
+  // the steps
+
+  function addSteps() {
+    var body = $("steps");
+    steps.forEach(function (step, i) {
+      var row = el("tr", step.kind);
+      var arrow = step.kind === "call" ? "↓" : "↑";
+      var kind = el("td", "", arrow + " " + step.kind + (step.tail ? " (tail)" : ""));
+      kind.style.paddingLeft = (6 + 10 * step.depth) + "px";
+      row.appendChild(el("td", "", String(step.no)));
+      row.appendChild(kind);
+      row.appendChild(el("td", "", labels[step.node] || "#" + step.node));
+      row.appendChild(el("td", "", "e" + step.env));
+      row.appendChild(el("td", "", step.kind === "exit" ? show(step.value) : ""));
+      row.onclick = function () { go(i); };
+      body.appendChild(row);
+    });
+  }
+
+  // bindings returns the bindings of env at step i: those of the last step
+  // in env up to i, or those after the evaluation
+  function bindings(env, i) {
+    for (var j = i; j >= 0; j--) {
+      if (steps[j].env === env) { return steps[j].bindings; }
+    }
+    return envs[env].bindings;
+  }
+
+  function showEnvs(i) {
+    var pane = $("env");
+    pane.textContent = "";
+    for (var env = steps[i].env; env !== null && env !== undefined; env = envs[env].outer) {
+      var div = el("div", "env");
+      div.appendChild(el("h3", "", "e" + env + (env === steps[i].env ? "" : " (outer)")));
+      var table = el("table");
+      var b = bindings(env, i);
+      Object.keys(b).sort().forEach(function (name) {
+        var row = el("tr");
+        row.appendChild(el("td", "", name));
+        row.appendChild(el("td", "", b[name] ? b[name].type : ""));
+        row.appendChild(el("td", "", show(b[name])));
+        table.appendChild(row);
+      });
+      if (table.childNodes.length === 0) { div.appendChild(el("div", "", "no bindings")); }
+      div.appendChild(table);
+      pane.appendChild(div);
+    }
+  }
+
+  function go(i) {
+    if (steps.length === 0) { return; }
+    i = Math.max(0, Math.min(steps.length - 1, i));
+    var rows = $("steps").childNodes;
+    rows[current].classList.remove("current");
+    var old = $("node" + steps[current].node);
+    if (old) { old.classList.remove("current"); }
+
+    current = i;
+    rows[i].classList.add("current");
+    rows[i].scrollIntoView({block: "nearest"});
+    var node = $("node" + steps[i].node);
+    if (node) {
+      node.classList.add("current");
+      node.scrollIntoView({block: "nearest"});
+    }
+    $("scrub").value = i;
+    $("stepinfo").textContent = "step " + steps[i].no + " of " + (steps.length - 1);
+    showEnvs(i);
+  }
+
+  // select highlights the steps of a node and goes to its first call
+  function select(id) {
+    if (selected !== null) { $("node" + selected).classList.remove("selected"); }
+    selected = id;
+    $("node" + id).classList.add("selected");
+    var first = -1;
+    var rows = $("steps").childNodes;
+    steps.forEach(function (step, i) {
+      rows[i].classList.toggle("hit", step.node === id);
+      if (step.node === id && first < 0) { first = i; }
+    });
+    if (first >= 0) { go(first); }
+  }
+
+  function tabs() {
+    var buttons = document.querySelectorAll("nav button");
+    Array.prototype.forEach.call(buttons, function (button) {
+      button.onclick = function () {
+        Array.prototype.forEach.call(buttons, function (b) {
+          b.classList.toggle("active", b === button);
+          $(b.getAttribute("data-tab")).classList.toggle("active", b === button);
+        });
+      };
+    });
+    var now = Date.now();
+    document.querySelector("#ptree img").src = "ptree.svg?" + now;
+    document.querySelector("#etree img").src = "etree.svg?" + now;
+  }
+
+  function controls() {
+    $("first").onclick = function () { go(0); };
+    $("prev").onclick = function () { go(current - 1); };
+    $("next").onclick = function () { go(current + 1); };
+    $("last").onclick = function () { go(steps.length - 1); };
+    $("scrub").oninput = function () { go(parseInt(this.value, 10)); };
+    document.onkeydown = function (e) {
+      switch (e.key) {
+      case "ArrowLeft": go(current - 1); break;
+      case "ArrowRight": go(current + 1); break;
+      case "Home": go(0); break;
+      case "End": go(steps.length - 1); break;
+      default: return;
+      }
+      e.preventDefault();
+    };
+  }
+
+  tabs();
+  controls();
+  fetch("data.json").then(function (response) {
+    if (!response.ok) { throw new Error("nothing to show yet: use :serve <input>"); }
+    return response.json();
+  }).then(function (data) {
+    $("input").textContent = data.input;
+    steps = data.trace.steps;
+    envs = data.trace.environments;
+    addNode(data.trace.ast, $("ast"), "");
+    (data.trace.nodes || []).forEach(function (node) { addNode(node, $("ast"), "evaluated"); });
+    addSteps();
+    $("scrub").max = Math.max(0, steps.length - 1);
+    go(0);
+  }).catch(function (err) {
+    $("input").textContent = err.message;
+  });
+})();
+`
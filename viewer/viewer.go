@@ -0,0 +1,106 @@
+// Package viewer serves a web page on which the evaluation of an input can be
+// stepped through forward and backward. The page and its scripts are part of the
+// binary, so that no network access is needed.
+package viewer
+
+import (
+	"encoding/json"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/visualizer"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Server presents the input it has been shown last
+type Server struct {
+	mu    sync.Mutex
+	input string
+	trace json.RawMessage // see visualizer.JsonEvalTrace
+	ptree string          // svg
+	etree string          // svg
+
+	listener net.Listener
+	server   *http.Server
+}
+
+// Start serves the page at addr, e.g. "127.0.0.1:0" for a free port, until Stop is called
+func Start(addr string) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{listener: listener}
+	s.server = &http.Server{Handler: s}
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// URL is the address of the page
+func (s *Server) URL() string {
+	return "http://" + s.listener.Addr().String() + "/"
+}
+
+func (s *Server) Stop() error {
+	return s.server.Close()
+}
+
+// Show replaces the input presented by the page; the trace must be the trace of node
+func (s *Server) Show(input string, node ast.Node, trace *evaluator.Trace, verbosity int) error {
+	str, err := visualizer.JsonEvalTrace(trace)
+	if err != nil {
+		return err
+	}
+	ptree := visualizer.SvgParseTreeString(input, node, verbosity, false)
+	etree := visualizer.SvgEvalTreeString(input, trace, verbosity, false, false, true)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.input = input
+	s.trace = json.RawMessage(str)
+	s.ptree = ptree
+	s.etree = etree
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Cache-Control", "no-store") // the input may have changed
+	switch r.URL.Path {
+	case "/", "/index.html":
+		serve(w, "text/html; charset=utf-8", indexHTML)
+	case "/viewer.css":
+		serve(w, "text/css; charset=utf-8", viewerCSS)
+	case "/viewer.js":
+		serve(w, "application/javascript; charset=utf-8", viewerJS)
+	case "/ptree.svg":
+		serve(w, "image/svg+xml", s.ptree)
+	case "/etree.svg":
+		serve(w, "image/svg+xml", s.etree)
+	case "/data.json":
+		if s.trace == nil {
+			http.Error(w, "nothing to show yet", http.StatusNotFound)
+			return
+		}
+		data, err := json.Marshal(struct {
+			Input string          `json:"input"`
+			Trace json.RawMessage `json:"trace"`
+		}{s.input, s.trace})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func serve(w http.ResponseWriter, contentType string, content string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(content))
+}
@@ -0,0 +1,70 @@
+package viewer
+
+import (
+	"encoding/json"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func get(s *Server, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	return rec
+}
+
+func TestServer(t *testing.T) {
+	s := &Server{}
+
+	if rec := get(s, "/data.json"); rec.Code != http.StatusNotFound {
+		t.Errorf("data.json before Show: got status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	for _, path := range []string{"/", "/viewer.css", "/viewer.js"} {
+		if rec := get(s, path); rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+			t.Errorf("%s: got status %d and %d bytes", path, rec.Code, rec.Body.Len())
+		}
+	}
+	if rec := get(s, "/unknown"); rec.Code != http.StatusNotFound {
+		t.Errorf("/unknown: got status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	input := "let f = fn(x) { x }; f(1)"
+	node := parser.New(lexer.New(input)).ParseProgram()
+	_, trace := evaluator.EvalT(node, object.NewEnvironment(), true)
+	if err := s.Show(input, node, trace, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := get(s, "/data.json")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("data.json: got status %d", rec.Code)
+	}
+	var data struct {
+		Input string
+		Trace struct {
+			Steps []interface{}
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Input != input {
+		t.Errorf("input: got %q, want %q", data.Input, input)
+	}
+	if len(data.Trace.Steps) != trace.Steps() {
+		t.Errorf("steps: got %d, want %d", len(data.Trace.Steps), trace.Steps())
+	}
+
+	for _, path := range []string{"/ptree.svg", "/etree.svg"} {
+		rec := get(s, path)
+		if !strings.HasPrefix(rec.Header().Get("Content-Type"), "image/svg+xml") || !strings.Contains(rec.Body.String(), "<svg") {
+			t.Errorf("%s: got no svg", path)
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package visualizer
 
 import (
-	"encoding/json"
 	"fmt"
 	"monkey/ast"
 	"monkey/object"
+	"regexp"
 	"runtime"
 	"strings"
+	"unicode/utf8"
 )
 
 var (
@@ -17,6 +18,7 @@ var (
 	Blue   = "\033[34m"
 	Cyan   = "\033[36m"
 	White  = "\033[97m"
+	BgRed  = "\033[41m"
 	// Purple = "\033[35m"
 	// Gray = "\033[37m"
 )
@@ -30,6 +32,7 @@ func init() {
 		Blue = ""
 		Cyan = ""
 		White = ""
+		BgRed = ""
 		//	Purple = ""
 		//	Gray = ""
 	}
@@ -48,7 +51,9 @@ func consNode(node ast.Node, verbosity verbosity) string {
 }
 
 func consColorNodeStr(nodeType string, node ast.Node) string {
-	if _, ok := node.(ast.Expression); ok {
+	if isBadNode(node) { // placeholders for input the parser could not make sense of
+		return consColorize(nodeType, BgRed+White)
+	} else if _, ok := node.(ast.Expression); ok {
 		return consColorize(nodeType, Cyan)
 	} else if _, ok := node.(ast.Statement); ok {
 		return consColorize(nodeType, Yellow)
@@ -59,6 +64,14 @@ func consColorNodeStr(nodeType string, node ast.Node) string {
 	}
 }
 
+func isBadNode(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.BadStatement, *ast.BadExpression:
+		return true
+	}
+	return false
+}
+
 func VisObjectType(obj object.Object, verbosity int, goObjType bool) string {
 
 	return visObjectType(obj, getVerbosity(verbosity), goObjType)
@@ -115,6 +128,8 @@ func abbreviateGoObjectType(objtype string) string { // was abbreviateObjectType
 		return "Err"
 	case "ReturnValue":
 		return "RetV"
+	case "TailCall":
+		return "TlCl"
 	default:
 		if len(objtype) > 4 {
 			return objtype[0:4]
@@ -151,6 +166,12 @@ func abbreviateNodeType(nodetype string) string {
 		return "IntL"
 	case "FunctionLiteral":
 		return "FctL"
+	case "SliceExpression":
+		return "SlcE"
+	case "TryExpression":
+		return "TryE"
+	case "MacroLiteral":
+		return "MacL"
 	default:
 		if len(nodetype) > 4 {
 			return nodetype[0:4]
@@ -201,11 +222,39 @@ func abbreviateFieldName(fieldname string) string {
 	}
 }
 
-// is not in use
-func RepresentAsJson(i interface{}, indent string) string {
-	json, err := json.MarshalIndent(i, "", indent)
-	if err == nil {
-		return string(json)
+var colorCode = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// SideBySide puts the lines of right next to the lines of left, separated by gap spaces;
+// color codes do not take up room
+func SideBySide(left, right string, gap int) string {
+	leftLines := strings.Split(left, "\n")
+	rightLines := strings.Split(right, "\n")
+
+	width := 0
+	for _, line := range leftLines {
+		if w := visibleWidth(line); w > width {
+			width = w
+		}
 	}
-	return ""
+
+	var out strings.Builder
+	for i := 0; i < len(leftLines) || i < len(rightLines); i++ {
+		l, r := "", ""
+		if i < len(leftLines) {
+			l = leftLines[i]
+		}
+		if i < len(rightLines) {
+			r = rightLines[i]
+		}
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		line := l + strings.Repeat(" ", width-visibleWidth(l)+gap) + r
+		out.WriteString(strings.TrimRight(line, " "))
+	}
+	return out.String()
+}
+
+func visibleWidth(line string) int {
+	return utf8.RuneCountInString(colorCode.ReplaceAllString(line, ""))
 }
@@ -0,0 +1,274 @@
+package visualizer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"strings"
+)
+
+// ConsDebugger steps through an evaluation while it runs, see evaluator.EvalD.
+// Unlike TraceInteractive, it cannot go back, but it needs no recorded trace,
+// so that it also reaches evaluations that do not terminate.
+type ConsDebugger struct {
+	debugOptions
+	scanner     *bufio.Scanner
+	envs        map[*object.Environment]int // numbered in the order of their appearance
+	lastEnv     *object.Environment
+	lastVersion int // of lastEnv, see object.Environment.Version
+	stop        func(node ast.Node, depth int, exit bool) bool
+	aborted     bool
+}
+
+func NewConsDebugger(out io.Writer, scanner *bufio.Scanner, verbosity int, goObjType bool) *ConsDebugger {
+	return &ConsDebugger{
+		debugOptions: debugOptions{out: out, verbosity: getVerbosity(verbosity), goObjType: goObjType},
+		scanner:      scanner,
+		envs:         make(map[*object.Environment]int),
+		stop:         everyStep,
+	}
+}
+
+func everyStep(node ast.Node, depth int, exit bool) bool {
+	return true
+}
+
+const consDebuggerHelp = "\tOptions: a: abort, [c]: continue, e: display environment,\n" +
+	"\t         n: next at the same depth, o: step out,\n" +
+	"\t         r: run to the next breakpoint or the end, bp <identifier|node type>: set or remove breakpoint,\n" +
+	"\t         w <expression>: add or remove watch, p <identifier>: print binding\n"
+
+func (d *ConsDebugger) Call(node ast.Node, env *object.Environment, depth int) {
+	d.pause(node, env, depth, nil, false)
+}
+
+func (d *ConsDebugger) Exit(node ast.Node, env *object.Environment, depth int, val object.Object) {
+	d.pause(node, env, depth, val, true)
+}
+
+// pause waits for replies until the evaluation is to be continued
+func (d *ConsDebugger) pause(node ast.Node, env *object.Environment, depth int, val object.Object, exit bool) {
+	envNo, ok := d.envs[env]
+	if !ok {
+		envNo = len(d.envs)
+		d.envs[env] = envNo
+	}
+	envChanged := d.lastEnv != nil && (d.lastEnv != env || d.lastVersion != env.Version())
+	d.lastEnv, d.lastVersion = env, env.Version()
+
+	if d.aborted || !d.stop(node, depth, exit) {
+		return
+	}
+
+	for {
+		if exit {
+			d.printExit(depth, envNo, envChanged, node, val)
+		} else {
+			d.printCall("call", depth, envNo, envChanged, node)
+		}
+		d.printWatches(env, evalLiveWatch)
+		fmt.Fprint(d.out, " ? ")
+
+		if !d.scanner.Scan() {
+			d.abort()
+			return
+		}
+		cmd, arg := splitReply(d.scanner.Text())
+		switch cmd {
+		case "a":
+			d.abort()
+			return
+		case "h":
+			fmt.Fprint(d.out, consDebuggerHelp)
+		case "c", "":
+			d.stop = everyStep
+			return
+		case "e":
+			fmt.Fprint(d.out, consEnvTables(env, "   ", d.verbosity, d.goObjType))
+			d.stop = everyStep
+			return
+		case "n":
+			d.stop = func(_ ast.Node, next int, _ bool) bool { return next <= depth }
+			return
+		case "o":
+			d.stop = func(_ ast.Node, next int, _ bool) bool { return next < depth }
+			return
+		case "r":
+			d.stop = func(node ast.Node, _ int, exit bool) bool { return !exit && d.breaksAt(node) }
+			return
+		case "bp":
+			d.toggleBreakpoint(arg)
+		case "w":
+			d.toggleWatch(arg)
+		case "p":
+			d.printBinding(env, envNo, arg)
+		default:
+			fmt.Fprint(d.out, "\tUnknown option (h for help)\n")
+		}
+	}
+}
+
+func (d *ConsDebugger) abort() {
+	d.aborted = true
+	evaluator.Interrupt()
+}
+
+// watchSteps bounds the evaluation of a watch expression
+const watchSteps = 100000
+
+// evalLiveWatch evaluates a watch expression while the evaluation is suspended;
+// evaluator.EvalT would reset the state of the suspended evaluation
+func evalLiveWatch(node ast.Expression, env *object.Environment) object.Object {
+	return evaluator.EvalLimited(node, object.NewEnclosedEnvironment(env), evaluator.Limits{MaxSteps: watchSteps})
+}
+
+// splitReply splits a reply into the option and its argument
+func splitReply(reply string) (string, string) {
+	parts := strings.SplitN(strings.TrimSpace(reply), " ", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], strings.TrimSpace(parts[1])
+}
+
+// debugOptions are shared by the debuggers of recorded and of running evaluations
+type debugOptions struct {
+	out         io.Writer
+	verbosity   verbosity
+	goObjType   bool
+	breakpoints []string
+	watches     []string
+}
+
+func (o *debugOptions) printCall(label string, depth int, envNo int, envChanged bool, node ast.Node) {
+	fmt.Fprint(o.out, consColorize(fmt.Sprintf("%v %v", label, depth), Red))
+	o.printEnvNo(envNo, envChanged)
+	fmt.Fprintf(o.out, "%v %v", consNode(node, o.verbosity), node)
+}
+
+func (o *debugOptions) printExit(depth int, envNo int, envChanged bool, node ast.Node, val object.Object) {
+	fmt.Fprint(o.out, consColorize(fmt.Sprintf("exit %v", depth), Green))
+	o.printEnvNo(envNo, envChanged)
+	fmt.Fprintf(o.out, "%v %v", consNode(node, o.verbosity), node)
+	fmt.Fprintf(o.out, " -> %v %v ", visObjectType(val, o.verbosity, o.goObjType), consValue(val))
+}
+
+func (o *debugOptions) printEnvNo(envNo int, envChanged bool) {
+	fmt.Fprint(o.out, ",")
+	if envChanged {
+		fmt.Fprint(o.out, consColorize(fmt.Sprintf(" e%v: ", envNo), Red))
+	} else {
+		fmt.Fprintf(o.out, " e%v: ", envNo)
+	}
+}
+
+// breakpoints
+
+// breaksAt reports whether node matches a breakpoint
+func (o *debugOptions) breaksAt(node ast.Node) bool {
+	for _, bp := range o.breakpoints {
+		if matchesBreakpoint(node, bp) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesBreakpoint reports whether node is of the node type bp, e.g. CallExpression,
+// or is a call of the identifier bp or the let statement binding it
+func matchesBreakpoint(node ast.Node, bp string) bool {
+	if reflect.TypeOf(node).Elem().Name() == bp {
+		return true
+	}
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		ident, ok := node.Function.(*ast.Identifier)
+		return ok && ident.Value == bp
+	case *ast.LetStatement:
+		return node.Name.Value == bp
+	}
+	return false
+}
+
+func (o *debugOptions) toggleBreakpoint(bp string) {
+	if bp == "" {
+		fmt.Fprintf(o.out, "\tBreakpoints: %v\n", strings.Join(o.breakpoints, ", "))
+		return
+	}
+	if list, removed := toggle(o.breakpoints, bp); removed {
+		o.breakpoints = list
+		fmt.Fprintf(o.out, "\tBreakpoint %v removed\n", bp)
+	} else {
+		o.breakpoints = list
+		fmt.Fprintf(o.out, "\tBreakpoint %v set\n", bp)
+	}
+}
+
+// watches
+
+func (o *debugOptions) toggleWatch(expr string) {
+	if expr == "" {
+		fmt.Fprintf(o.out, "\tWatches: %v\n", strings.Join(o.watches, ", "))
+		return
+	}
+	if list, removed := toggle(o.watches, expr); removed {
+		o.watches = list
+		fmt.Fprintf(o.out, "\tWatch %v removed\n", expr)
+		return
+	}
+	if _, err := parseWatch(expr); err != nil {
+		fmt.Fprintf(o.out, "\tWatch %v cannot be parsed: %v\n", expr, err)
+		return
+	}
+	o.watches = append(o.watches, expr)
+	fmt.Fprintf(o.out, "\tWatch %v added\n", expr)
+}
+
+func (o *debugOptions) printWatches(env *object.Environment, eval func(ast.Expression, *object.Environment) object.Object) {
+	for _, expr := range o.watches {
+		node, _ := parseWatch(expr)
+		val := eval(node, env)
+		fmt.Fprintf(o.out, "\n\t%v = %v %v", expr, visObjectType(val, o.verbosity, o.goObjType), consValue(val))
+	}
+	if len(o.watches) != 0 {
+		fmt.Fprint(o.out, "\n")
+	}
+}
+
+func parseWatch(expr string) (ast.Expression, error) {
+	p := parser.New(lexer.New(expr))
+	node := p.ParseExpression()
+	if len(p.Errors()) != 0 {
+		return nil, p.Errors()[0]
+	}
+	return node, nil
+}
+
+func (o *debugOptions) printBinding(env *object.Environment, envNo int, name string) {
+	if name == "" {
+		fmt.Fprint(o.out, "\tUsage: p <identifier>\n")
+		return
+	}
+	val, ok := env.Get(name)
+	if !ok {
+		fmt.Fprintf(o.out, "\t%v is not bound in e%v\n", name, envNo)
+		return
+	}
+	fmt.Fprintf(o.out, "\t%v : %v %v\n", name, visObjectType(val, o.verbosity, o.goObjType), consValue(val))
+}
+
+// toggle removes str from list if it is contained, and appends it otherwise
+func toggle(list []string, str string) ([]string, bool) {
+	for i, elem := range list {
+		if elem == str {
+			return append(list[:i:i], list[i+1:]...), true
+		}
+	}
+	return append(list, str), false
+}
@@ -0,0 +1,343 @@
+package visualizer
+
+import (
+	"fmt"
+	"html"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/types"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/*
+Graphviz DOT: the nodes of the trees become graph nodes, their fields labelled edges.
+Nodes that are referenced several times, e.g. function bodies by function objects,
+are drawn once. In evaltrees, the values a node evaluates to hang on dashed edges
+labelled with the number of the step, environments are drawn as tables.
+
+Mermaid flowcharts are built the same way; only the syntax of nodes and edges differs.
+*/
+
+func DotParseTree(input string, node ast.Node, verbosity int, inclToken bool, file string) error {
+	return writeDot(dotParseTree(input, node, nil, verbosity, inclToken), file)
+}
+
+// DotTypeTree is a parsetree whose nodes are annotated with the types inferred for them
+func DotTypeTree(input string, node ast.Node, info *types.Info, verbosity int, inclToken bool, file string) error {
+	return writeDot(dotParseTree(input, node, info, verbosity, inclToken), file)
+}
+
+func DotEvalTree(
+	input string,
+	trace *evaluator.Trace,
+	verbosity int,
+	inclToken bool,
+	goObjType bool,
+	inclEnv bool,
+	file string,
+) error {
+	return writeDot(dotEvalTree(input, trace, verbosity, inclToken, goObjType, inclEnv), file)
+}
+
+func dotParseTree(input string, node ast.Node, info *types.Info, verbosity int, inclToken bool) string {
+
+	v := NewVisRun(
+		"",
+		"",
+		getVerbosity(verbosity),
+		DOT,
+		PARSE,
+		inclToken,
+		false,
+		false,
+	)
+	v.types = info
+
+	tree := v.tree(node, nil)
+
+	return makeDigraph("ptree", input, tree)
+}
+
+func dotEvalTree(input string, trace *evaluator.Trace, verbosity int, inclToken bool, goObjType bool, inclEnv bool) string {
+
+	v := NewVisRun(
+		"",
+		"",
+		getVerbosity(verbosity),
+		DOT,
+		EVAL,
+		inclToken,
+		inclEnv,
+		goObjType,
+	)
+	tree := v.tree(trace.GetRoot(), trace)
+	if inclEnv {
+		tree += v.envs(trace)
+	}
+
+	return makeDigraph("etree", input, tree)
+}
+
+func makeDigraph(name string, input string, body string) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "digraph %s {\n", name)
+	fmt.Fprintf(&out, "  label=%s;\n  labelloc=t;\n", dotQuote(strings.ReplaceAll(input, "\n", " ")))
+	out.WriteString("  node [shape=box, style=\"rounded,filled\", fontname=\"Courier\"];\n")
+	out.WriteString("  edge [fontname=\"Courier\", fontsize=10];\n")
+	out.WriteString(body)
+	out.WriteString("}\n")
+	return out.String()
+}
+
+func writeDot(graph string, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(graph)
+	return err
+}
+
+// dotQuote makes str a quoted DOT string
+func dotQuote(str string) string {
+	str = strings.ReplaceAll(str, "\\", "\\\\")
+	str = strings.ReplaceAll(str, "\"", "\\\"")
+	return "\"" + str + "\""
+}
+
+// dotStyle is the appearance of a graph node
+type dotStyle int
+
+const (
+	dotPlain dotStyle = iota // only the label
+	dotProgram
+	dotStatement
+	dotExpression
+	dotBad
+	dotUnknown
+	dotObject
+	dotNil
+)
+
+var dotAttrs = map[dotStyle]string{
+	dotPlain:      "shape=plaintext, style=\"\"",
+	dotProgram:    "fillcolor=steelblue, fontcolor=white",
+	dotStatement:  "fillcolor=lightyellow",
+	dotExpression: "fillcolor=lightblue",
+	dotBad:        "fillcolor=red, fontcolor=white",
+	dotUnknown:    "fillcolor=red",
+	dotObject:     "fillcolor=black, fontcolor=white",
+	dotNil:        "fillcolor=red",
+}
+
+// dotStyleNode returns the style that colors the graph node of an ast node
+func dotStyleNode(node ast.Node) dotStyle {
+	if isBadNode(node) {
+		return dotBad
+	} else if _, ok := node.(ast.Expression); ok {
+		return dotExpression
+	} else if _, ok := node.(ast.Statement); ok {
+		return dotStatement
+	} else if _, ok := node.(*ast.Program); ok {
+		return dotProgram
+	} else { //new nodes that fall under neither of these cases
+		return dotUnknown
+	}
+}
+
+// dotParent is a graph node whose children are being visualized
+type dotParent struct {
+	id    string
+	label string // the label of the edges to the next children, e.g. the field name
+	list  bool   // the children are elements of a list, their edges are numbered
+	index int
+	exit  bool // the next child is a value the node has evaluated to
+	drawn bool // the node has been drawn before, its children are not drawn again
+}
+
+func (v *visRun) dotLine(format string, a ...interface{}) {
+	fmt.Fprintf(v.out, "  "+format+"\n", a...)
+}
+
+// dotNode adds a graph node
+func (v *visRun) dotNode(id string, label string, style dotStyle) {
+	if v.display == MERMAID {
+		v.dotLine("%s[%s]:::%s", id, mermaidQuote(label), mermaidClasses[style])
+		return
+	}
+	v.dotLine("%s [label=%s, %s];", id, dotQuote(label), dotAttrs[style])
+}
+
+func (v *visRun) dotNewId() string {
+	v.dotCount++
+	return fmt.Sprintf("n%d", v.dotCount)
+}
+
+// dotNodeId returns the id of the graph node of node and whether it already exists
+func (v *visRun) dotNodeId(node ast.Node) (string, bool) {
+	if id, ok := v.dotNodeIds[node]; ok {
+		return id, true
+	}
+	id := v.dotNewId()
+	v.dotNodeIds[node] = id
+	return id, false
+}
+
+func (v *visRun) dotObjectId(obj object.Object) (string, bool) {
+	if id, ok := v.dotObjectIds[obj]; ok {
+		return id, true
+	}
+	id := v.dotNewId()
+	v.dotObjectIds[obj] = id
+	return id, false
+}
+
+// dotEdge connects the current parent to the graph node id
+func (v *visRun) dotEdge(id string) {
+	if len(v.dotParents) == 0 {
+		return
+	}
+	parent := v.dotParents[len(v.dotParents)-1]
+
+	label := parent.label
+	if parent.list {
+		label = fmt.Sprintf("%s[%d]", label, parent.index)
+		parent.index++
+	}
+
+	if v.display == MERMAID {
+		arrow := "-->"
+		if parent.exit {
+			arrow = "-.->"
+		}
+		if label != "" {
+			arrow = arrow + "|" + mermaidQuote(label) + "|"
+		}
+		v.dotLine("%s %s %s", parent.id, arrow, id)
+		return
+	}
+
+	attrs := []string{}
+	if label != "" {
+		attrs = append(attrs, "label="+dotQuote(label))
+	}
+	if parent.exit {
+		attrs = append(attrs, "style=dashed", "color=darkgreen", "fontcolor=darkgreen")
+	}
+	if len(attrs) == 0 {
+		v.dotLine("%s -> %s;", parent.id, id)
+	} else {
+		v.dotLine("%s -> %s [%s];", parent.id, id, strings.Join(attrs, ", "))
+	}
+}
+
+func (v *visRun) dotPush(id string) {
+	v.dotParents = append(v.dotParents, &dotParent{id: id})
+}
+
+func (v *visRun) dotPop() {
+	v.dotParents = v.dotParents[:len(v.dotParents)-1]
+}
+
+func (v *visRun) dotTop() *dotParent {
+	if len(v.dotParents) == 0 { // should not happen
+		return &dotParent{}
+	}
+	return v.dotParents[len(v.dotParents)-1]
+}
+
+// dotLeaf adds a graph node without children
+func (v *visRun) dotLeaf(label string, style dotStyle) {
+	id := v.dotNewId()
+	v.dotNode(id, label, style)
+	v.dotEdge(id)
+}
+
+// only to be called if v.display is DOT or MERMAID and mode == WRITE
+func (v *visRun) beginNodeDOT(node ast.Node, trace *evaluator.Trace, visited bool) {
+
+	id, _ := v.dotNodeId(node)
+	if reflect.ValueOf(node).IsNil() { // nil pointers of the same type are not the same node
+		id = v.dotNewId()
+	}
+
+	if !visited {
+		left, right := "", ""
+
+		//display eval-calls and exits
+		if v.process == EVAL {
+			calls, exits := v.getCallsAndExits(node, trace)
+			for _, call := range calls {
+				left = left + fmt.Sprintf("%v,%v ↓ ", call.No, v.getEnvName(call.Env))
+			}
+			for _, exit := range exits {
+				right = right + fmt.Sprintf(" ↑%v,%v", exit.No, v.getEnvName(exit.Env))
+			}
+		}
+		v.dotNode(id, left+v.NodeLabel(node)+v.typeAnnotation(node)+right, dotStyleNode(node))
+	}
+	v.dotEdge(id)
+	v.dotPush(id)
+	v.incrIndent() // endNode decreases it
+}
+
+// only to be called if v.display is DOT or MERMAID and mode == WRITE
+func (v *visRun) beginObjectDOT(obj object.Object) {
+
+	id, drawn := v.dotObjectId(obj)
+	if !drawn {
+		v.dotNode(id, v.ObjLabel(obj), dotObject)
+	}
+	v.dotEdge(id)
+	v.dotPush(id)
+	v.dotTop().drawn = drawn
+}
+
+func (v *visRun) dotEnvId(env *object.Environment) string {
+	return "env_" + strings.TrimPrefix(v.getEnvName(env), "e")
+}
+
+// envsDOT draws the environments as tables linked to their outer environments
+func (v *visRun) envsDOT() string {
+
+	// the list grows while the outer environments are named
+	for i := 0; i < len(v.envsOrdered); i++ {
+		env := v.envsOrdered[i]
+
+		var label strings.Builder
+		label.WriteString("<<table border=\"0\" cellborder=\"1\" cellspacing=\"0\">")
+		fmt.Fprintf(&label, "<tr><td colspan=\"3\"><b>%s</b></td></tr>", v.getEnvName(env))
+
+		keys := make([]string, 0, len(env.Store))
+		for key := range env.Store {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			obj := env.Store[key]
+			value := "<nil>"
+			if obj != nil {
+				value = obj.Inspect()
+			}
+			fmt.Fprintf(&label, "<tr><td>%s</td><td>%s</td><td>%s</td></tr>",
+				html.EscapeString(key),
+				html.EscapeString(visObjectType(obj, v.verbosity, v.goObjType)),
+				html.EscapeString(strings.ReplaceAll(value, "\n", " ")))
+		}
+		label.WriteString("</table>>")
+
+		v.dotLine("%s [label=%s, shape=plaintext, style=\"\"];", v.dotEnvId(env), label.String())
+		if env.Outer != nil {
+			v.dotLine("%s -> %s [label=\"outer\", style=dotted];", v.dotEnvId(env), v.dotEnvId(env.Outer))
+		}
+	}
+
+	return v.out.String()
+}
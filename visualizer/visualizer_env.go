@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"monkey/evaluator"
 	"monkey/object"
-	"reflect"
 	"sort"
 	"strings"
 
@@ -180,6 +179,15 @@ func (v *visRun) envs(trace *evaluator.Trace) string {
 	// new buffer
 	var out bytes.Buffer
 	v.out = &out
+	if v.display == DOT {
+		return v.envsDOT()
+	}
+	if v.display == MERMAID {
+		return v.envsMermaid()
+	}
+	if v.display == SVG {
+		return v.envsSVG()
+	}
 	// durch Liste iterieren!
 	for _, env := range v.envsOrdered {
 		// stelle Abhängigkeiten dar, e.g. e0 --> e1 --> nil
@@ -225,35 +233,25 @@ func getEnvIntervals(env *object.Environment, t *evaluator.Trace) []*envSnapInte
 	envSnapIntervals = append(envSnapIntervals, curInterval)
 
 	for step := 0; step < t.Steps(); step++ {
-		// current step, snap
-		var snap *object.Environment
 		hit := false
-
 		if call, ok := t.Calls[step]; ok {
-			if call.Env == env {
-				hit = true
-				snap = call.EnvSnap
-			}
+			hit = call.Env == env
 		} else if exit, ok := t.Exits[step]; ok {
-			if exit.Env == env {
-				hit = true
-				snap = exit.EnvSnap
-			}
+			hit = exit.Env == env
 		}
 		if !hit {
 			continue
 		}
 
-		//
 		switch {
 		case curInterval.to < 0: // first hit
 			curInterval.from = step
 			curInterval.to = step
-			curInterval.envSnap = snap
-		case reflect.DeepEqual(snap, curInterval.envSnap): // no change
+			curInterval.envSnap = t.EnvAt(env, step)
+		case !t.EnvChanged(env, curInterval.to, step): // no change
 			curInterval.to = step
 		default: // change
-			curInterval = &envSnapInterval{snap, step, step}
+			curInterval = &envSnapInterval{t.EnvAt(env, step), step, step}
 			envSnapIntervals = append(envSnapIntervals, curInterval)
 		}
 	}
@@ -0,0 +1,347 @@
+package visualizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/token"
+	"monkey/types"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/*
+JSON: asts, traces and environments for other tools. The schema:
+
+node:        {"id": n, "type": "InfixExpression", "token": token, "fields": {"Left": node, ...},
+              "inferred": "INTEGER"}
+             ids are unique within a document; a node that has been written before
+             is written as {"ref": n}; inferred is only written for typed parsetrees;
+             the pairs of hash literals are [{"key": node, "value": node}, ...]
+token:       {"type": "+", "literal": "+", "line": 1, "column": 3}
+trace:       {"ast": node, "steps": [step, ...], "environments": [environment, ...],
+              "nodes": [node, ...]}
+             nodes holds the evaluated nodes that are not part of the ast, if any
+step:        {"no": 0, "kind": "call" | "exit", "id": n, "depth": n, "node": id of the node,
+              "env": id of the environment, "tail": true, "bindings": {"x": object, ...},
+              "value": object}
+             the call and the exit of the same evaluation share the id; tail is only
+             written for calls in tail position, value only for exits; bindings are the
+             bindings of the environment at the time of the step, without the outer ones
+environment: {"id": n, "outer": id of the outer environment or null, "bindings": {...}}
+             the bindings after the evaluation
+object:      {"type": "INTEGER", "value": 1}, with the fields depending on the type:
+             INTEGER, BOOLEAN, STRING, BUILTIN: value
+             ERROR: message, value (if thrown), line, column
+             ARRAY: elements; HASH: pairs [{"key": object, "value": object}, ...]
+             FUNCTION, MACRO: name (functions only), parameters, body (node), env (id)
+             RETURN_VALUE: value; QUOTE: node
+*/
+
+func JsonParseTree(node ast.Node) (string, error) {
+	e := newJsonEncoder()
+	return marshalJson(e.node(node))
+}
+
+// JsonTypeTree is a parsetree whose nodes are annotated with the types inferred for them
+func JsonTypeTree(node ast.Node, info *types.Info) (string, error) {
+	e := newJsonEncoder()
+	e.types = info
+	return marshalJson(e.node(node))
+}
+
+func JsonEvalTrace(trace *evaluator.Trace) (string, error) {
+	e := newJsonEncoder()
+	return marshalJson(e.trace(trace))
+}
+
+// JsonEnvironment writes env and its outer environments, the innermost first
+func JsonEnvironment(env *object.Environment) (string, error) {
+	e := newJsonEncoder()
+	e.envId(env)
+	return marshalJson(e.environments())
+}
+
+func WriteJson(str string, file string) error {
+	return ioutil.WriteFile(file, []byte(str+"\n"), 0644)
+}
+
+func marshalJson(i interface{}) (string, error) {
+	var out strings.Builder
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false) // types like FUNCTION(INTEGER) -> INTEGER are not embedded in html
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(i); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+type jsonNode struct {
+	Id       int                    `json:"id"`
+	Type     string                 `json:"type"`
+	Token    *jsonToken             `json:"token,omitempty"`
+	Fields   map[string]interface{} `json:"fields,omitempty"`
+	Inferred string                 `json:"inferred,omitempty"`
+}
+
+type jsonRef struct {
+	Ref int `json:"ref"`
+}
+
+type jsonToken struct {
+	Type    token.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+	Line    int             `json:"line"`
+	Column  int             `json:"column"`
+}
+
+type jsonTrace struct {
+	Ast          interface{}       `json:"ast"`
+	Steps        []jsonStep        `json:"steps"`
+	Environments []jsonEnvironment `json:"environments"`
+	Nodes        []interface{}     `json:"nodes,omitempty"`
+}
+
+type jsonStep struct {
+	No       int                    `json:"no"`
+	Kind     string                 `json:"kind"`
+	Id       int                    `json:"id"`
+	Depth    int                    `json:"depth"`
+	Node     int                    `json:"node"`
+	Env      int                    `json:"env"`
+	Tail     bool                   `json:"tail,omitempty"`
+	Bindings map[string]interface{} `json:"bindings"`
+	Value    interface{}            `json:"value,omitempty"`
+}
+
+type jsonEnvironment struct {
+	Id       int                    `json:"id"`
+	Outer    *int                   `json:"outer"`
+	Bindings map[string]interface{} `json:"bindings"`
+}
+
+// jsonEncoder numbers nodes and environments, so that they can be referenced
+type jsonEncoder struct {
+	nodeIds map[ast.Node]int
+	envs    []*object.Environment
+	extra   []interface{} // nodes outside of the ast
+	types   *types.Info   // annotates the nodes if not nil
+}
+
+func newJsonEncoder() *jsonEncoder {
+	return &jsonEncoder{nodeIds: make(map[ast.Node]int)}
+}
+
+func (e *jsonEncoder) node(node ast.Node) interface{} {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return nil
+	}
+	if id, ok := e.nodeIds[node]; ok {
+		return jsonRef{Ref: id}
+	}
+	id := len(e.nodeIds)
+	e.nodeIds[node] = id
+
+	val := reflect.ValueOf(node).Elem()
+	result := jsonNode{Id: id, Type: val.Type().Name(), Fields: make(map[string]interface{})}
+
+	for i := 0; i < val.NumField(); i++ {
+		name := val.Type().Field(i).Name
+		field := val.Field(i).Interface()
+		if tok, ok := field.(token.Token); ok && name == "Token" {
+			result.Token = &jsonToken{Type: tok.Type, Literal: tok.Literal, Line: tok.Line, Column: tok.Column}
+			continue
+		}
+		if hl, ok := node.(*ast.HashLiteral); ok && name == "Pairs" {
+			pairs := []interface{}{}
+			for _, key := range ast.SortedKeys(hl) {
+				pairs = append(pairs, map[string]interface{}{"key": e.node(key), "value": e.node(hl.Pairs[key])})
+			}
+			result.Fields[name] = pairs
+			continue
+		}
+		result.Fields[name] = e.value(field)
+	}
+	if e.types != nil {
+		if t, ok := e.types.TypeOf(node); ok {
+			result.Inferred = t.String()
+		}
+	}
+	return result
+}
+
+// value encodes the value of a field of a node
+func (e *jsonEncoder) value(i interface{}) interface{} {
+	if i == nil {
+		return nil
+	}
+	if reflect.TypeOf(i).Kind() == reflect.Slice {
+		values := reflect.ValueOf(i)
+		list := make([]interface{}, values.Len())
+		for j := range list {
+			list[j] = e.value(values.Index(j).Interface())
+		}
+		return list
+	}
+
+	switch i := i.(type) {
+	case ast.Node:
+		return e.node(i)
+	case token.Token:
+		return jsonToken{Type: i.Type, Literal: i.Literal, Line: i.Line, Column: i.Column}
+	case string, bool, int, int64:
+		return i
+	default:
+		return fmt.Sprint(i)
+	}
+}
+
+// nodeId returns the id of a node that has been evaluated
+func (e *jsonEncoder) nodeId(node ast.Node) int {
+	if _, ok := e.nodeIds[node]; !ok {
+		e.extra = append(e.extra, e.node(node))
+	}
+	return e.nodeIds[node]
+}
+
+func (e *jsonEncoder) envId(env *object.Environment) int {
+	for i, known := range e.envs {
+		if known == env {
+			return i
+		}
+	}
+	e.envs = append(e.envs, env)
+	if env.Outer != nil {
+		e.envId(env.Outer)
+	}
+	return len(e.envs) - 1
+}
+
+func (e *jsonEncoder) object(obj object.Object) interface{} {
+	if obj == nil || reflect.ValueOf(obj).IsNil() {
+		return nil
+	}
+
+	result := map[string]interface{}{"type": obj.Type()}
+	switch obj := obj.(type) {
+	case *object.Integer:
+		result["value"] = obj.Value
+	case *object.Boolean:
+		result["value"] = obj.Value
+	case *object.String:
+		result["value"] = obj.Value
+	case *object.Null:
+	case *object.Error:
+		result["message"] = obj.Message
+		if obj.Value != nil {
+			result["value"] = e.object(obj.Value)
+		}
+		result["line"] = obj.Line
+		result["column"] = obj.Column
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, element := range obj.Elements {
+			elements[i] = e.object(element)
+		}
+		result["elements"] = elements
+	case *object.Hash:
+		pairs := make([]object.HashPair, 0, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, pair)
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key.Inspect() < pairs[j].Key.Inspect() })
+
+		list := make([]interface{}, len(pairs))
+		for i, pair := range pairs {
+			list[i] = map[string]interface{}{"key": e.object(pair.Key), "value": e.object(pair.Value)}
+		}
+		result["pairs"] = list
+	case *object.Function:
+		if obj.Name != "" {
+			result["name"] = obj.Name
+		}
+		result["parameters"] = jsonParameters(obj.Parameters)
+		result["body"] = e.node(obj.Body)
+		result["env"] = e.envId(obj.Env)
+	case *object.Macro:
+		result["parameters"] = jsonParameters(obj.Parameters)
+		result["body"] = e.node(obj.Body)
+		result["env"] = e.envId(obj.Env)
+	case *object.ReturnValue:
+		result["value"] = e.object(obj.Value)
+	case *object.Quote:
+		result["node"] = e.node(obj.Node)
+	default:
+		result["value"] = obj.Inspect()
+	}
+	return result
+}
+
+func jsonParameters(params []*ast.Identifier) []string {
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.Value
+	}
+	return names
+}
+
+func (e *jsonEncoder) bindings(store map[string]object.Object) map[string]interface{} {
+	bindings := make(map[string]interface{})
+	for name, obj := range store {
+		bindings[name] = e.object(obj)
+	}
+	return bindings
+}
+
+func (e *jsonEncoder) trace(t *evaluator.Trace) jsonTrace {
+	result := jsonTrace{Ast: e.node(t.GetRoot()), Steps: []jsonStep{}}
+
+	for i := 0; i < t.Steps(); i++ {
+		if call, ok := t.Calls[i]; ok {
+			result.Steps = append(result.Steps, jsonStep{
+				No:       call.No,
+				Kind:     "call",
+				Id:       call.Id,
+				Depth:    call.Depth,
+				Node:     e.nodeId(call.Node),
+				Env:      e.envId(call.Env),
+				Tail:     call.Tail,
+				Bindings: e.bindings(t.StoreAt(call.Env, i)),
+			})
+		} else if exit, ok := t.Exits[i]; ok {
+			result.Steps = append(result.Steps, jsonStep{
+				No:       exit.No,
+				Kind:     "exit",
+				Id:       exit.Id,
+				Depth:    exit.Depth,
+				Node:     e.nodeId(exit.Node),
+				Env:      e.envId(exit.Env),
+				Bindings: e.bindings(t.StoreAt(exit.Env, i)),
+				Value:    e.object(exit.Val),
+			})
+		}
+	}
+
+	result.Environments = e.environments()
+	result.Nodes = e.extra
+	return result
+}
+
+// environments encodes the numbered environments; the list grows while their bindings are encoded
+func (e *jsonEncoder) environments() []jsonEnvironment {
+	result := []jsonEnvironment{}
+	for i := 0; i < len(e.envs); i++ {
+		env := e.envs[i]
+		result = append(result, jsonEnvironment{Id: i, Bindings: e.bindings(env.Store)})
+		if env.Outer != nil {
+			outer := e.envId(env.Outer)
+			result[i].Outer = &outer
+		}
+	}
+	return result
+}
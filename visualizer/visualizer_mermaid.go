@@ -0,0 +1,146 @@
+package visualizer
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/types"
+	"sort"
+	"strings"
+)
+
+/*
+Mermaid: the trees are written as flowcharts in fenced code blocks that can be pasted
+into Markdown documents. The graphs are built by the same functions as the DOT graphs.
+*/
+
+func MermaidParseTree(node ast.Node, verbosity int, inclToken bool) string {
+	return mermaidParseTree(node, nil, verbosity, inclToken)
+}
+
+// MermaidTypeTree is a parsetree whose nodes are annotated with the types inferred for them
+func MermaidTypeTree(node ast.Node, info *types.Info, verbosity int, inclToken bool) string {
+	return mermaidParseTree(node, info, verbosity, inclToken)
+}
+
+func mermaidParseTree(node ast.Node, info *types.Info, verbosity int, inclToken bool) string {
+
+	v := NewVisRun(
+		"",
+		"",
+		getVerbosity(verbosity),
+		MERMAID,
+		PARSE,
+		inclToken,
+		false,
+		false,
+	)
+	v.types = info
+
+	tree := v.tree(node, nil)
+
+	return makeFlowchart(tree)
+}
+
+func MermaidEvalTree(trace *evaluator.Trace, verbosity int, inclToken bool, goObjType bool, inclEnv bool) string {
+
+	v := NewVisRun(
+		"",
+		"",
+		getVerbosity(verbosity),
+		MERMAID,
+		EVAL,
+		inclToken,
+		inclEnv,
+		goObjType,
+	)
+	tree := v.tree(trace.GetRoot(), trace)
+	if inclEnv {
+		tree += v.envs(trace)
+	}
+
+	return makeFlowchart(tree)
+}
+
+var mermaidClasses = map[dotStyle]string{
+	dotPlain:      "plain",
+	dotProgram:    "program",
+	dotStatement:  "statement",
+	dotExpression: "expression",
+	dotBad:        "bad",
+	dotUnknown:    "unknown",
+	dotObject:     "object",
+	dotNil:        "nilvalue",
+}
+
+var mermaidClassDefs = map[dotStyle]string{
+	dotPlain:      "fill:none,stroke:none",
+	dotProgram:    "fill:steelblue,color:white",
+	dotStatement:  "fill:lightyellow",
+	dotExpression: "fill:lightblue",
+	dotBad:        "fill:red,color:white",
+	dotUnknown:    "fill:red",
+	dotObject:     "fill:black,color:white",
+	dotNil:        "fill:red",
+}
+
+func makeFlowchart(body string) string {
+	var out strings.Builder
+	out.WriteString("```mermaid\nflowchart TD\n")
+	for style := dotPlain; style <= dotNil; style++ {
+		fmt.Fprintf(&out, "  classDef %s %s\n", mermaidClasses[style], mermaidClassDefs[style])
+	}
+	out.WriteString(body)
+	out.WriteString("```")
+	return out.String()
+}
+
+// mermaidEscape replaces the characters Mermaid would interpret by entity codes
+func mermaidEscape(str string) string {
+	return strings.NewReplacer(
+		"#", "#35;",
+		"\"", "#quot;",
+		"<", "#lt;",
+		">", "#gt;",
+		"\n", " ",
+	).Replace(str)
+}
+
+// mermaidQuote makes str a quoted Mermaid label
+func mermaidQuote(str string) string {
+	return "\"" + mermaidEscape(str) + "\""
+}
+
+// envsMermaid draws the environments as nodes with a line for each binding
+func (v *visRun) envsMermaid() string {
+
+	// the list grows while the outer environments are named
+	for i := 0; i < len(v.envsOrdered); i++ {
+		env := v.envsOrdered[i]
+
+		lines := []string{"<b>" + v.getEnvName(env) + "</b>"}
+
+		keys := make([]string, 0, len(env.Store))
+		for key := range env.Store {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			obj := env.Store[key]
+			value := "<nil>"
+			if obj != nil {
+				value = obj.Inspect()
+			}
+			lines = append(lines, mermaidEscape(fmt.Sprintf("%s : %s %s",
+				key, visObjectType(obj, v.verbosity, v.goObjType), value)))
+		}
+
+		v.dotLine("%s[\"%s\"]:::%s", v.dotEnvId(env), strings.Join(lines, "<br/>"), mermaidClasses[dotPlain])
+		if env.Outer != nil {
+			v.dotLine("%s -.->|outer| %s", v.dotEnvId(env), v.dotEnvId(env.Outer))
+		}
+	}
+
+	return v.out.String()
+}
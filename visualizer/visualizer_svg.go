@@ -0,0 +1,408 @@
+package visualizer
+
+import (
+	"fmt"
+	"html"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/types"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+SVG: the trees are laid out without external tools. Every subtree gets a span as wide as
+its widest level, the children are placed side by side within the span and the parent is
+centered above them. Edges are labelled with the field names, the values a node evaluates
+to hang on dashed edges labelled with the number of the step.
+*/
+
+const (
+	svgMargin    = 20.0
+	svgTitle     = 30.0 // height of the line with the input
+	svgCharWidth = 7.2  // width of a character of the monospace font of size 12
+	svgPadding   = 8.0  // between the label and the border of a box
+	svgBoxHeight = 22.0
+	svgLevelGap  = 40.0 // between a box and its children; leaves room for the edge labels
+	svgGap       = 14.0 // between the spans of siblings
+	svgRowHeight = 18.0 // of the rows of environment tables
+)
+
+func SvgParseTree(input string, node ast.Node, verbosity int, inclToken bool, file string) error {
+	return writeSvg(svgParseTree(input, node, nil, verbosity, inclToken), file)
+}
+
+// SvgTypeTree is a parsetree whose nodes are annotated with the types inferred for them
+func SvgTypeTree(input string, node ast.Node, info *types.Info, verbosity int, inclToken bool, file string) error {
+	return writeSvg(svgParseTree(input, node, info, verbosity, inclToken), file)
+}
+
+func SvgEvalTree(
+	input string,
+	trace *evaluator.Trace,
+	verbosity int,
+	inclToken bool,
+	goObjType bool,
+	inclEnv bool,
+	file string,
+) error {
+	return writeSvg(svgEvalTree(input, trace, verbosity, inclToken, goObjType, inclEnv), file)
+}
+
+// SvgParseTreeString returns the svg document instead of writing it to a file
+func SvgParseTreeString(input string, node ast.Node, verbosity int, inclToken bool) string {
+	return svgParseTree(input, node, nil, verbosity, inclToken)
+}
+
+// SvgEvalTreeString returns the svg document instead of writing it to a file
+func SvgEvalTreeString(input string, trace *evaluator.Trace, verbosity int, inclToken bool, goObjType bool, inclEnv bool) string {
+	return svgEvalTree(input, trace, verbosity, inclToken, goObjType, inclEnv)
+}
+
+func svgParseTree(input string, node ast.Node, info *types.Info, verbosity int, inclToken bool) string {
+
+	v := NewVisRun(
+		"",
+		"",
+		getVerbosity(verbosity),
+		SVG,
+		PARSE,
+		inclToken,
+		false,
+		false,
+	)
+	v.types = info
+
+	tree := v.tree(node, nil)
+
+	return makeSvg(input, tree, v.svgWidth, v.svgHeight)
+}
+
+func svgEvalTree(input string, trace *evaluator.Trace, verbosity int, inclToken bool, goObjType bool, inclEnv bool) string {
+
+	v := NewVisRun(
+		"",
+		"",
+		getVerbosity(verbosity),
+		SVG,
+		EVAL,
+		inclToken,
+		inclEnv,
+		goObjType,
+	)
+	tree := v.tree(trace.GetRoot(), trace)
+	if inclEnv {
+		tree += v.envs(trace)
+	}
+
+	return makeSvg(input, tree, v.svgWidth, v.svgHeight)
+}
+
+func makeSvg(input string, body string, width float64, height float64) string {
+	width = max(width, svgTextWidth(input)) + 2*svgMargin
+	height = height + svgTitle + 2*svgMargin
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%.0f\" height=\"%.0f\" viewBox=\"0 0 %.0f %.0f\" font-family=\"Courier, monospace\" font-size=\"12\">\n",
+		width, height, width, height)
+	out.WriteString("<rect width=\"100%\" height=\"100%\" fill=\"white\"/>\n")
+	fmt.Fprintf(&out, "<text x=\"%.1f\" y=\"%.1f\" font-weight=\"bold\">%s</text>\n",
+		svgMargin, svgMargin+12, svgEscape(strings.ReplaceAll(input, "\n", " ")))
+	fmt.Fprintf(&out, "<g transform=\"translate(%.1f,%.1f)\">\n", svgMargin, svgMargin+svgTitle)
+	out.WriteString(body)
+	out.WriteString("</g>\n</svg>\n")
+	return out.String()
+}
+
+func writeSvg(svg string, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(svg)
+	return err
+}
+
+func svgEscape(str string) string {
+	return html.EscapeString(str)
+}
+
+func svgTextWidth(str string) float64 {
+	return float64(utf8.RuneCountInString(str)) * svgCharWidth
+}
+
+func max(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// svgColorNode returns the fill and text color of the box of an ast node
+func svgColorNode(node ast.Node) (string, string) {
+	if isBadNode(node) {
+		return "red", "white"
+	} else if _, ok := node.(ast.Expression); ok {
+		return "lightblue", "black"
+	} else if _, ok := node.(ast.Statement); ok {
+		return "lightyellow", "black"
+	} else if _, ok := node.(*ast.Program); ok {
+		return "steelblue", "white"
+	} else { //new nodes that fall under neither of these cases
+		return "red", "black"
+	}
+}
+
+// svgBox is a node of the tree that is drawn
+type svgBox struct {
+	label    string
+	fill     string // "" if the label is not boxed
+	color    string
+	edge     string // the label of the edge from the parent
+	exit     bool   // the box is a value the parent has evaluated to
+	children []*svgBox
+
+	x    float64 // the center
+	y    float64 // the top
+	span float64 // the width of the subtree
+}
+
+func (b *svgBox) width() float64 {
+	return svgTextWidth(b.label) + 2*svgPadding
+}
+
+// svgParent is a box whose children are being visualized
+type svgParent struct {
+	box   *svgBox
+	label string // the label of the edges to the next children, e.g. the field name
+	list  bool   // the children are elements of a list, their edges are numbered
+	index int
+	exit  bool // the next child is a value the node has evaluated to
+}
+
+// svgAdd adds box as next child of the current parent
+func (v *visRun) svgAdd(box *svgBox) {
+	if len(v.svgParents) == 0 {
+		v.svgRoot = box
+		return
+	}
+	parent := v.svgParents[len(v.svgParents)-1]
+
+	box.edge = parent.label
+	if parent.list {
+		box.edge = fmt.Sprintf("%s[%d]", parent.label, parent.index)
+		parent.index++
+	}
+	box.exit = parent.exit
+	parent.box.children = append(parent.box.children, box)
+}
+
+func (v *visRun) svgPush(box *svgBox) {
+	v.svgParents = append(v.svgParents, &svgParent{box: box})
+}
+
+func (v *visRun) svgPop() {
+	v.svgParents = v.svgParents[:len(v.svgParents)-1]
+}
+
+func (v *visRun) svgTop() *svgParent {
+	if len(v.svgParents) == 0 { // should not happen
+		return &svgParent{box: &svgBox{}}
+	}
+	return v.svgParents[len(v.svgParents)-1]
+}
+
+// svgLeaf adds a box without children; without fill, only the label is drawn
+func (v *visRun) svgLeaf(label string, fill string, color string) {
+	v.svgAdd(&svgBox{label: label, fill: fill, color: color})
+}
+
+// only to be called if v.display == SVG and mode == WRITE
+func (v *visRun) beginNodeSVG(node ast.Node, trace *evaluator.Trace, visited bool) {
+
+	left, right := "", ""
+
+	//display eval-calls and exits only for first occurence
+	if v.process == EVAL && !visited {
+		calls, exits := v.getCallsAndExits(node, trace)
+		for _, call := range calls {
+			left = left + fmt.Sprintf("%v,%v ↓ ", call.No, v.getEnvName(call.Env))
+		}
+		for _, exit := range exits {
+			right = right + fmt.Sprintf(" ↑%v,%v", exit.No, v.getEnvName(exit.Env))
+		}
+	}
+	fill, color := svgColorNode(node)
+	box := &svgBox{label: left + v.NodeLabel(node) + v.typeAnnotation(node) + right, fill: fill, color: color}
+
+	v.svgAdd(box)
+	v.svgPush(box)
+	v.incrIndent() // endNode decreases it
+}
+
+// only to be called if v.display == SVG and mode == WRITE
+func (v *visRun) beginObjectSVG(obj object.Object) {
+	box := &svgBox{label: v.ObjLabel(obj), fill: "black", color: "white"}
+	v.svgAdd(box)
+	v.svgPush(box)
+}
+
+// svgTree lays out the collected tree and draws it
+func (v *visRun) svgTree() string {
+	if v.svgRoot == nil {
+		return ""
+	}
+	svgMeasure(v.svgRoot)
+	svgPlace(v.svgRoot, 0, 0)
+
+	var out strings.Builder
+	svgDraw(&out, v.svgRoot)
+
+	v.svgWidth = v.svgRoot.span
+	v.svgHeight = svgHeight(v.svgRoot)
+	return out.String()
+}
+
+// svgMeasure computes the spans of box and its descendants
+func svgMeasure(box *svgBox) float64 {
+	children := 0.0
+	for i, child := range box.children {
+		if i > 0 {
+			children += svgGap
+		}
+		children += svgMeasure(child)
+	}
+	box.span = max(box.width(), children)
+	for _, child := range box.children { // the edge labels must fit as well
+		box.span = max(box.span, svgTextWidth(child.edge))
+	}
+	return box.span
+}
+
+// svgPlace places box within the span starting at left
+func svgPlace(box *svgBox, left float64, top float64) {
+	box.x = left + box.span/2
+	box.y = top
+
+	children := -svgGap
+	for _, child := range box.children {
+		children += child.span + svgGap
+	}
+	next := left + (box.span-children)/2
+	for _, child := range box.children {
+		svgPlace(child, next, top+svgBoxHeight+svgLevelGap)
+		next += child.span + svgGap
+	}
+}
+
+func svgHeight(box *svgBox) float64 {
+	height := box.y + svgBoxHeight
+	for _, child := range box.children {
+		height = max(height, svgHeight(child))
+	}
+	return height
+}
+
+// svgDraw draws the edges of box before the boxes, so that they do not cover them
+func svgDraw(out *strings.Builder, box *svgBox) {
+	for _, child := range box.children {
+		x1, y1 := box.x, box.y+svgBoxHeight
+		x2, y2 := child.x, child.y
+		stroke, attrs := "black", ""
+		if child.exit {
+			stroke, attrs = "darkgreen", " stroke-dasharray=\"4,3\""
+		}
+		fmt.Fprintf(out, "<line x1=\"%.1f\" y1=\"%.1f\" x2=\"%.1f\" y2=\"%.1f\" stroke=\"%s\"%s/>\n",
+			x1, y1, x2, y2, stroke, attrs)
+		if child.edge != "" {
+			fmt.Fprintf(out, "<text x=\"%.1f\" y=\"%.1f\" text-anchor=\"middle\" font-size=\"10\" fill=\"%s\" stroke=\"white\" stroke-width=\"3\" paint-order=\"stroke\">%s</text>\n",
+				(x1+x2)/2, (y1+y2)/2+3, stroke, svgEscape(child.edge))
+		}
+	}
+
+	if box.fill != "" {
+		fmt.Fprintf(out, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" rx=\"5\" fill=\"%s\" stroke=\"black\"/>\n",
+			box.x-box.width()/2, box.y, box.width(), svgBoxHeight, box.fill)
+	}
+	color := box.color
+	if color == "" {
+		color = "black"
+	}
+	fmt.Fprintf(out, "<text x=\"%.1f\" y=\"%.1f\" text-anchor=\"middle\" fill=\"%s\">%s</text>\n",
+		box.x, box.y+svgBoxHeight/2+4, color, svgEscape(box.label))
+
+	for _, child := range box.children {
+		svgDraw(out, child)
+	}
+}
+
+// envsSVG draws the environments as tables side by side below the tree
+func (v *visRun) envsSVG() string {
+	var out strings.Builder
+
+	left := 0.0
+	top := v.svgHeight + svgLevelGap
+	bottom := top
+
+	// the list grows while the outer environments are named
+	for i := 0; i < len(v.envsOrdered); i++ {
+		env := v.envsOrdered[i]
+
+		keys := make([]string, 0, len(env.Store))
+		for key := range env.Store {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		rows := make([][3]string, 0, len(keys))
+		for _, key := range keys {
+			obj := env.Store[key]
+			value := "<nil>"
+			if obj != nil {
+				value = strings.ReplaceAll(obj.Inspect(), "\n", " ")
+			}
+			rows = append(rows, [3]string{key, visObjectType(obj, v.verbosity, v.goObjType), value})
+		}
+
+		// the widths of the columns
+		widths := [3]float64{}
+		for _, row := range rows {
+			for c, cell := range row {
+				widths[c] = max(widths[c], svgTextWidth(cell)+2*svgPadding)
+			}
+		}
+		header := v.getEnvName(env) + " → outer: " + v.getEnvName(env.Outer)
+		width := max(widths[0]+widths[1]+widths[2], svgTextWidth(header)+2*svgPadding)
+		widths[2] = width - widths[0] - widths[1]
+
+		height := svgRowHeight * float64(len(rows)+1)
+		fmt.Fprintf(&out, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"white\" stroke=\"black\"/>\n",
+			left, top, width, height)
+		fmt.Fprintf(&out, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"lightgray\" stroke=\"black\"/>\n",
+			left, top, width, svgRowHeight)
+		fmt.Fprintf(&out, "<text x=\"%.1f\" y=\"%.1f\" font-weight=\"bold\">%s</text>\n",
+			left+svgPadding, top+svgRowHeight-5, svgEscape(header))
+
+		for r, row := range rows {
+			x := left
+			y := top + svgRowHeight*float64(r+1)
+			for c, cell := range row {
+				fmt.Fprintf(&out, "<text x=\"%.1f\" y=\"%.1f\">%s</text>\n",
+					x+svgPadding, y+svgRowHeight-5, svgEscape(cell))
+				x += widths[c]
+			}
+		}
+
+		left += width + svgGap
+		bottom = max(bottom, top+height)
+	}
+
+	v.svgWidth = max(v.svgWidth, left-svgGap)
+	v.svgHeight = bottom
+	return out.String()
+}
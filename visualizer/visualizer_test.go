@@ -1,11 +1,17 @@
 package visualizer
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"monkey/ast"
 	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/types"
+	"strings"
 	"testing"
 )
 
@@ -184,6 +190,10 @@ func Test_TeXParseTree(t *testing.T) {
 		IndexExpression
 		HashLiteral
 
+		--- extensions:
+		SliceExpression
+		TryExpression
+
 	*/
 	tests := []struct {
 		input string
@@ -198,6 +208,8 @@ func Test_TeXParseTree(t *testing.T) {
 		{"!true", "bang"},
 		{"let a = if(a>2){}", "let-if"},
 		{"return if(false){} else {}", "return-if"},
+		{"a[1:]", "slice"},
+		{"try { throw(1) } catch (e) { e }", "try"},
 	}
 
 	for _, tt := range tests {
@@ -515,3 +527,514 @@ func Test_TeXEvalTree_inclEnv(t *testing.T) {
 }
 
 // cons tested mainly manually!!!
+
+func Test_ConsTypeTree(t *testing.T) {
+	input := "let f = fn(x) { x + 1 }; f(2)"
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	node := p.ParseProgram()
+	info := types.Infer(node)
+
+	tree := ConsTypeTree(node, info, 0, false, "", "  ")
+	for _, annotation := range []string{
+		" : " + consColorize("FUNCTION(INTEGER) -> INTEGER", Green),
+		" : " + consColorize("INTEGER", Green),
+	} {
+		if !strings.Contains(tree, annotation) {
+			t.Errorf("annotation %q missing in tree:\n%s", annotation, tree)
+		}
+	}
+
+	if plain := ConsParseTree(node, 0, false, "", "  "); strings.Contains(plain, " : ") {
+		t.Errorf("parsetree is annotated:\n%s", plain)
+	}
+}
+
+func Test_SideBySide(t *testing.T) {
+	left := consColorize("ab", Green) + "\nabcd\n"
+	right := "x\ny\nz\nw"
+
+	expected := "ab      x\nabcd    y\n        z\n        w"
+	if got := SideBySide(left, right, 4); colorCode.ReplaceAllString(got, "") != expected {
+		t.Errorf("wrong layout.\nwant=\n%s\ngot=\n%s", expected, got)
+	}
+}
+
+func Test_DotParseTree(t *testing.T) {
+	input := `let f = fn(x) { x + "a" }; f(@)`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	node := p.ParseProgram()
+
+	graph := dotParseTree(input, node, nil, 0, false)
+	for _, line := range []string{
+		"digraph ptree {",
+		`  label="let f = fn(x) { x + \"a\" }; f(@)";`,
+		`  n1 [label="Prog", fillcolor=steelblue, fontcolor=white];`,
+		`  n1 -> n2 [label="Stmts[0]"];`,
+		`  n6 -> n7 [label="Val"];`,
+		`  n5 -> n6 [label="Params[0]"];`,
+		`[label="BadE", fillcolor=red, fontcolor=white];`,
+	} {
+		if !strings.Contains(graph, line) {
+			t.Errorf("line %q missing in graph:\n%s", line, graph)
+		}
+	}
+	if strings.Count(graph, "{") != strings.Count(graph, "}") {
+		t.Errorf("unbalanced graph:\n%s", graph)
+	}
+
+	info := types.Infer(node)
+	if graph := dotParseTree(input, node, info, 0, false); !strings.Contains(graph, `[label="FctL : FUNCTION(STRING) -> STRING"`) {
+		t.Errorf("type annotation missing in graph:\n%s", graph)
+	}
+}
+
+func Test_DotEvalTree(t *testing.T) {
+	input := "let f = fn(x) { x }; f(1); f(2)"
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	node := p.ParseProgram()
+	env := object.NewEnvironment()
+	_, trace := evaluator.EvalT(node, env, true)
+
+	graph := dotEvalTree(input, trace, 0, false, false, true)
+
+	// the body of f is drawn once, with the values of both calls
+	if n := strings.Count(graph, `BlkS ↑`); n != 1 {
+		t.Errorf("body drawn %d times:\n%s", n, graph)
+	}
+	for _, part := range []string{
+		"style=dashed, color=darkgreen",
+		`[label="Env"];`,
+		`-> env_0 [label="outer", style=dotted];`,
+		"<td>f</td><td>FUNCTION</td>",
+	} {
+		if !strings.Contains(graph, part) {
+			t.Errorf("%q missing in graph:\n%s", part, graph)
+		}
+	}
+
+	if graph := dotEvalTree(input, trace, 0, false, false, false); strings.Contains(graph, "env_") {
+		t.Errorf("environments drawn without inclEnv:\n%s", graph)
+	}
+}
+
+func Test_SvgParseTree(t *testing.T) {
+	input := `let f = fn(x) { x < "a" }; f(@)`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	node := p.ParseProgram()
+
+	svg := svgParseTree(input, node, nil, 0, false)
+	for _, part := range []string{
+		`<svg xmlns="http://www.w3.org/2000/svg"`,
+		`font-weight="bold">let f = fn(x) { x &lt; &#34;a&#34; }; f(@)</text>`,
+		`fill="white">Prog</text>`,
+		`>Stmts[0]</text>`,
+		`>Params[0]</text>`,
+		`fill="red" stroke="black"/>`,
+	} {
+		if !strings.Contains(svg, part) {
+			t.Errorf("%q missing in svg:\n%s", part, svg)
+		}
+	}
+
+	info := types.Infer(node)
+	if svg := svgParseTree(input, node, info, 0, false); !strings.Contains(svg, ">FctL : FUNCTION(STRING) -&gt; BOOLEAN</text>") {
+		t.Errorf("type annotation missing in svg:\n%s", svg)
+	}
+}
+
+func Test_SvgLayout(t *testing.T) {
+	leaf := func(label string) *svgBox { return &svgBox{label: label} }
+	root := &svgBox{label: "r", children: []*svgBox{leaf("a"), {label: "b", children: []*svgBox{leaf("c"), leaf("d")}}}}
+
+	svgMeasure(root)
+	svgPlace(root, 0, 0)
+
+	// siblings do not overlap, parents are centered above their children
+	var check func(box *svgBox)
+	check = func(box *svgBox) {
+		for i, child := range box.children {
+			if child.y <= box.y {
+				t.Errorf("%s is not below %s", child.label, box.label)
+			}
+			if i > 0 {
+				prev := box.children[i-1]
+				if prev.x+prev.span/2 > child.x-child.span/2 {
+					t.Errorf("%s overlaps %s", prev.label, child.label)
+				}
+			}
+			check(child)
+		}
+		if n := len(box.children); n > 0 {
+			first, last := box.children[0], box.children[n-1]
+			if center := (first.x - first.span/2 + last.x + last.span/2) / 2; center != box.x {
+				t.Errorf("%s is not centered: %v, want %v", box.label, box.x, center)
+			}
+		}
+	}
+	check(root)
+}
+
+func Test_SvgEvalTree(t *testing.T) {
+	input := "let f = fn(x) { x }; f(1); f(2)"
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	node := p.ParseProgram()
+	env := object.NewEnvironment()
+	_, trace := evaluator.EvalT(node, env, true)
+
+	svg := svgEvalTree(input, trace, 0, false, false, true)
+	for _, part := range []string{
+		`stroke="darkgreen" stroke-dasharray="4,3"/>`,
+		`>e1 → outer: e0</text>`,
+		`>FUNCTION</text>`,
+		`BlkS0 ↑`,
+	} {
+		if !strings.Contains(svg, part) {
+			t.Errorf("%q missing in svg:\n%s", part, svg)
+		}
+	}
+
+	if svg := svgEvalTree(input, trace, 0, false, false, false); strings.Contains(svg, "outer") {
+		t.Errorf("environments drawn without inclEnv:\n%s", svg)
+	}
+}
+
+func Test_MermaidParseTree(t *testing.T) {
+	input := `let f = fn(x) { x + "<#>" }; f(@)`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	node := p.ParseProgram()
+
+	chart := MermaidParseTree(node, 0, false)
+	for _, line := range []string{
+		"```mermaid\nflowchart TD\n",
+		"  classDef expression fill:lightblue\n",
+		"  n1[\"Prog\"]:::program\n",
+		"  n1 -->|\"Stmts[0]\"| n2\n",
+		"  n5 -->|\"Params[0]\"| n6\n",
+		"[\"#lt;#35;#gt;\"]:::plain\n",
+		"[\"BadE\"]:::bad\n",
+	} {
+		if !strings.Contains(chart, line) {
+			t.Errorf("line %q missing in chart:\n%s", line, chart)
+		}
+	}
+	if !strings.HasSuffix(chart, "\n```") {
+		t.Errorf("chart is not closed:\n%s", chart)
+	}
+}
+
+func Test_MermaidEvalTree(t *testing.T) {
+	input := "let f = fn(x) { x }; f(1)"
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	node := p.ParseProgram()
+	env := object.NewEnvironment()
+	_, trace := evaluator.EvalT(node, env, true)
+
+	chart := MermaidEvalTree(trace, 0, false, false, true)
+	for _, part := range []string{
+		"[\"INTEGER\"]:::object\n",
+		" -.->|\"14\"| ",
+		"env_1 -.->|outer| env_0\n",
+		"<br/>x : INTEGER 1",
+	} {
+		if !strings.Contains(chart, part) {
+			t.Errorf("%q missing in chart:\n%s", part, chart)
+		}
+	}
+}
+
+func Test_TraceMarkdown(t *testing.T) {
+	input := "2 * 3"
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	node := p.ParseProgram()
+	env := object.NewEnvironment()
+	_, trace := evaluator.EvalT(node, env, true)
+
+	var out strings.Builder
+	TraceMarkdown(trace, &out, 0, false)
+
+	expected := "|  | Nodetype | Node | Objecttype | Value |\n" +
+		"| --- | --- | --- | --- | --- |\n" +
+		"| call 0 | Prog | `(2 * 3)` |  |  |\n" +
+		"| call 1 | ExpS | `(2 * 3)` |  |  |\n" +
+		"| call 2 | InfE | `(2 * 3)` |  |  |\n" +
+		"| call 3 | IntL | `2` |  |  |\n" +
+		"| exit 3 | IntL | `2` | INTEGER | `2` |\n" +
+		"| call 3 | IntL | `3` |  |  |\n" +
+		"| exit 3 | IntL | `3` | INTEGER | `3` |\n" +
+		"| exit 2 | InfE | `(2 * 3)` | INTEGER | `6` |\n" +
+		"| exit 1 | ExpS | `(2 * 3)` | INTEGER | `6` |\n" +
+		"| exit 0 | Prog | `(2 * 3)` | INTEGER | `6` |\n"
+	if out.String() != expected {
+		t.Errorf("wrong table.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func Test_JsonParseTree(t *testing.T) {
+	input := `let f = fn(x) { x + 1 }; {"a": f}`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	node := p.ParseProgram()
+
+	str, err := JsonParseTree(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(str)); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, str)
+	}
+	for _, part := range []string{
+		`{"id":0,"type":"Program","fields":{"Statements":[{"id":1,"type":"LetStatement"`,
+		`"type":"InfixExpression","token":{"type":"+","literal":"+","line":1,"column":19}`,
+		`"fields":{"Pairs":[{"key":{"id":`,
+		`"fields":{"Value":"a"}`,
+	} {
+		if !strings.Contains(compact.String(), part) {
+			t.Errorf("%q missing in json:\n%s", part, compact.String())
+		}
+	}
+
+	str, err = JsonTypeTree(node, types.Infer(node))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(str, `"inferred": "FUNCTION(INTEGER) -> INTEGER"`) {
+		t.Errorf("type annotation missing in json:\n%s", str)
+	}
+}
+
+func Test_JsonEvalTrace(t *testing.T) {
+	input := "let f = fn(x) { x }; f(1)"
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	node := p.ParseProgram()
+	env := object.NewEnvironment()
+	_, trace := evaluator.EvalT(node, env, true)
+
+	str, err := JsonEvalTrace(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		Ast struct {
+			Id int
+		}
+		Steps []struct {
+			No, Id, Depth, Node, Env int
+			Kind                     string
+			Bindings                 map[string]map[string]interface{}
+			Value                    map[string]interface{}
+		}
+		Environments []struct {
+			Id       int
+			Outer    *int
+			Bindings map[string]map[string]interface{}
+		}
+		Nodes []interface{}
+	}
+	if err := json.Unmarshal([]byte(str), &decoded); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, str)
+	}
+
+	if len(decoded.Steps) != trace.Steps() {
+		t.Errorf("wrong number of steps. want=%d, got=%d", trace.Steps(), len(decoded.Steps))
+	}
+	if len(decoded.Nodes) != 0 {
+		t.Errorf("evaluated nodes outside of the ast: %v", decoded.Nodes)
+	}
+	last := decoded.Steps[len(decoded.Steps)-1]
+	if last.Kind != "exit" || last.Node != decoded.Ast.Id || last.Value["value"] != 1.0 {
+		t.Errorf("wrong last step: %+v", last)
+	}
+
+	if len(decoded.Environments) != 2 {
+		t.Fatalf("wrong number of environments. want=2, got=%d", len(decoded.Environments))
+	}
+	if outer := decoded.Environments[1].Outer; outer == nil || *outer != 0 {
+		t.Errorf("wrong outer environment: %v", outer)
+	}
+	f := decoded.Environments[0].Bindings["f"]
+	if f["type"] != "FUNCTION" || f["env"] != 0.0 || f["body"] == nil {
+		t.Errorf("wrong function: %v", f)
+	}
+}
+
+func Test_TraceInteractive(t *testing.T) {
+	input := "let f = fn(x) { x * 2 }; f(1)"
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	node := p.ParseProgram()
+	env := object.NewEnvironment()
+	_, trace := evaluator.EvalT(node, env, true)
+
+	replies := []string{
+		"bp CallExpression", // set breakpoint
+		"r",                 // -> call of f(1)
+		"n",                 // -> exit of f(1)
+		"b",                 // -> back to the last step within f(1)
+		"p x",               // x is bound in the environment of the function
+		"w x + 1",
+		"g 1", // -> let statement
+		"p x", // x is not bound
+		"a",
+	}
+	scanner := bufio.NewScanner(strings.NewReader(strings.Join(replies, "\n")))
+	var out strings.Builder
+	traceInteractive(trace, &out, scanner, getVerbosity(0), false)
+
+	// the step shown after each reply
+	prompts := strings.Split(out.String(), " ? ")
+	tests := []struct {
+		prompt   int
+		expected string
+	}{
+		{1, "Breakpoint CallExpression set"},
+		{2, "call 2"},
+		{2, " f(1)"},
+		{3, " f(1) -> INTEGER 2"},
+		{4, " (x * 2) -> INTEGER 2"},
+		{5, "x : INTEGER 1"},
+		{6, "x + 1 = INTEGER 2"},
+		{7, " let f = "},
+		{8, "x is not bound in e0"},
+	}
+	for _, tt := range tests {
+		if tt.prompt >= len(prompts) {
+			t.Fatalf("only %d prompts, output:\n%s", len(prompts), out.String())
+		}
+		if !strings.Contains(prompts[tt.prompt], tt.expected) {
+			t.Errorf("prompt %d: expected %q, got %q", tt.prompt, tt.expected, prompts[tt.prompt])
+		}
+	}
+}
+
+func Test_matchesBreakpoint(t *testing.T) {
+	program := parser.New(lexer.New("let f = fn(x) { x }; f(1)")).ParseProgram()
+	let := program.Statements[0]
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression
+
+	tests := []struct {
+		node     ast.Node
+		bp       string
+		expected bool
+	}{
+		{let, "f", true},
+		{let, "x", false},
+		{let, "LetStatement", true},
+		{call, "f", true},
+		{call, "CallExpression", true},
+		{call, "g", false},
+	}
+	for _, tt := range tests {
+		if got := matchesBreakpoint(tt.node, tt.bp); got != tt.expected {
+			t.Errorf("matchesBreakpoint(%v, %q): expected %v, got %v", tt.node, tt.bp, tt.expected, got)
+		}
+	}
+}
+
+func Test_ConsDebugger(t *testing.T) {
+	input := "let f = fn(x) { f(x + 1) }; f(0)" // does not terminate
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	node := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	replies := []string{
+		"bp CallExpression", // set breakpoint
+		"r",                 // -> call of f(0)
+		"r",                 // -> call of f(x + 1) in the body of f
+		"p x",
+		"w x * 10",
+		"o", // -> exit of the expression statement around it
+		"a",
+	}
+	scanner := bufio.NewScanner(strings.NewReader(strings.Join(replies, "\n")))
+	var out strings.Builder
+	evaluator.SetLimits(evaluator.Limits{MaxSteps: 10000}) // in case the debugger does not abort
+	defer evaluator.SetLimits(evaluator.Limits{})
+	obj := evaluator.EvalD(node, env, NewConsDebugger(&out, scanner, 0, false))
+
+	if err, ok := obj.(*object.Error); !ok || err.Message != "evaluation interrupted" {
+		t.Errorf("expected the evaluation to be interrupted, got %v", obj)
+	}
+
+	prompts := strings.Split(out.String(), " ? ")
+	tests := []struct {
+		prompt   int
+		expected string
+	}{
+		{1, "Breakpoint CallExpression set"},
+		{2, " f(0)"},
+		{3, " f((x + 1))"},
+		{4, "x : INTEGER 0"},
+		{5, "x * 10 = INTEGER 0"},
+		{6, "exit 4"},
+	}
+	for _, tt := range tests {
+		if tt.prompt >= len(prompts) {
+			t.Fatalf("only %d prompts, output:\n%s", len(prompts), out.String())
+		}
+		if !strings.Contains(prompts[tt.prompt], tt.expected) {
+			t.Errorf("prompt %d: expected %q, got %q", tt.prompt, tt.expected, prompts[tt.prompt])
+		}
+	}
+}
+
+func Test_ConsDebugger_envChanged(t *testing.T) {
+	input := "let a = 1; let a = 2; a"
+	node := parser.New(lexer.New(input)).ParseProgram()
+
+	scanner := bufio.NewScanner(strings.NewReader(strings.Repeat("c\n", 20)))
+	var out strings.Builder
+	evaluator.EvalD(node, object.NewEnvironment(), NewConsDebugger(&out, scanner, 0, false))
+
+	changed := consColorize(" e0: ", Red)
+	rebound := false
+	for _, prompt := range strings.Split(out.String(), " ? ") {
+		if strings.Contains(prompt, "exit 1") && strings.Contains(prompt, "let a = 2;") {
+			rebound = true
+			if !strings.Contains(prompt, changed) {
+				t.Errorf("rebinding a is not highlighted: %q", prompt)
+			}
+		}
+	}
+	if !rebound {
+		t.Fatalf("no exit of the second let statement, output:\n%s", out.String())
+	}
+}
+
+// BenchmarkEnvIntervals splits the trace of a recursive program into the intervals
+// in which the global environment does not change
+func BenchmarkEnvIntervals(b *testing.B) {
+	input := "let a = 1; let b = 2; let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } }; let c = fib(12); c"
+	env := object.NewEnvironment()
+	_, trace := evaluator.EvalT(parser.New(lexer.New(input)).ParseProgram(), env, true)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if intervals := getEnvIntervals(env, trace); len(intervals) != 5 {
+			b.Fatalf("wrong number of intervals: %d", len(intervals))
+		}
+	}
+}
@@ -135,7 +135,9 @@ var tikz_suffix = `
 `
 
 func texColorNodeStr(nodeType string, node ast.Node) string {
-	if _, ok := node.(ast.Expression); ok {
+	if isBadNode(node) {
+		return texColorize(nodeType, "red", "white")
+	} else if _, ok := node.(ast.Expression); ok {
 		return texColorize(nodeType, "bluish", "black")
 	} else if _, ok := node.(ast.Statement); ok {
 		return texColorize(nodeType, "yellish", "black")
@@ -4,9 +4,10 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"monkey/ast"
 	"monkey/evaluator"
 	"monkey/object"
-	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/jedib0t/go-pretty/v6/table"
@@ -18,94 +19,195 @@ func TraceInteractive(t *evaluator.Trace, out io.Writer, scanner *bufio.Scanner,
 
 func traceInteractive(t *evaluator.Trace, out io.Writer, scanner *bufio.Scanner, verbosity verbosity, goObjType bool) { // before: TraceEvalConsole
 
-	calls := t.Calls
-	exits := t.Exits
-	envs := make(map[*object.Environment]int)
-	var cur_env_snap *object.Environment
-	var cur_env *object.Environment
+	d := newTraceDebugger(t, out, verbosity, goObjType)
 
 	cur_step := 0
 
 	for cur_step < t.Steps() {
-		var envNo int
-		envChanged := false
-		if call, ok := calls[cur_step]; ok {
-			if cur_step > 0 && (cur_env != call.Env || !reflect.DeepEqual(call.EnvSnap, cur_env_snap)) {
-				envChanged = true
-			}
-			cur_env = call.Env
-			cur_env_snap = call.EnvSnap
-			if no, ok := envs[cur_env]; ok {
-				envNo = no
-			} else {
-				envNo = len(envs)
-				envs[cur_env] = envNo
-			}
-			fmt.Fprint(out, consColorize(fmt.Sprintf("call %v", call.Depth), Red))
-			fmt.Fprint(out, ",")
-			if envChanged {
-				fmt.Fprint(out, consColorize(fmt.Sprintf(" e%v: ", envNo), Red))
-			} else {
-				fmt.Fprintf(out, " e%v: ", envNo)
-			}
-			fmt.Fprintf(out, "%v %v", consNode(call.Node, verbosity), call.Node)
-		} else if exit, ok := exits[cur_step]; ok {
-			if cur_env != exit.Env || !reflect.DeepEqual(exit.EnvSnap, cur_env_snap) {
-				envChanged = true
-			}
-			cur_env = exit.Env
-			cur_env_snap = exit.EnvSnap
-			envNo = envs[cur_env]
-			fmt.Fprint(out, consColorize(fmt.Sprintf("exit %v", exit.Depth), Green))
-
-			fmt.Fprint(out, ",")
-			if envChanged {
-				fmt.Fprint(out, consColorize(fmt.Sprintf(" e%v: ", envNo), Red))
-			} else {
-				fmt.Fprintf(out, " e%v: ", envNo)
-			}
-			fmt.Fprintf(out, "%v %v", consNode(exit.Node, verbosity), exit.Node)
-			val := "nil"
-			if exit.Val != nil {
-				val = strings.ReplaceAll(exit.Val.Inspect(), "\n", " ")
-			}
-			fmt.Fprintf(out, " -> %v %v ", visObjectType(exit.Val, verbosity, goObjType), val)
-
-		} else {
-			fmt.Fprint(out, "We have a problem")
-		}
+		d.printStep(cur_step)
+		d.printWatches(cur_step)
 		fmt.Fprint(out, " ? ")
 
 		scanned := scanner.Scan()
 		if !scanned {
 			return
 		}
-		reply := scanner.Text()
-		switch reply {
+		cmd, arg := splitReply(scanner.Text())
+		switch cmd {
 		case "a":
 			return
 		case "h":
-			fmt.Fprintf(out, "\tOptions: a: abort, [c]: continue, e: display environment\n")
+			fmt.Fprint(out, traceDebuggerHelp)
 		case "c", "":
 			cur_step++
 			continue
 		case "e":
-			env_rep := consEnvTables(cur_env_snap, "   ", verbosity, goObjType)
+			env_rep := consEnvTables(d.envSnap(cur_step), "   ", verbosity, goObjType)
 			cur_step++
 			fmt.Fprint(out, env_rep)
 			continue
+		case "b":
+			if cur_step == 0 {
+				fmt.Fprint(out, "\tThis is the first step\n")
+			} else {
+				cur_step--
+			}
+		case "n":
+			depth := d.depth(cur_step)
+			cur_step = d.find(cur_step, func(i int) bool { return d.depth(i) <= depth })
+		case "o":
+			depth := d.depth(cur_step)
+			cur_step = d.find(cur_step, func(i int) bool { return d.depth(i) < depth })
+		case "r":
+			if len(d.breakpoints) == 0 {
+				fmt.Fprint(out, "\tNo breakpoints set (bp <identifier|node type>)\n")
+				continue
+			}
+			cur_step = d.find(cur_step, d.atBreakpoint)
+		case "g":
+			step, err := strconv.Atoi(arg)
+			if err != nil || step < 0 || step >= t.Steps() {
+				fmt.Fprintf(out, "\tThere is no step %q, the steps are 0 to %v\n", arg, t.Steps()-1)
+				continue
+			}
+			cur_step = step
+		case "bp":
+			d.toggleBreakpoint(arg)
+		case "w":
+			d.toggleWatch(arg)
+		case "p":
+			d.printBinding(cur_step, arg)
 		default:
 			fmt.Fprint(out, "\tUnknown option (h for help)\n")
+		}
+	}
+}
 
+const traceDebuggerHelp = "\tOptions: a: abort, [c]: continue, e: display environment,\n" +
+	"\t         b: back, n: next at the same depth, o: step out, g <step>: go to <step>,\n" +
+	"\t         r: run to the next breakpoint, bp <identifier|node type>: set or remove breakpoint,\n" +
+	"\t         w <expression>: add or remove watch, p <identifier>: print binding\n"
+
+// traceDebugger holds what is needed to move through a recorded trace in any direction
+type traceDebugger struct {
+	debugOptions
+	t    *evaluator.Trace
+	envs map[*object.Environment]int // numbered in the order of the steps
+}
+
+func newTraceDebugger(t *evaluator.Trace, out io.Writer, verbosity verbosity, goObjType bool) *traceDebugger {
+	d := &traceDebugger{
+		debugOptions: debugOptions{out: out, verbosity: verbosity, goObjType: goObjType},
+		t:            t,
+		envs:         make(map[*object.Environment]int),
+	}
+	for i := 0; i < t.Steps(); i++ {
+		if _, ok := d.envs[d.env(i)]; !ok {
+			d.envs[d.env(i)] = len(d.envs)
 		}
 	}
+	return d
+}
+
+func (d *traceDebugger) depth(step int) int {
+	if call, ok := d.t.Calls[step]; ok {
+		return call.Depth
+	}
+	return d.t.Exits[step].Depth
+}
+
+func (d *traceDebugger) env(step int) *object.Environment {
+	if call, ok := d.t.Calls[step]; ok {
+		return call.Env
+	}
+	return d.t.Exits[step].Env
+}
+
+func (d *traceDebugger) envSnap(step int) *object.Environment {
+	return d.t.EnvSnap(step)
+}
+
+// find returns the first step after step that satisfies cond, or the number of steps
+func (d *traceDebugger) find(step int, cond func(int) bool) int {
+	for step++; step < d.t.Steps(); step++ {
+		if cond(step) {
+			return step
+		}
+	}
+	return step
+}
+
+func (d *traceDebugger) printStep(step int) {
+	envChanged := step > 0 &&
+		(d.env(step) != d.env(step-1) || d.t.EnvChanged(d.env(step), step-1, step))
+	envNo := d.envs[d.env(step)]
+
+	if call, ok := d.t.Calls[step]; ok {
+		d.printCall(callLabel(call), call.Depth, envNo, envChanged, call.Node)
+	} else if exit, ok := d.t.Exits[step]; ok {
+		d.printExit(exit.Depth, envNo, envChanged, exit.Node, exit.Val)
+	} else {
+		fmt.Fprint(d.out, "We have a problem")
+	}
+}
+
+// atBreakpoint reports whether the evaluation of a node matching a breakpoint starts at step
+func (d *traceDebugger) atBreakpoint(step int) bool {
+	call, ok := d.t.Calls[step]
+	return ok && d.breaksAt(call.Node)
+}
+
+func (d *traceDebugger) printWatches(step int) {
+	d.debugOptions.printWatches(d.envSnap(step), evalWatch)
+}
+
+// evalWatch evaluates a watch expression in an environment enclosed by the snapshot,
+// so that neither the snapshot nor the trace are changed
+func evalWatch(node ast.Expression, snap *object.Environment) object.Object {
+	val, _ := evaluator.EvalT(node, object.NewEnclosedEnvironment(snap), false)
+	return val
+}
+
+func (d *traceDebugger) printBinding(step int, name string) {
+	d.debugOptions.printBinding(d.envSnap(step), d.envs[d.env(step)], name)
 }
 
 func TraceTable(t *evaluator.Trace, out io.Writer, verbosity int, goObjType bool) { // before: RepresentEvalTraceConsole
 	traceTable(t, out, getVerbosity(verbosity), goObjType)
 }
 
+// TraceMarkdown writes the trace as a Markdown table, without colors
+func TraceMarkdown(t *evaluator.Trace, out io.Writer, verbosity int, goObjType bool) {
+	tab := traceRows(t, out, getVerbosity(verbosity), goObjType, false)
+	tab.RenderMarkdown()
+}
+
 func traceTable(t *evaluator.Trace, out io.Writer, verbosity verbosity, goObjType bool) { // before: RepresentEvalTraceConsole
+	tab := traceRows(t, out, verbosity, goObjType, true)
+	tab.Render()
+}
+
+// traceRows fills a table with a row for each step of the trace
+func traceRows(t *evaluator.Trace, out io.Writer, verbosity verbosity, goObjType bool, colored bool) table.Writer {
+	colorize := func(str string, color string) string {
+		if colored {
+			return consColorize(str, color)
+		}
+		return str
+	}
+	nodeType := func(node ast.Node) string {
+		if colored {
+			return consNode(node, verbosity)
+		}
+		return visNodeType(node, verbosity)
+	}
+	source := func(str string) string { // in Markdown, e.g. * must not start emphasis
+		if colored || str == "" {
+			return str
+		}
+		return "`" + str + "`"
+	}
+
 	tab := table.NewWriter()
 	tab.SetOutputMirror(out)
 	tab.AppendHeader(table.Row{"", "Nodetype", "Node", "Objecttype", "Value"})
@@ -118,26 +220,34 @@ func traceTable(t *evaluator.Trace, out io.Writer, verbosity verbosity, goObjTyp
 
 		if call, ok := calls[i]; ok {
 			tab.AppendRow([]interface{}{
-				consColorize(fmt.Sprintf("call %v", call.Depth), Red),
+				colorize(fmt.Sprintf("%v %v", callLabel(call), call.Depth), Red),
 
-				consNode(call.Node, verbosity),
-				fmt.Sprintf("%v", call.Node)})
+				nodeType(call.Node),
+				source(fmt.Sprintf("%v", call.Node))})
 		} else if exit, ok := exits[i]; ok {
 			val := "nil"
 			if exit.Val != nil {
 				val = strings.ReplaceAll(exit.Val.Inspect(), "\n", " ")
 			}
 			tab.AppendRow([]interface{}{
-				consColorize(fmt.Sprintf("exit %v", exit.Depth), Green),
-				consNode(exit.Node, verbosity),
-				fmt.Sprintf("%v", exit.Node),
+				colorize(fmt.Sprintf("exit %v", exit.Depth), Green),
+				nodeType(exit.Node),
+				source(fmt.Sprintf("%v", exit.Node)),
 				visObjectType(exit.Val, verbosity, goObjType),
-				val,
+				source(val),
 			})
 		} else {
 			fmt.Fprint(out, "We have a problem")
 		}
 
 	}
-	tab.Render()
+	return tab
+}
+
+// tail calls are not applied on their own, but by the call of the enclosing function
+func callLabel(call evaluator.Call) string {
+	if call.Tail {
+		return "tail call"
+	}
+	return "call"
 }
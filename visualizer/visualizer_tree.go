@@ -7,6 +7,7 @@ import (
 	"monkey/evaluator"
 	"monkey/object"
 	"monkey/token"
+	"monkey/types"
 	"os"
 	"reflect"
 	"strings"
@@ -79,6 +80,67 @@ func TeXParseTree(
 	return err
 }
 
+// ConsTypeTree is a parsetree whose nodes are annotated with the types inferred for them
+func ConsTypeTree(
+	node ast.Node,
+	info *types.Info,
+	verbosity int,
+	inclToken bool,
+	prefix string,
+	indent string,
+) string {
+
+	v := NewVisRun(
+		prefix,
+		indent,
+		getVerbosity(verbosity),
+		CONSOLE,
+		PARSE,
+		inclToken,
+		false,
+		false,
+	)
+	v.types = info
+
+	tree := v.tree(node, nil)
+
+	return tree
+}
+
+func TeXTypeTree(
+	input string,
+	node ast.Node,
+	info *types.Info,
+	verbosity int,
+	inclToken bool,
+	file string,
+	path string,
+) error {
+
+	v := NewVisRun(
+		prefixTeX,
+		indentTeX,
+		getVerbosity(verbosity),
+		TEX,
+		PARSE,
+		inclToken,
+		false,
+		false,
+	)
+	v.types = info
+
+	tree := v.tree(node, nil)
+
+	document := makeStandalone(texInput(input) + "\n" + tree)
+
+	err := tex2pdf(document, file, path)
+
+	if err == nil && DEBUG {
+		err = debug_tex(document, "ttree.tex")
+	}
+	return err
+}
+
 func ConsEvalTree(
 	trace *evaluator.Trace,
 	verbosity int,
@@ -182,6 +244,10 @@ func (v *visRun) tree(node ast.Node, trace *evaluator.Trace) string { //replaces
 		return makeTikz("\\Tree " + v.out.String())
 	case CONSOLE:
 		return v.prefix + v.out.String()
+	case DOT, MERMAID:
+		return v.out.String()
+	case SVG:
+		return v.svgTree()
 	default:
 		return "unknown display"
 	}
@@ -250,7 +316,7 @@ func (v *visRun) visualizeNode(node ast.Node, trace *evaluator.Trace, mode mode)
 
 		}
 
-		if v.process == EVAL && v.display == TEX {
+		if v.process == EVAL && (v.display == TEX || v.display == DOT || v.display == MERMAID || v.display == SVG) {
 			//add objects
 			_, exits := v.getCallsAndExits(node, trace)
 			for _, exit := range exits {
@@ -276,6 +342,12 @@ func (v *visRun) endVal(mode mode) {
 	switch v.display {
 	case TEX: //nix
 	case CONSOLE: //nix
+	case DOT, MERMAID:
+		v.dotTop().label = ""
+		v.dotTop().exit = false
+	case SVG:
+		v.svgTop().label = ""
+		v.svgTop().exit = false
 	}
 
 }
@@ -290,7 +362,12 @@ func (v *visRun) beginVal(no int, mode mode) {
 		v.printInd("\\edge node[auto=left]{\\tiny ", no, "};  ")
 	case CONSOLE:
 		v.printInd("val ", no, ": ") //TODO
-
+	case DOT, MERMAID:
+		v.dotTop().label = fmt.Sprint(no)
+		v.dotTop().exit = true
+	case SVG:
+		v.svgTop().label = fmt.Sprint(no)
+		v.svgTop().exit = true
 	}
 
 }
@@ -380,6 +457,14 @@ func (v *visRun) visualizeEnv(env *object.Environment, mode mode) {
 		v.printW("[.", name, " ]")
 	case CONSOLE:
 		v.printW(name)
+	case DOT, MERMAID:
+		if v.inclEnv {
+			v.dotEdge(v.dotEnvId(env))
+		} else {
+			v.dotLeaf(name, dotPlain)
+		}
+	case SVG:
+		v.svgLeaf(name, "", "")
 	}
 }
 func (v *visRun) visualizeObject(obj object.Object, trace *evaluator.Trace, mode mode) {
@@ -436,7 +521,7 @@ func (v *visRun) visualizeObject(obj object.Object, trace *evaluator.Trace, mode
 			return
 		}
 
-		if obj, ok := obj.(*object.Error); ok && v.verbosity < VVV && v.display == TEX {
+		if obj, ok := obj.(*object.Error); ok && v.verbosity < VVV && (v.display == TEX || v.display == DOT || v.display == MERMAID || v.display == SVG) {
 			v.visualizeErrorMsgShort(obj, mode)
 			v.endObject(mode)
 			return
@@ -498,7 +583,10 @@ func (v *visRun) visualizeErrorMsgShort(obj *object.Error, mode mode) {
 
 	case CONSOLE: //TODO
 		v.printW(v.colorObj(strings.ToUpper(obj.Inspect()), mode))
-
+	case DOT, MERMAID:
+		v.dotLeaf(obj.Message, dotPlain)
+	case SVG:
+		v.svgLeaf(obj.Message, "", "")
 	}
 
 }
@@ -514,6 +602,10 @@ func (v *visRun) beginObject(obj object.Object, mode mode) {
 		v.printW("[.", v.representObjectType(obj, mode))
 	case CONSOLE:
 		v.printW(v.representObjectType(obj, mode))
+	case DOT, MERMAID:
+		v.beginObjectDOT(obj)
+	case SVG:
+		v.beginObjectSVG(obj)
 	}
 	v.incrIndent()
 
@@ -528,7 +620,7 @@ func (v *visRun) colorObj(str string, mode mode) string {
 		return texColorize(str, "black", "white")
 	case CONSOLE:
 		return consColorize(str, Green) //TODO
-	default:
+	default: // DOT, MERMAID and SVG color their nodes by attributes
 		return str
 	}
 }
@@ -547,7 +639,7 @@ func (v *visRun) objectType(obj object.Object) string {
 	case TEX:
 		tex_label, _ := teXify(vOT)
 		return tex_label
-	case CONSOLE:
+	case CONSOLE, DOT, MERMAID, SVG:
 		return vOT
 	default:
 		return "unimplemented display"
@@ -565,6 +657,14 @@ func (v *visRun) visualizeSimpleObj(obj object.Object, mode mode) {
 	if mode == COLLECT {
 		return
 	}
+	if v.display == DOT || v.display == MERMAID {
+		v.dotLeaf(strings.ToUpper(obj.Inspect()), dotObject)
+		return
+	}
+	if v.display == SVG {
+		v.svgLeaf(strings.ToUpper(obj.Inspect()), "black", "white")
+		return
+	}
 	v.printW(v.colorObj(strings.ToUpper(obj.Inspect()), mode))
 
 }
@@ -578,6 +678,10 @@ func (v *visRun) endObject(mode mode) { // == endNode
 	case TEX:
 		v.printInd("]")
 	case CONSOLE: //nix
+	case DOT, MERMAID:
+		v.dotPop()
+	case SVG:
+		v.svgPop()
 	}
 }
 
@@ -649,6 +753,10 @@ func (v *visRun) visualizeLeaf(i interface{}, roof bool, mode mode) {
 		v.printW(texStr)
 	case CONSOLE:
 		v.printW(leafStr)
+	case DOT, MERMAID:
+		v.dotLeaf(leafStr, dotPlain)
+	case SVG:
+		v.svgLeaf(leafStr, "", "")
 	}
 }
 
@@ -664,6 +772,18 @@ func (v *visRun) beginList(len int, mode mode) {
 	case CONSOLE:
 		v.printW("[")
 		v.incrIndent()
+	case DOT, MERMAID:
+		if len == 0 {
+			v.dotLeaf("[]", dotPlain)
+		}
+		v.dotTop().list = true
+		v.dotTop().index = 0
+	case SVG:
+		if len == 0 {
+			v.svgLeaf("[]", "", "")
+		}
+		v.svgTop().list = true
+		v.svgTop().index = 0
 	}
 }
 
@@ -676,6 +796,10 @@ func (v *visRun) endList(mode mode) {
 	case CONSOLE:
 		v.decrIndent()
 		v.printInd("]")
+	case DOT, MERMAID:
+		v.dotTop().list = false
+	case SVG:
+		v.svgTop().list = false
 	}
 }
 
@@ -688,6 +812,14 @@ func (v *visRun) beginNode(node ast.Node, trace *evaluator.Trace, visited bool,
 		}
 	case CONSOLE:
 		v.beginNodeCONSOLE(node, trace, visited, mode)
+	case DOT, MERMAID:
+		if mode == WRITE {
+			v.beginNodeDOT(node, trace, visited)
+		}
+	case SVG:
+		if mode == WRITE {
+			v.beginNodeSVG(node, trace, visited)
+		}
 	}
 }
 
@@ -698,7 +830,7 @@ func (v *visRun) getEnvName(env *object.Environment) string {
 	for i, e := range v.envsOrdered {
 		if e == env {
 			switch v.display {
-			case CONSOLE:
+			case CONSOLE, DOT, MERMAID, SVG:
 				return fmt.Sprintf("e%v", i)
 			case TEX:
 				return fmt.Sprintf("e$_{%v}$", i)
@@ -730,16 +862,38 @@ func (v *visRun) beginNodeTEX(node ast.Node, trace *evaluator.Trace, visited boo
 		v.printW("[.{{\\small ", left, "}", v.representNodeType(node), " {\\small ", right, "}}")
 
 	} else {
-		v.printW("[.{", v.representNodeType(node), "}")
+		v.printW("[.{", v.representNodeType(node), v.typeAnnotation(node), "}")
 	}
 	v.incrIndent()
 }
 
+// typeAnnotation is the type inferred for node, if types are displayed
+func (v *visRun) typeAnnotation(node ast.Node) string {
+	if v.types == nil {
+		return ""
+	}
+	t, ok := v.types.TypeOf(node)
+	if !ok {
+		return ""
+	}
+	switch v.display {
+	case TEX:
+		tex, _ := teXify(t.String())
+		return " {\\small : " + tex + "}"
+	case CONSOLE:
+		return " : " + consColorize(t.String(), Green)
+	case DOT, MERMAID, SVG:
+		return " : " + t.String()
+	default:
+		return ""
+	}
+}
+
 // only to be called if v.display == CONSOLE
 func (v *visRun) beginNodeCONSOLE(node ast.Node, trace *evaluator.Trace, visited bool, mode mode) {
 
 	if mode == WRITE {
-		v.printW(v.representNodeType(node))
+		v.printW(v.representNodeType(node), v.typeAnnotation(node))
 		v.incrIndent()
 	}
 
@@ -781,7 +935,10 @@ func (v *visRun) beginField(fieldname string, mode mode) {
 		v.printInd()
 	case CONSOLE:
 		v.printInd(str, ": ")
-
+	case DOT, MERMAID:
+		v.dotTop().label = str
+	case SVG:
+		v.svgTop().label = str
 	}
 }
 
@@ -794,6 +951,10 @@ func (v *visRun) endField(mode mode) {
 		v.decrIndent()
 		v.printInd("]")
 	case CONSOLE: //nix
+	case DOT, MERMAID:
+		v.dotTop().label = ""
+	case SVG:
+		v.svgTop().label = ""
 	}
 }
 
@@ -823,6 +984,10 @@ func (v *visRun) endNode(visited bool, mode mode) {
 		if !visited {
 			v.printInd("}")
 		}
+	case DOT, MERMAID:
+		v.dotPop()
+	case SVG:
+		v.svgPop()
 	}
 }
 
@@ -838,7 +1003,12 @@ func (v *visRun) visualizeRoofed(str string, mode mode) { // if CONSOLE: use it
 
 	case CONSOLE: //TODO
 		v.printW(consColorize(" { "+str+" }", Green))
-
+	case DOT, MERMAID:
+		if !v.dotTop().drawn {
+			v.dotLeaf(str, dotPlain)
+		}
+	case SVG:
+		v.svgLeaf(str, "", "")
 	}
 
 }
@@ -879,7 +1049,7 @@ func (v *visRun) NodeLabel(node ast.Node) string {
 	case TEX:
 		tex_label, _ := teXify(visNodeType(node, v.verbosity))
 		return tex_label
-	case CONSOLE:
+	case CONSOLE, DOT, MERMAID, SVG:
 		return visNodeType(node, v.verbosity)
 	default:
 		return "unknown"
@@ -900,7 +1070,7 @@ func (v *visRun) createNodeName(node ast.Node) {
 	}
 
 	switch v.display {
-	case CONSOLE:
+	case CONSOLE, SVG:
 		v.namesNodes[typestr][node] = typestr + fmt.Sprint(len(v.namesNodes[typestr]))
 
 	case TEX:
@@ -924,7 +1094,7 @@ func (v *visRun) createObjectName(obj object.Object) {
 	}
 
 	switch v.display {
-	case CONSOLE:
+	case CONSOLE, SVG:
 		v.namesObjects[typestr][obj] = typestr + fmt.Sprint(len(v.namesObjects[typestr]))
 
 	case TEX:
@@ -945,6 +1115,10 @@ func (v *visRun) visualizeNil() {
 		v.printW("[.", texColorize("nil", "red", "black"), " ]")
 	case CONSOLE:
 		v.printW(consColorize("nil", Red))
+	case DOT, MERMAID:
+		v.dotLeaf("nil", dotNil)
+	case SVG:
+		v.svgLeaf("nil", "red", "black")
 	}
 }
 
@@ -954,6 +1128,10 @@ func (v *visRun) visualizeNilObject() {
 		v.printW("[.", texColorize("nil", "black", "red"), " ]")
 	case CONSOLE:
 		v.printW(consColorize("nil", Red))
+	case DOT, MERMAID:
+		v.dotLeaf("nil", dotNil)
+	case SVG:
+		v.svgLeaf("nil", "red", "black")
 	}
 }
 
@@ -964,6 +1142,10 @@ func (v *visRun) visualizeNilValue() {
 		v.printInd(texColorize("$\\emptyset$", "red", "black"))
 	case CONSOLE:
 		v.printInd(consColorize("is nil", Red))
+	case DOT, MERMAID:
+		v.dotLeaf("is nil", dotNil)
+	case SVG:
+		v.svgLeaf("is nil", "red", "black")
 	}
 }
 
@@ -984,6 +1166,15 @@ type visRun struct {
 	visitedObjects map[object.Object]bool
 	namesObjects   map[string]map[object.Object]string
 	envsOrdered    []*object.Environment
+	types          *types.Info              // annotates the nodes of parsetrees if not nil
+	dotCount       int                      // the number of graph nodes so far
+	dotNodeIds     map[ast.Node]string      // the graph nodes of ast nodes
+	dotObjectIds   map[object.Object]string // the graph nodes of objects
+	dotParents     []*dotParent             // the graph nodes whose children are being visualized
+	svgRoot        *svgBox                  // the tree that is laid out after it is collected
+	svgParents     []*svgParent             // the boxes whose children are being visualized
+	svgWidth       float64                  // of the drawing so far
+	svgHeight      float64
 
 	// visited --> to avoid printing out cycles
 	//-> only for those things that are not ends = don*t call the visualize-Method again
@@ -1021,6 +1212,8 @@ func NewVisRun(
 		namesNodes:   namesNodes,
 		namesObjects: namesObjects,
 		envsOrdered:  envsOrdered,
+		dotNodeIds:   make(map[ast.Node]string),
+		dotObjectIds: make(map[object.Object]string),
 	}
 }
 
@@ -1056,6 +1249,9 @@ type display int
 const (
 	TEX display = iota
 	CONSOLE
+	DOT
+	SVG
+	MERMAID
 )
 
 type process int
@@ -0,0 +1,133 @@
+package visualizer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"monkey/object"
+	"monkey/vm"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// VmTraceInteractive steps through the states of a virtual machine,
+// as TraceInteractive steps through the evaluation of the evaluator
+func VmTraceInteractive(t *vm.Trace, out io.Writer, scanner *bufio.Scanner, verbosity int, goObjType bool) {
+	vmTraceInteractive(t, out, scanner, getVerbosity(verbosity), goObjType)
+}
+
+func vmTraceInteractive(t *vm.Trace, out io.Writer, scanner *bufio.Scanner, verbosity verbosity, goObjType bool) {
+
+	cur_step := 0
+
+	for cur_step < t.Steps() {
+		step := t.Step(cur_step)
+		frame := step.Frames[len(step.Frames)-1]
+
+		fmt.Fprint(out, consColorize(fmt.Sprintf("step %v", cur_step), Red))
+		fmt.Fprintf(out, ", frame %v %v: ", len(step.Frames)-1, frame.Function)
+		fmt.Fprint(out, consColorize(fmt.Sprintf("%04d %v", step.Ip, step.Instruction), Cyan))
+		fmt.Fprintf(out, " | stack: %v", consStack(step.Stack))
+		fmt.Fprint(out, " ? ")
+
+		scanned := scanner.Scan()
+		if !scanned {
+			return
+		}
+		reply := scanner.Text()
+		switch reply {
+		case "a":
+			return
+		case "h":
+			fmt.Fprintf(out, "\tOptions: a: abort, [c]: continue, s: display stack, f: display frames, l: display locals\n")
+		case "c", "":
+			cur_step++
+		case "s":
+			fmt.Fprint(out, indentLines(consStackTable(step.Stack, verbosity, goObjType), "   "))
+			cur_step++
+		case "f":
+			fmt.Fprint(out, indentLines(consFramesTable(step.Frames), "   "))
+			cur_step++
+		case "l":
+			fmt.Fprint(out, indentLines(consLocalsTable(frame, verbosity, goObjType), "   "))
+			cur_step++
+		default:
+			fmt.Fprint(out, "\tUnknown option (h for help)\n")
+		}
+	}
+}
+
+// consStack represents a stack in one line, top of stack last
+func consStack(stack []object.Object) string {
+	values := make([]string, len(stack))
+	for i, obj := range stack {
+		values[i] = consValue(obj)
+	}
+	return "[" + strings.Join(values, " | ") + "]"
+}
+
+func consValue(obj object.Object) string {
+	if obj == nil {
+		return "nil"
+	}
+	return strings.ReplaceAll(obj.Inspect(), "\n", " ")
+}
+
+func consStackTable(stack []object.Object, verbosity verbosity, goObjType bool) string {
+	var temp_out strings.Builder
+
+	t := table.NewWriter()
+	t.SetOutputMirror(&temp_out)
+	t.AppendHeader(table.Row{"", "Type", "Value"})
+	t.AppendSeparator()
+
+	for i := len(stack) - 1; i >= 0; i-- {
+		t.AppendRow([]interface{}{i, visObjectType(stack[i], verbosity, goObjType), consValue(stack[i])})
+	}
+
+	t.Render()
+	return temp_out.String()
+}
+
+func consFramesTable(frames []vm.FrameState) string {
+	var temp_out strings.Builder
+
+	t := table.NewWriter()
+	t.SetOutputMirror(&temp_out)
+	t.AppendHeader(table.Row{"", "Function", "Ip"})
+	t.AppendSeparator()
+
+	for i := len(frames) - 1; i >= 0; i-- {
+		t.AppendRow([]interface{}{i, frames[i].Function, fmt.Sprintf("%04d", frames[i].Ip)})
+	}
+
+	t.Render()
+	return temp_out.String()
+}
+
+func consLocalsTable(frame vm.FrameState, verbosity verbosity, goObjType bool) string {
+	var temp_out strings.Builder
+
+	t := table.NewWriter()
+	t.SetOutputMirror(&temp_out)
+	t.AppendHeader(table.Row{"", "Identifier", "Type", "Value"})
+	t.AppendSeparator()
+
+	for i, obj := range frame.Locals {
+		t.AppendRow([]interface{}{i, frame.LocalNames[i], visObjectType(obj, verbosity, goObjType), consValue(obj)})
+	}
+
+	t.Render()
+	return temp_out.String()
+}
+
+func indentLines(str string, indent string) string {
+	var out strings.Builder
+	for _, line := range strings.Split(str, "\n") {
+		if line != "" {
+			fmt.Fprintln(&out, indent, line)
+		}
+	}
+	return out.String()
+}
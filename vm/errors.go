@@ -0,0 +1,59 @@
+package vm
+
+import (
+	"monkey/object"
+)
+
+// locateError marks err with the position of the current instruction
+// and the frames of the virtual machine
+func (vm *VM) locateError(err *object.Error) {
+	frame := vm.currentFrame()
+	line, column := object.PositionAt(frame.cl.Fn.Positions, frame.ip)
+	err.Line, err.Column = line, column
+	err.Stack = vm.stackFrames(line, column)
+}
+
+// stackFrames lists the frames, innermost frame first;
+// line and column are the current position within the innermost frame.
+func (vm *VM) stackFrames(line, column int) []object.StackFrame {
+	frames := make([]object.StackFrame, 0, len(vm.frames))
+
+	for i := len(vm.frames) - 1; i >= 0; i-- {
+		f := vm.frames[i]
+		frames = append(frames, object.StackFrame{
+			Function: functionName(f.cl),
+			Line:     line,
+			Column:   column,
+		})
+		if i > 0 { // a tail call is called from where the frame it took over was
+			caller := vm.frames[i-1]
+			line, column = object.PositionAt(caller.cl.Fn.Callees, caller.ip)
+		}
+	}
+
+	return frames
+}
+
+// addCallerFrames appends the frames to those of an error raised by a function
+// of another engine or virtual machine, which has been applied by the current instruction
+func (vm *VM) addCallerFrames(obj object.Object) object.Object {
+	err, ok := obj.(*object.Error)
+	if !ok || err.Line == 0 { // not located yet, see locateError
+		return obj
+	}
+	frame := vm.currentFrame()
+	line, column := object.PositionAt(frame.cl.Fn.Callees, frame.ip)
+	err.Stack = append(err.Stack, vm.stackFrames(line, column)...)
+	return err
+}
+
+func functionName(cl *object.Closure) string {
+	switch {
+	case cl.Fn.Literal == nil:
+		return "<program>"
+	case cl.Name == "":
+		return "<anonymous>"
+	default:
+		return cl.Name
+	}
+}
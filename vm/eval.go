@@ -0,0 +1,102 @@
+package vm
+
+import (
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+func init() {
+	// closures may be called by the evaluator, e.g. after switching engines in a session
+	evaluator.RegisterApplier(&object.Closure{}, func(fn object.Object, args []object.Object) object.Object {
+		return Apply(fn.(*object.Closure), args)
+	})
+}
+
+// A State is the state of the virtual machines evaluating in an environment.
+// It is kept between evaluations, so that closures of former evaluations see
+// the globals bound later; it is freed with the environment.
+type State struct {
+	env         *object.Environment
+	symbolTable *compiler.SymbolTable
+	globals     *object.Globals
+}
+
+func NewState(env *object.Environment) *State {
+	return &State{
+		env:         env,
+		symbolTable: compiler.NewSymbolTable(),
+		globals:     &object.Globals{},
+	}
+}
+
+// Eval compiles a node and runs it, like evaluator.Eval does, with a new State.
+// The bindings of env are available as globals; the globals are bound in env afterwards.
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	return NewState(env).Eval(node)
+}
+
+// Eval compiles a node and runs it in the environment of s
+func (s *State) Eval(node ast.Node) object.Object {
+	return s.eval(node, nil)
+}
+
+// EvalTrace is Eval recording the states of the virtual machine
+func (s *State) EvalTrace(node ast.Node) (object.Object, *Trace) {
+	trace := &Trace{}
+	return s.eval(node, trace), trace
+}
+
+// Compile compiles a node as Eval does, without running it
+func (s *State) Compile(node ast.Node) (*compiler.Bytecode, error) {
+	s.load(s.env)
+
+	// each input starts with no constants; closures of former input keep theirs
+	c := compiler.NewWithState(s.symbolTable, []object.Object{})
+	if err := c.Compile(node); err != nil {
+		return nil, err
+	}
+	return c.Bytecode(), nil
+}
+
+func (s *State) eval(node ast.Node, trace *Trace) object.Object {
+	evaluator.ResetInterrupt()
+
+	bytecode, err := s.Compile(node)
+	if err != nil {
+		return evaluator.NewError("compile error: %s", err)
+	}
+
+	s.globals.Names = s.symbolTable.GlobalNames()
+	for len(s.globals.Slots) < len(s.globals.Names) {
+		s.globals.Slots = append(s.globals.Slots, nil)
+	}
+
+	vm := New(bytecode.Main, s.globals)
+	vm.trace = trace
+	result := vm.Run()
+
+	s.store(s.env)
+	return result
+}
+
+// load makes the bindings of env available as globals
+func (s *State) load(env *object.Environment) {
+	for name, val := range env.Store {
+		symbol := s.symbolTable.DefineGlobal(name)
+		for len(s.globals.Slots) <= symbol.Index {
+			s.globals.Slots = append(s.globals.Slots, nil)
+		}
+		s.globals.Slots[symbol.Index] = val
+	}
+}
+
+// store binds the globals in env
+func (s *State) store(env *object.Environment) {
+	for i, name := range s.globals.Names {
+		if val := s.globals.Slots[i]; val != nil {
+			env.Set(name, val)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package vm
+
+import (
+	"monkey/code"
+	"monkey/object"
+)
+
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int // height of the stack before the call
+	locals      *object.Locals
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	fn := cl.Fn
+	return &Frame{
+		cl:          cl,
+		ip:          -1,
+		basePointer: basePointer,
+		locals: &object.Locals{
+			Names: fn.LocalNames,
+			Slots: make([]object.Object, fn.NumLocals),
+			Outer: cl.Env,
+		},
+	}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,174 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/object"
+)
+
+/*
+Instead of copying the stack and the locals of all frames before each instruction,
+the trace records what the instruction before has changed: the top of the stack
+and the local it has written. An instruction pushes at most one value and calls at
+most one function, so the stack below the top is the stack of the last step whose
+stack was one value lower, and the frames below the current one are those of the
+last step with one frame less. The states are reconstructed by Trace.Step.
+*/
+
+// A Trace records the states of a virtual machine
+type Trace struct {
+	records  []record
+	lastSp   []int // the last step with a stack of the height of the index
+	lastBase []int // the last step with the number of frames of the index
+	logs     map[*object.Locals]*localsLog
+}
+
+// record is the state before an instruction
+type record struct {
+	frame  *Frame
+	ip     int
+	sp     int
+	top    object.Object // stack[sp-1] if sp > 0
+	below  int           // the step whose stack is this stack without top, -1 if none
+	frames int
+	caller int // the step whose frames are these without the current one, -1 if none
+}
+
+// localsLog is the history of the locals of a frame during the evaluation
+type localsLog struct {
+	initial []object.Object // the locals when the frame was first seen
+	events  []localsEvent   // in the order of the steps
+}
+
+// localsEvent is a local set after step-1 and before step
+type localsEvent struct {
+	step  int
+	index int
+	val   object.Object
+}
+
+// A Step is the state of a virtual machine before an instruction is executed
+type Step struct {
+	Frames      []FrameState // innermost frame last
+	Ip          int
+	Instruction string
+	Stack       []object.Object
+}
+
+type FrameState struct {
+	Function   string
+	Ip         int // of the current instruction, the call in outer frames
+	LocalNames []string
+	Locals     []object.Object
+}
+
+func (vm *VM) recordStep() {
+	t := vm.trace
+	if t.logs == nil {
+		t.logs = make(map[*object.Locals]*localsLog)
+	}
+	frame := vm.currentFrame()
+	step := len(t.records)
+
+	r := record{frame: frame, ip: frame.ip, sp: vm.sp, below: -1, frames: len(vm.frames), caller: -1}
+	if vm.sp > 0 {
+		r.top = vm.stack[vm.sp-1]
+		if vm.sp-1 < len(t.lastSp) {
+			r.below = t.lastSp[vm.sp-1]
+		}
+	}
+	if r.frames-1 < len(t.lastBase) {
+		r.caller = t.lastBase[r.frames-1]
+	}
+	t.records = append(t.records, r)
+	t.lastSp = setLast(t.lastSp, vm.sp, step)
+	t.lastBase = setLast(t.lastBase, r.frames, step)
+
+	if _, ok := t.logs[frame.locals]; !ok {
+		initial := make([]object.Object, len(frame.locals.Slots))
+		copy(initial, frame.locals.Slots)
+		t.logs[frame.locals] = &localsLog{initial: initial}
+	}
+}
+
+// setLast sets last[i] to step, extending last if needed
+func setLast(last []int, i int, step int) []int {
+	for len(last) <= i {
+		last = append(last, -1)
+	}
+	last[i] = step
+	return last
+}
+
+// setLocal sets a local of a frame and logs it if the frame is traced
+func (vm *VM) setLocal(frame *Frame, index int, val object.Object) {
+	frame.locals.Slots[index] = val
+	if vm.trace == nil {
+		return
+	}
+	if log, ok := vm.trace.logs[frame.locals]; ok {
+		log.events = append(log.events, localsEvent{step: len(vm.trace.records), index: index, val: val})
+	}
+}
+
+// Steps returns the number of steps recorded
+func (t *Trace) Steps() int {
+	return len(t.records)
+}
+
+// Step returns the state before the instruction of step i
+func (t *Trace) Step(i int) Step {
+	r := t.records[i]
+
+	stack := make([]object.Object, r.sp)
+	for j := i; j >= 0 && t.records[j].sp > 0; j = t.records[j].below {
+		stack[t.records[j].sp-1] = t.records[j].top
+	}
+
+	frames := make([]FrameState, r.frames)
+	for j := i; j >= 0; j = t.records[j].caller {
+		f := t.records[j]
+		frames[f.frames-1] = FrameState{
+			Function:   functionName(f.frame.cl),
+			Ip:         f.ip,
+			LocalNames: f.frame.locals.Names,
+			Locals:     t.localsAt(f.frame.locals, i),
+		}
+	}
+
+	return Step{
+		Frames:      frames,
+		Ip:          r.ip,
+		Instruction: fmtInstruction(r.frame.Instructions(), r.ip),
+		Stack:       stack,
+	}
+}
+
+// localsAt returns the locals as they were at step
+func (t *Trace) localsAt(locals *object.Locals, step int) []object.Object {
+	log := t.logs[locals]
+	slots := make([]object.Object, len(log.initial))
+	copy(slots, log.initial)
+	for _, event := range log.events {
+		if event.step > step {
+			break
+		}
+		slots[event.index] = event.val
+	}
+	return slots
+}
+
+// fmtInstruction formats the instruction at ip, e.g. "OpConstant 0"
+func fmtInstruction(ins code.Instructions, ip int) string {
+	def, err := code.Lookup(ins[ip])
+	if err != nil {
+		return fmt.Sprintf("ERROR: %s", err)
+	}
+	operands, _ := code.ReadOperands(def, ins[ip+1:])
+
+	str := def.Name
+	for _, operand := range operands {
+		str += fmt.Sprintf(" %d", operand)
+	}
+	return str
+}
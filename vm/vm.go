@@ -0,0 +1,565 @@
+package vm
+
+import (
+	"monkey/ast"
+	"monkey/code"
+	"monkey/evaluator"
+	"monkey/object"
+	"time"
+)
+
+const StackSize = 2048
+
+// the limits and interrupts are only checked every checkInterval steps
+const checkInterval = 1024
+
+var (
+	True  = evaluator.TRUE
+	False = evaluator.FALSE
+	Null  = evaluator.NULL
+)
+
+type VM struct {
+	globals *object.Globals
+
+	stack []object.Object
+	sp    int // Always points to the next value. Top of stack is stack[sp-1]
+
+	frames   []*Frame
+	handlers []handler
+
+	limits   evaluator.Limits
+	steps    int
+	deadline time.Time
+
+	trace *Trace // nil if no trace is recorded
+}
+
+// a handler is active while the block of a try expression is executed
+type handler struct {
+	frame int // index of the frame of the try expression
+	ip    int // start of the catch block
+	sp    int
+	slot  int // local index of the catch parameter
+}
+
+// New creates a virtual machine running the main function of a program
+func New(main *object.CompiledFunction, globals *object.Globals) *VM {
+	vm := newVM(globals)
+	vm.pushFrame(NewFrame(&object.Closure{Fn: main, Globals: globals}, 0))
+	return vm
+}
+
+func newVM(globals *object.Globals) *VM {
+	vm := &VM{
+		globals: globals,
+		stack:   make([]object.Object, StackSize),
+		sp:      0,
+		frames:  make([]*Frame, 0, 16),
+		limits:  evaluator.CurrentLimits(),
+	}
+	if vm.limits.Timeout > 0 {
+		vm.deadline = time.Now().Add(vm.limits.Timeout)
+	}
+	return vm
+}
+
+// Apply applies a closure created by a virtual machine
+func Apply(cl *object.Closure, args []object.Object) object.Object {
+	vm := newVM(cl.Globals)
+	if err := vm.callClosure(cl, args, 0); err != nil {
+		return err
+	}
+	return vm.Run()
+}
+
+// Run runs until the bottom frame returns. The result is its value
+// or an error that has not been caught.
+func (vm *VM) Run() object.Object {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for {
+		frame := vm.currentFrame()
+		frame.ip++
+
+		ip = frame.ip
+		ins = frame.Instructions()
+		op = code.Opcode(ins[ip])
+
+		if vm.trace != nil {
+			vm.recordStep()
+		}
+
+		err := vm.step()
+
+		if err == nil {
+			switch op {
+			case code.OpConstant:
+				constIndex := code.ReadUint16(ins[ip+1:])
+				frame.ip += 2
+
+				vm.push(frame.cl.Fn.Constants[constIndex])
+
+			case code.OpPop:
+				vm.pop()
+
+			case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+				code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+				err = vm.executeBinaryOperation(op)
+
+			case code.OpBang:
+				err = vm.push(evaluator.EvalPrefixExpression("!", vm.pop()))
+
+			case code.OpMinus:
+				err = vm.push(evaluator.EvalPrefixExpression("-", vm.pop()))
+
+			case code.OpTrue:
+				vm.push(True)
+
+			case code.OpFalse:
+				vm.push(False)
+
+			case code.OpNull:
+				vm.push(Null)
+
+			case code.OpNil:
+				vm.push(nil)
+
+			case code.OpJump:
+				pos := int(code.ReadUint16(ins[ip+1:]))
+				frame.ip = pos - 1
+
+			case code.OpJumpNotTruthy:
+				pos := int(code.ReadUint16(ins[ip+1:]))
+				frame.ip += 2
+
+				condition := vm.pop()
+				if !evaluator.IsTruthy(condition) {
+					frame.ip = pos - 1
+				}
+
+			case code.OpSetGlobal:
+				globalIndex := code.ReadUint16(ins[ip+1:])
+				frame.ip += 2
+
+				name := vm.globals.Names[globalIndex]
+				vm.globals.Slots[globalIndex] = nameFunction(vm.pop(), name)
+
+			case code.OpGetGlobal:
+				globalIndex := code.ReadUint16(ins[ip+1:])
+				frame.ip += 2
+
+				err = vm.push(vm.getGlobal(int(globalIndex)))
+
+			case code.OpSetLocal:
+				localIndex := code.ReadUint8(ins[ip+1:])
+				frame.ip += 1
+
+				name := frame.locals.Names[localIndex]
+				vm.setLocal(frame, int(localIndex), nameFunction(vm.pop(), name))
+
+			case code.OpGetLocal:
+				depth := code.ReadUint8(ins[ip+1:])
+				localIndex := code.ReadUint8(ins[ip+2:])
+				frame.ip += 2
+
+				locals := frame.locals
+				for i := 0; i < int(depth); i++ {
+					locals = locals.Outer
+				}
+				val := locals.Slots[localIndex]
+				if val == nil {
+					err = evaluator.NewError("identifier not found: " + locals.Names[localIndex])
+				} else {
+					vm.push(val)
+				}
+
+			case code.OpArray:
+				numElements := int(code.ReadUint16(ins[ip+1:]))
+				frame.ip += 2
+
+				elements := make([]object.Object, numElements)
+				copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+				vm.sp = vm.sp - numElements
+
+				vm.push(&object.Array{Elements: elements})
+
+			case code.OpHash:
+				numElements := int(code.ReadUint16(ins[ip+1:]))
+				frame.ip += 2
+
+				hash := vm.buildHash(vm.sp-numElements, vm.sp)
+				vm.sp = vm.sp - numElements
+
+				err = vm.push(hash)
+
+			case code.OpIndex:
+				index := vm.pop()
+				left := vm.pop()
+
+				err = vm.push(evaluator.EvalIndexExpression(left, index))
+
+			case code.OpSlice:
+				flags := code.ReadUint8(ins[ip+1:])
+				frame.ip += 1
+
+				var start, end object.Object
+				if flags&code.SliceEnd != 0 {
+					end = vm.pop()
+				}
+				if flags&code.SliceStart != 0 {
+					start = vm.pop()
+				}
+				left := vm.pop()
+
+				err = vm.push(evaluator.SliceObject(left, start, end))
+
+			case code.OpCall:
+				numArgs := code.ReadUint8(ins[ip+1:])
+				frame.ip += 1
+
+				err = vm.executeCall(int(numArgs), false)
+
+			case code.OpTailCall:
+				numArgs := code.ReadUint8(ins[ip+1:])
+				frame.ip += 1
+
+				err = vm.executeCall(int(numArgs), true)
+
+			case code.OpReturnValue:
+				returnValue := vm.pop()
+
+				if len(vm.frames) == 1 {
+					return returnValue
+				}
+
+				frame := vm.popFrame()
+				vm.sp = frame.basePointer
+
+				vm.push(returnValue)
+
+			case code.OpClosure:
+				constIndex := code.ReadUint16(ins[ip+1:])
+				frame.ip += 2
+
+				fn := frame.cl.Fn.Constants[constIndex].(*object.CompiledFunction)
+				vm.push(&object.Closure{Fn: fn, Env: frame.locals, Globals: vm.globals})
+
+			case code.OpTry:
+				handlerPos := int(code.ReadUint16(ins[ip+1:]))
+				slot := int(code.ReadUint8(ins[ip+3:]))
+				frame.ip += 3
+
+				vm.handlers = append(vm.handlers, handler{
+					frame: len(vm.frames) - 1,
+					ip:    handlerPos,
+					sp:    vm.sp,
+					slot:  slot,
+				})
+
+			case code.OpEndTry:
+				vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+			case code.OpQuote:
+				constIndex := code.ReadUint16(ins[ip+1:])
+				frame.ip += 2
+
+				call := frame.cl.Fn.Constants[constIndex].(*object.Quote).Node.(*ast.CallExpression)
+				quoted := evaluator.EvalQuoteCall(call, vm.environment(frame))
+				if e, ok := quoted.(*object.Error); ok {
+					err = e
+				} else {
+					err = vm.push(quoted)
+				}
+
+			default:
+				def, lookupErr := code.Lookup(byte(op))
+				if lookupErr != nil {
+					err = evaluator.NewError("%s", lookupErr)
+				} else {
+					err = evaluator.NewError("opcode %s not supported", def.Name)
+				}
+			}
+		}
+
+		if err != nil {
+			if uncaught := vm.raise(err); uncaught != nil {
+				return uncaught
+			}
+		}
+	}
+}
+
+// step counts a step and reports an error if a limit is exceeded
+func (vm *VM) step() *object.Error {
+	vm.steps++
+	if vm.limits.MaxSteps > 0 && vm.steps > vm.limits.MaxSteps {
+		return evaluator.NewError("step limit exceeded: %d", vm.limits.MaxSteps)
+	}
+	if vm.steps%checkInterval != 0 {
+		return nil
+	}
+	if evaluator.Interrupted() {
+		return evaluator.NewError("evaluation interrupted")
+	}
+	if !vm.deadline.IsZero() && time.Now().After(vm.deadline) {
+		return evaluator.NewError("timeout exceeded: %v", vm.limits.Timeout)
+	}
+	return nil
+}
+
+// raise passes an error to the innermost active handler;
+// it returns the error if there is none.
+func (vm *VM) raise(err *object.Error) *object.Error {
+	if err.Line == 0 {
+		vm.locateError(err)
+	}
+
+	if len(vm.handlers) == 0 {
+		return err
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	vm.frames = vm.frames[:h.frame+1]
+	vm.sp = h.sp
+
+	frame := vm.currentFrame()
+	vm.setLocal(frame, h.slot, evaluator.CaughtValue(err))
+	frame.ip = h.ip - 1
+
+	return nil
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) *object.Error {
+	right := vm.pop()
+	left := vm.pop()
+
+	if leftInt, ok := left.(*object.Integer); ok {
+		if rightInt, ok := right.(*object.Integer); ok {
+			return vm.push(integerOperation(op, leftInt.Value, rightInt.Value))
+		}
+	}
+
+	return vm.push(evaluator.EvalInfixExpression(operators[op], left, right))
+}
+
+var operators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+func integerOperation(op code.Opcode, left, right int64) object.Object {
+	switch op {
+	case code.OpAdd:
+		return &object.Integer{Value: left + right}
+	case code.OpSub:
+		return &object.Integer{Value: left - right}
+	case code.OpMul:
+		return &object.Integer{Value: left * right}
+	case code.OpDiv:
+		return &object.Integer{Value: left / right}
+	case code.OpEqual:
+		return nativeBoolToBooleanObject(left == right)
+	case code.OpNotEqual:
+		return nativeBoolToBooleanObject(left != right)
+	case code.OpGreaterThan:
+		return nativeBoolToBooleanObject(left > right)
+	default:
+		return nativeBoolToBooleanObject(left < right)
+	}
+}
+
+// environment binds the globals and the locals visible in frame
+// as the evaluator would, for the arguments of unquote
+func (vm *VM) environment(frame *Frame) *object.Environment {
+	env := object.NewEnvironment()
+	bind(env, vm.globals.Names, vm.globals.Slots)
+
+	chain := []*object.Locals{}
+	for locals := frame.locals; locals != nil; locals = locals.Outer {
+		chain = append(chain, locals)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		env = object.NewEnclosedEnvironment(env)
+		bind(env, chain[i].Names, chain[i].Slots)
+	}
+	return env
+}
+
+func bind(env *object.Environment, names []string, slots []object.Object) {
+	for i, val := range slots {
+		if val != nil {
+			env.Set(names[i], val)
+		}
+	}
+}
+
+func (vm *VM) getGlobal(index int) object.Object {
+	if val := vm.globals.Slots[index]; val != nil {
+		return val
+	}
+
+	name := vm.globals.Names[index]
+	if builtin, ok := evaluator.LookupBuiltin(name); ok {
+		return builtin
+	}
+
+	return evaluator.NewError("identifier not found: " + name)
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) object.Object {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		if !object.IsHashable(key) {
+			return evaluator.NewError("unusable as hash key: %s", key.Type())
+		}
+		hashKey := key.(object.Hashable)
+
+		hashedPairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: hashedPairs}
+}
+
+func (vm *VM) executeCall(numArgs int, tail bool) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	args := vm.stack[vm.sp-numArgs : vm.sp] // copied before the stack changes
+	basePointer := vm.sp - 1 - numArgs
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		if callee.Globals != vm.globals { // created by another virtual machine
+			vm.sp = basePointer
+			return vm.push(vm.addCallerFrames(Apply(callee, copyArgs(args))))
+		}
+		if !tail {
+			return vm.callClosure(callee, args, basePointer)
+		}
+		// the call takes over the frame of the caller, once it is known to succeed
+		if err := vm.checkCall(callee, args); err != nil {
+			return err
+		}
+		frame := vm.popFrame()
+		return vm.callClosure(callee, args, frame.basePointer)
+
+	case *object.Builtin:
+		vm.sp = basePointer
+		return vm.push(callee.Fn(copyArgs(args)...))
+
+	case *object.Function: // created by the evaluator
+		vm.sp = basePointer
+		return vm.push(vm.addCallerFrames(evaluator.ApplyFunction(callee, copyArgs(args))))
+
+	default:
+		return evaluator.NewError("not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, args []object.Object, basePointer int) *object.Error {
+	if err := vm.checkCall(cl, args); err != nil {
+		return err
+	}
+
+	frame := NewFrame(cl, basePointer)
+	copy(frame.locals.Slots, args[:cl.Fn.NumParameters])
+
+	vm.sp = basePointer
+	vm.pushFrame(frame)
+	return nil
+}
+
+// checkCall reports an error if cl cannot be called with args
+func (vm *VM) checkCall(cl *object.Closure, args []object.Object) *object.Error {
+	if vm.limits.MaxDepth > 0 && len(vm.frames) > vm.limits.MaxDepth {
+		return evaluator.NewError("call depth limit exceeded: %d", vm.limits.MaxDepth)
+	}
+	if len(args) < cl.Fn.NumParameters {
+		return evaluator.NewError("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, len(args))
+	}
+	return nil
+}
+
+func copyArgs(args []object.Object) []object.Object {
+	copied := make([]object.Object, len(args))
+	copy(copied, args)
+	return copied
+}
+
+// push pushes a value, errors are returned to be raised instead
+func (vm *VM) push(o object.Object) *object.Error {
+	if err, ok := o.(*object.Error); ok {
+		return err
+	}
+
+	if vm.sp >= len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[len(vm.frames)-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames = append(vm.frames, f)
+}
+
+// popFrame also deactivates the handlers of the frame
+func (vm *VM) popFrame() *Frame {
+	frame := vm.frames[len(vm.frames)-1]
+	vm.frames = vm.frames[:len(vm.frames)-1]
+
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].frame >= len(vm.frames) {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+
+	return frame
+}
+
+// nameFunction names an anonymous function bound by a let statement
+func nameFunction(obj object.Object, name string) object.Object {
+	switch fn := obj.(type) {
+	case *object.Closure:
+		if fn.Name == "" {
+			fn.Name = name
+		}
+	case *object.Function:
+		if fn.Name == "" {
+			fn.Name = name
+		}
+	}
+	return obj
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
@@ -0,0 +1,446 @@
+package vm
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		result := Eval(program, object.NewEnvironment())
+
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		integer, ok := actual.(*object.Integer)
+		if !ok || integer.Value != int64(expected) {
+			t.Errorf("wrong result for %q. want=%d, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case bool:
+		boolean, ok := actual.(*object.Boolean)
+		if !ok || boolean.Value != expected {
+			t.Errorf("wrong result for %q. want=%t, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case string:
+		str, ok := actual.(*object.String)
+		if !ok || str.Value != expected {
+			t.Errorf("wrong result for %q. want=%q, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok || len(array.Elements) != len(expected) {
+			t.Errorf("wrong result for %q. want=%v, got=%T (%+v)", input, expected, actual, actual)
+			return
+		}
+		for i, el := range expected {
+			testExpectedObject(t, input, el, array.Elements[i])
+		}
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("wrong result for %q. want=null, got=%T (%+v)", input, actual, actual)
+		}
+	case *object.Error:
+		errObj, ok := actual.(*object.Error)
+		if !ok || errObj.Message != expected.Message {
+			t.Errorf("wrong result for %q. want error %q, got=%T (%+v)", input, expected.Message, actual, actual)
+		}
+	case nil:
+		if actual != nil {
+			t.Errorf("wrong result for %q. want=nil, got=%T (%+v)", input, actual, actual)
+		}
+	}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-5", -5},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{`"a" < "b"`, true},
+		{"[1, [2]] == [1, [2]]", true},
+		{"!true", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 } ", 20},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (false) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { }", nil},
+		{"let a = 1;", nil},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let one = 1; let one = one + 1; one", 2},
+		{"if (true) { let a = 5; }; a", 5},
+		{"let f = fn() { a }; let a = 3; f()", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArraysHashesAndIndexes(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][99]", Null},
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{[1]: 5}[[1]]", 5},
+		{"{}[0]", Null},
+		{`"abc"[1]`, "b"},
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][:-1]", []int{1, 2, 3}},
+		{"[1, 2, 3, 4][2:]", []int{3, 4}},
+		{`"monkey"[:3]`, "mon"},
+		{"{[1]: 2, fn(){}: 3}", &object.Error{Message: "unusable as hash key: FUNCTION"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn() { 5 + 10; }; f()", 15},
+		{"let f = fn() { return 99; 100; }; f()", 99},
+		{"let f = fn() { }; f()", nil},
+		{"let f = fn(a, b) { a + b }; f(1, 2)", 3},
+		{"let f = fn(a) { a }; f(1, 2)", 1},
+		{"let f = fn(a, b) { a + b }; f(1)", &object.Error{Message: "wrong number of arguments: want=2, got=1"}},
+		{"let f = fn() { 1 }; f()()", &object.Error{Message: "not a function: INTEGER"}},
+		{"let newAdder = fn(a) { fn(b) { a + b } }; newAdder(2)(3)", 5},
+		{"let f = fn() { let x = 1; let g = fn() { x }; let x = 2; g() }; f()", 2},
+		{"let f = fn() { let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(10) }; f()", true},
+		{"let x = 5; let f = fn() { let x = x + 1; x }; f()", 6},
+		{"let loop = fn(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + n) } }; loop(100000, 0)", 5000050000},
+		{`len("four") + len([1, 2])`, 6},
+		{"let len = fn(x) { 42 }; len([])", 42},
+		{"len(1)", &object.Error{Message: "argument to `len` not supported, got INTEGER"}},
+		{"foobar", &object.Error{Message: "identifier not found: foobar"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []vmTestCase{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { throw(5) } catch (e) { e + 1 }", 6},
+		{"try { 1 + true } catch (e) { e }", "type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn() { throw(\"deep\") }; let g = fn() { f() + 1 }; try { g() } catch (e) { e }", "deep"},
+		{"let f = fn() { try { return 1; } catch (e) { 2 }; 3 }; f() + f()", 2},
+		{"try { throw(1) } catch (e) { throw(e + 1) }", &object.Error{Message: "2"}},
+		{"try { try { throw(1) } catch (e) { throw(e + 1) } } catch (e) { e * 10 }", 20},
+		{"try { throw(1) } catch (e) { let x = e; x }; x", &object.Error{Message: "identifier not found: x"}},
+		{"let x = 1; try { throw(2) } catch (x) { x }", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStackTracesMatchEvaluator(t *testing.T) {
+	inputs := []string{
+		"1 + true",
+		"let a = 1;\n  b",
+		"let f = fn(x) {\n  x + true\n};\nlet g = fn() { f(1) + 1 };\ng()",
+		"let f = fn(x) {\n  x + true\n};\nlet g = fn() { f(1) };\ng()",
+		"fn() { throw(1) }()",
+		"let adder = fn(x) { fn(y) { x + y } }; let addTrue = adder(true); addTrue(1)",
+		"let f = fn() { throw(1) }; let g = f; g()",
+		"[1, 2][true]",
+		`let h = {"a": fn() { -true }}; h["a"]()`,
+	}
+
+	for _, input := range inputs {
+		expected, ok := evaluator.Eval(parse(input), object.NewEnvironment()).(*object.Error)
+		if !ok {
+			t.Fatalf("evaluator does not return an error for %q", input)
+		}
+		got, ok := Eval(parse(input), object.NewEnvironment()).(*object.Error)
+		if !ok {
+			t.Errorf("vm does not return an error for %q", input)
+			continue
+		}
+
+		if got.StackTrace() != expected.StackTrace() {
+			t.Errorf("wrong stack trace for %q.\nwant=\n%s\ngot=\n%s", input, expected.StackTrace(), got.StackTrace())
+		}
+	}
+}
+
+func TestStackTracesAcrossEngines(t *testing.T) {
+	vmEval := func(input string, env *object.Environment) object.Object {
+		return NewState(env).Eval(parse(input))
+	}
+	treeEval := func(input string, env *object.Environment) object.Object {
+		return evaluator.Eval(parse(input), env)
+	}
+	engines := []struct {
+		name         string
+		define, call func(input string, env *object.Environment) object.Object
+	}{
+		{"tree calling vm", vmEval, treeEval},
+		{"vm calling tree", treeEval, vmEval},
+		{"vm calling another vm", vmEval, vmEval},
+	}
+	expected := "g (2:5)\nh (1:16)\n<program> (2:1)"
+
+	for _, tt := range engines {
+		env := object.NewEnvironment()
+		tt.define("let g = fn(x) {\n  x + true\n};", env)
+		err, ok := tt.call("let h = fn() { g(1) + 1 };\nh()", env).(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error returned", tt.name)
+			continue
+		}
+		frames := []string{}
+		for _, frame := range err.Stack {
+			frames = append(frames, frame.String())
+		}
+		if got := strings.Join(frames, "\n"); got != expected {
+			t.Errorf("%s: wrong stack frames.\nwant=\n%s\ngot=\n%s", tt.name, expected, got)
+		}
+	}
+}
+
+func TestEvalKeepsEnvironment(t *testing.T) {
+	env := object.NewEnvironment()
+
+	inputs := []vmTestCase{
+		{"let f = fn() { g() };", nil},
+		{"let g = fn() { x };", nil},
+		{"let x = 3;", nil},
+		{"f()", 3},
+		{"let x = 4; f()", 4},
+	}
+
+	state := NewState(env)
+	for _, tt := range inputs {
+		testExpectedObject(t, tt.input, tt.expected, state.Eval(parse(tt.input)))
+	}
+
+	// functions are shared with the evaluator
+	evaluated := evaluator.Eval(parse("let h = fn(y) { f() + y }; h(1)"), env)
+	testExpectedObject(t, "h(1)", 5, evaluated)
+	testExpectedObject(t, "h(2)", 6, state.Eval(parse("h(2)")))
+}
+
+func TestTailCallFromEvaluator(t *testing.T) {
+	env := object.NewEnvironment()
+	NewState(env).Eval(parse("let g = fn(a) { a }; let f = fn() { g() };"))
+
+	// the tail call g() fails in the bottom frame of the virtual machine applying f
+	evaluated, ok := evaluator.Eval(parse("f()"), env).(*object.Error)
+	if !ok {
+		t.Fatalf("no error returned for f()")
+	}
+	if evaluated.Message != "wrong number of arguments: want=1, got=0" {
+		t.Errorf("wrong error message. got=%q", evaluated.Message)
+	}
+}
+
+func TestConstantsPerInput(t *testing.T) {
+	state := NewState(object.NewEnvironment())
+	testExpectedObject(t, "let f", nil, state.Eval(parse(`let f = fn() { "kept" + "!" };`)))
+
+	// 70 inputs of 1000 literals each exceed the constants of a single input
+	literals := make([]string, 1000)
+	for i := range literals {
+		literals[i] = "1"
+	}
+	input := strings.Join(literals, " + ")
+	for i := 0; i < 70; i++ {
+		if result := state.Eval(parse(input)); result.Inspect() != "1000" {
+			t.Fatalf("wrong result of input %d: %s", i, result.Inspect())
+		}
+	}
+
+	testExpectedObject(t, "f()", "kept!", state.Eval(parse("f()")))
+}
+
+func TestEvalTrace(t *testing.T) {
+	evaluated, trace := NewState(object.NewEnvironment()).EvalTrace(parse("let f = fn(x) { x * 2 }; f(3) + 1"))
+	testExpectedObject(t, "f(3) + 1", 7, evaluated)
+
+	if trace == nil || trace.Steps() == 0 {
+		t.Fatalf("no steps recorded")
+	}
+
+	var sawCall, sawLocal bool
+	for i := 0; i < trace.Steps(); i++ {
+		step := trace.Step(i)
+		if len(step.Frames) == 2 && step.Frames[1].Function == "f" {
+			sawCall = true
+			locals := step.Frames[1].Locals
+			if len(locals) == 1 && locals[0] != nil && locals[0].Inspect() == "3" {
+				sawLocal = true
+			}
+		}
+	}
+	if !sawCall {
+		t.Errorf("no step recorded within f")
+	}
+	if !sawLocal {
+		t.Errorf("argument of f not recorded among its locals")
+	}
+
+	last := trace.Step(trace.Steps() - 1)
+	if last.Instruction != "OpReturnValue" {
+		t.Errorf("last instruction wrong. got=%q", last.Instruction)
+	}
+	if len(last.Stack) != 1 || last.Stack[0].Inspect() != "7" {
+		t.Errorf("stack before returning wrong. got=%v", last.Stack)
+	}
+}
+
+// TestTraceStates checks states reconstructed from the changes recorded,
+// after calls, tail calls, caught errors and instructions popping several values
+func TestTraceStates(t *testing.T) {
+	input := `let f = fn(x) { let y = x * 2; g(y) };
+let g = fn(z) { try { throw(z + 1) } catch (e) { [e, z] } };
+[1, f(3)]`
+	evaluated, trace := NewState(object.NewEnvironment()).EvalTrace(parse(input))
+	if evaluated.Inspect() != "[1, [7, 6]]" {
+		t.Fatalf("wrong result. got=%s", evaluated.Inspect())
+	}
+
+	tests := []struct {
+		function    string
+		instruction string // the first step of the function with this instruction
+		frames      string
+		stack       string
+		locals      string
+	}{
+		{"f", "OpTailCall 1", "<program> f", "1 fn 6", "3 6"},
+		{"g", "OpArray 2", "<program> g", "1 7 6", "6 7"},
+		{"<program>", "OpArray 2", "<program>", "1 [7, 6]", ""},
+	}
+
+	for _, tt := range tests {
+		found := false
+		for i := 0; i < trace.Steps() && !found; i++ {
+			step := trace.Step(i)
+			frame := step.Frames[len(step.Frames)-1]
+			if frame.Function != tt.function || step.Instruction != tt.instruction {
+				continue
+			}
+			found = true
+
+			names := []string{}
+			for _, f := range step.Frames {
+				names = append(names, f.Function)
+			}
+			if got := strings.Join(names, " "); got != tt.frames {
+				t.Errorf("%s %s: wrong frames. want=%q, got=%q", tt.function, tt.instruction, tt.frames, got)
+			}
+			if got := inspectAll(step.Stack); got != tt.stack {
+				t.Errorf("%s %s: wrong stack. want=%q, got=%q", tt.function, tt.instruction, tt.stack, got)
+			}
+			if got := inspectAll(frame.Locals); got != tt.locals {
+				t.Errorf("%s %s: wrong locals. want=%q, got=%q", tt.function, tt.instruction, tt.locals, got)
+			}
+		}
+		if !found {
+			t.Errorf("no step of %s with %s", tt.function, tt.instruction)
+		}
+	}
+}
+
+func inspectAll(objs []object.Object) string {
+	strs := []string{}
+	for _, obj := range objs {
+		switch obj.(type) {
+		case nil:
+			strs = append(strs, "nil")
+		case *object.Closure:
+			strs = append(strs, "fn")
+		default:
+			strs = append(strs, obj.Inspect())
+		}
+	}
+	return strings.Join(strs, " ")
+}
+
+// BenchmarkEvalTrace traces a recursion as deep as the stack of the virtual machine is high
+func BenchmarkEvalTrace(b *testing.B) {
+	program := parse("let f = fn(x) { if (x == 0) { 0 } else { 1 + f(x - 1) } }; f(500)")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		NewState(object.NewEnvironment()).EvalTrace(program)
+	}
+}
+
+func BenchmarkFibonacci(b *testing.B) {
+	input := "let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } }; fib(20)"
+
+	b.Run("tree", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			evaluator.Eval(parse(input), object.NewEnvironment())
+		}
+	})
+	b.Run("vm", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Eval(parse(input), object.NewEnvironment())
+		}
+	})
+}